@@ -0,0 +1,309 @@
+// Package client is the Go client of memdist. It finds the members of the
+// cluster from a few seed addresses, sends the writes and the consistent
+// reads to the leader, spreads the stale reads over every member and retries
+// the calls that failed because a node was unavailable or wasn't the leader.
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxRetries      = 3
+	defaultMinBackoff      = 50 * time.Millisecond
+	defaultMaxBackoff      = time.Second
+	defaultRefreshInterval = 30 * time.Second
+)
+
+// ErrClosed is returned by the calls made after Close.
+var ErrClosed = errors.New("client: closed")
+
+type Config struct {
+	// Addrs are the seed addresses, any member of the cluster will do.
+	Addrs []string
+	// DialOptions are used for every connection, they must set the
+	// transport credentials.
+	DialOptions []grpc.DialOption
+	// Consistency is the default consistency of the reads.
+	Consistency api.Consistency
+	// MaxRetries is the number of times a failed call is retried, zero
+	// uses 3 and a negative value disables the retries.
+	MaxRetries int
+	// MinBackoff is the delay before the first retry, it doubles with each
+	// retry up to MaxBackoff. Zero values use 50ms and 1s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// RefreshInterval is the time between two lookups of the members, zero
+	// uses 30s. The members are also looked up after a failed call.
+	RefreshInterval time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxRetries == 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	}
+	if c.MinBackoff == 0 {
+		c.MinBackoff = defaultMinBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = defaultRefreshInterval
+	}
+	return c
+}
+
+// Client is safe for concurrent use. It keeps one connection per member,
+// gRPC multiplexes the calls over it.
+type Client struct {
+	cfg Config
+
+	mu      sync.Mutex
+	conns   map[string]*grpc.ClientConn
+	members []string
+	leader  string
+	next    int
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New looks up the members of the cluster through the seeds, it fails when
+// none of them answers.
+func New(ctx context.Context, cfg Config) (*Client, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("client: no seed address")
+	}
+	c := &Client{
+		cfg:     cfg.withDefaults(),
+		conns:   make(map[string]*grpc.ClientConn),
+		members: cfg.Addrs,
+		done:    make(chan struct{}),
+	}
+	if err := c.refresh(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	c.wg.Add(1)
+	go c.refreshLoop()
+
+	return c, nil
+}
+
+// Close stops the lookups and closes the connections, the pending calls fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conns := c.conns
+	c.conns = nil
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	var err error
+	for _, conn := range conns {
+		err = errors.Join(err, conn.Close())
+	}
+	return err
+}
+
+// Members returns the addresses of the known members.
+func (c *Client) Members() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.members...)
+}
+
+// Leader returns the address of the leader, empty while it is unknown.
+func (c *Client) Leader() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.leader
+}
+
+func (c *Client) refreshLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.cfg.RefreshInterval)
+			// a failed lookup keeps the previous members
+			_ = c.refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// refresh asks the leader for the members, then the other members and the
+// seeds until one of them answers.
+func (c *Client) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	candidates := slices.Concat([]string{c.leader}, c.members, c.cfg.Addrs)
+	c.mu.Unlock()
+
+	var err error
+	seen := make(map[string]bool)
+	for _, addr := range candidates {
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		client, cerr := c.client(addr)
+		if cerr != nil {
+			return cerr
+		}
+		res, cerr := client.GetServers(ctx, &api.GetServersRequest{})
+		if cerr != nil {
+			err = cerr
+			continue
+		}
+		c.update(res.Servers)
+		return nil
+	}
+	return err
+}
+
+// update replaces the members and closes the connections to the nodes that
+// left the cluster.
+func (c *Client) update(servers []*api.Server) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+
+	// a node outside of a cluster has no members, its seeds are used as is
+	members, leader := c.cfg.Addrs, ""
+	if len(servers) > 0 {
+		members = nil
+		for _, srv := range servers {
+			members = append(members, srv.RpcAddr)
+			if srv.IsLeader {
+				leader = srv.RpcAddr
+			}
+		}
+	}
+	c.members, c.leader = members, leader
+
+	keep := make(map[string]bool)
+	for _, addr := range slices.Concat(members, c.cfg.Addrs) {
+		keep[addr] = true
+	}
+	for addr, conn := range c.conns {
+		if !keep[addr] {
+			conn.Close()
+			delete(c.conns, addr)
+		}
+	}
+}
+
+// client returns the client of addr, dialing it the first time.
+func (c *Client) client(addr string) (api.DatabaseClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	conn, ok := c.conns[addr]
+	if !ok {
+		var err error
+		if conn, err = grpc.NewClient(addr, c.cfg.DialOptions...); err != nil {
+			return nil, err
+		}
+		c.conns[addr] = conn
+	}
+	return api.NewDatabaseClient(conn), nil
+}
+
+// route tells which nodes may serve a call.
+type route int
+
+const (
+	toLeader route = iota
+	toAny
+)
+
+// readRoute sends the stale reads to any member, the other ones are only
+// served by the leader.
+func readRoute(consistency api.Consistency) route {
+	if consistency == api.Consistency_STALE {
+		return toAny
+	}
+	return toLeader
+}
+
+// pick returns the client of a node allowed by r. The followers forward
+// the requests of the leader, so any member will do while it is unknown.
+func (c *Client) pick(r route) (api.DatabaseClient, error) {
+	c.mu.Lock()
+	addr := c.leader
+	if r == toAny || addr == "" {
+		addr = c.members[c.next%len(c.members)]
+		c.next++
+	}
+	c.mu.Unlock()
+	return c.client(addr)
+}
+
+// call runs fn on a node picked by r and retries it with backoff while the
+// error allows it. The calls that aren't idempotent are only retried when
+// the node refused them, an unavailable node may have applied them.
+func (c *Client) call(ctx context.Context, r route, idempotent bool, fn func(api.DatabaseClient) error) error {
+	backoff := c.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		client, err := c.pick(r)
+		if err != nil {
+			return err
+		}
+		err = fn(client)
+		if err == nil || attempt >= c.cfg.MaxRetries || !retryable(err, idempotent) {
+			return err
+		}
+
+		// the failure may come from a change of leader
+		_ = c.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-c.done:
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.cfg.MaxBackoff)
+	}
+}
+
+func retryable(err error, idempotent bool) bool {
+	st := status.Convert(err)
+	for _, detail := range st.Details() {
+		if _, ok := detail.(*api.NotLeader); ok {
+			return true
+		}
+	}
+	return idempotent && st.Code() == codes.Unavailable
+}
@@ -0,0 +1,153 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/client"
+	"github.com/dunielm02/memdist/internal/agent"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/go-dynaport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient(t *testing.T) {
+	agents := setupAgents(t, 3)
+	ctx := context.Background()
+
+	// a follower is enough to find the others
+	c, err := client.New(ctx, client.Config{
+		Addrs:           []string{agents[2].RPCAddr},
+		DialOptions:     dialOptions(t, config.RootCertFile, config.RootKeyFile),
+		Consistency:     api.Consistency_LINEARIZABLE,
+		RefreshInterval: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Eventually(t, func() bool {
+		return len(c.Members()) == 3 && c.Leader() == agents[0].RPCAddr
+	}, 5*time.Second, 50*time.Millisecond)
+
+	version, err := c.Set(ctx, "foo", []byte("bar"), client.WithTTL(time.Minute))
+	require.NoError(t, err)
+	res, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.Equal(t, []byte("bar"), res.Value)
+	require.Equal(t, version, res.Version)
+
+	_, err = c.Set(ctx, "foo", []byte("baz"), client.IfAbsent())
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = c.Incr(ctx, "counter", 5)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.Set(ctx, "counter", []byte("1"))
+	require.NoError(t, err)
+	value, err := c.Incr(ctx, "counter", 5)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), value)
+
+	var keys []string
+	_, err = c.Scan(ctx, &api.ScanRequest{}, func(r *api.Record) error {
+		keys = append(keys, r.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"counter", "foo"}, keys)
+
+	// the stale reads are spread over the members, the ones sent to the
+	// node that left are retried on the others
+	require.NoError(t, agents[2].Shutdown())
+	for range 10 {
+		res, err := c.Get(ctx, "foo", client.WithConsistency(api.Consistency_STALE))
+		require.NoError(t, err)
+		require.Equal(t, []byte("bar"), res.Value)
+	}
+	require.Eventually(t, func() bool {
+		return len(c.Members()) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, c.Close())
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, client.ErrClosed)
+}
+
+func TestClientPermissionDenied(t *testing.T) {
+	agents := setupAgents(t, 1)
+	ctx := context.Background()
+
+	// every caller finds the servers, the policies apply to the keys
+	c, err := client.New(ctx, client.Config{
+		Addrs:       []string{agents[0].RPCAddr},
+		DialOptions: dialOptions(t, config.NobodyCertFile, config.NobodyKeyFile),
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Set(ctx, "private/1", []byte("theirs"))
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.Set(ctx, "public/nobody/1", []byte("mine"))
+	require.NoError(t, err)
+}
+
+func setupAgents(t *testing.T, nodeCount int) []*agent.Agent {
+	t.Helper()
+
+	var agents []*agent.Agent
+	for i := range nodeCount {
+		ports := dynaport.Get(2)
+
+		var startJoinAddrs []string
+		if i != 0 {
+			startJoinAddrs = []string{agents[0].BindAddr}
+		}
+
+		a, err := agent.New(agent.Config{
+			NodeName:       fmt.Sprintf("%d", i),
+			DataDir:        t.TempDir(),
+			BindAddr:       fmt.Sprintf("127.0.0.1:%d", ports[0]),
+			RPCAddr:        fmt.Sprintf("127.0.0.1:%d", ports[1]),
+			StartJoinAddrs: startJoinAddrs,
+			Bootstrap:      i == 0,
+			ServerTLSConfig: config.TLSConfig{
+				CertFile: config.ServerCertFile,
+				KeyFile:  config.ServerKeyFile,
+				CAFile:   config.CAFile,
+				Server:   true,
+			},
+			PeerTLSConfig: config.TLSConfig{
+				CertFile: config.ServerCertFile,
+				KeyFile:  config.ServerKeyFile,
+				CAFile:   config.CAFile,
+			},
+			ACLModelFile:  config.ACLModelFile,
+			ACLPolicyFile: config.ACLPolicyFile,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { a.Shutdown() })
+
+		agents = append(agents, a)
+	}
+
+	return agents
+}
+
+func dialOptions(t *testing.T, cert, key string) []grpc.DialOption {
+	t.Helper()
+
+	tlsConfig, err := config.GetTlsConfig(config.TLSConfig{
+		CertFile: cert,
+		KeyFile:  key,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+}
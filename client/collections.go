@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+
+	"github.com/dunielm02/memdist/api/v1"
+)
+
+// HSet sets the fields of the hash stored under key and returns the number
+// of fields that didn't exist.
+func (c *Client) HSet(ctx context.Context, key string, fields map[string][]byte) (uint32, error) {
+	var res *api.HSetResponse
+	err := c.call(ctx, toLeader, true, func(client api.DatabaseClient) (err error) {
+		res, err = client.HSet(ctx, &api.HSetRequest{Key: key, Fields: fields})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Added, nil
+}
+
+// HGet returns the value of a field of the hash stored under key.
+func (c *Client) HGet(ctx context.Context, key, field string, opts ...ReadOption) ([]byte, error) {
+	o := c.readOptions(opts)
+	var res *api.HGetResponse
+	err := c.call(ctx, readRoute(o.consistency), true, func(client api.DatabaseClient) (err error) {
+		res, err = client.HGet(ctx, &api.HGetRequest{Key: key, Field: field, Consistency: o.consistency})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+// HDel removes fields from the hash stored under key and returns the number
+// of fields removed.
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) (uint32, error) {
+	var res *api.HDelResponse
+	err := c.call(ctx, toLeader, true, func(client api.DatabaseClient) (err error) {
+		res, err = client.HDel(ctx, &api.HDelRequest{Key: key, Fields: fields})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Removed, nil
+}
+
+// HGetAll returns every field of the hash stored under key.
+func (c *Client) HGetAll(ctx context.Context, key string, opts ...ReadOption) (map[string][]byte, error) {
+	o := c.readOptions(opts)
+	var res *api.HGetAllResponse
+	err := c.call(ctx, readRoute(o.consistency), true, func(client api.DatabaseClient) (err error) {
+		res, err = client.HGetAll(ctx, &api.HGetAllRequest{Key: key, Consistency: o.consistency})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Fields, nil
+}
+
+// LPush pushes values to an end of the list stored under key and returns
+// its length. It is only retried when the node refused it.
+func (c *Client) LPush(ctx context.Context, key string, end api.ListEnd, values ...[]byte) (uint64, error) {
+	var res *api.LPushResponse
+	err := c.call(ctx, toLeader, false, func(client api.DatabaseClient) (err error) {
+		res, err = client.LPush(ctx, &api.LPushRequest{Key: key, End: end, Values: values})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Length, nil
+}
+
+// LPop removes count values from an end of the list stored under key and
+// returns them. It is only retried when the node refused it.
+func (c *Client) LPop(ctx context.Context, key string, end api.ListEnd, count uint32) ([][]byte, error) {
+	var res *api.LPopResponse
+	err := c.call(ctx, toLeader, false, func(client api.DatabaseClient) (err error) {
+		res, err = client.LPop(ctx, &api.LPopRequest{Key: key, End: end, Count: count})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Values, nil
+}
+
+// LRange returns the values of the list stored under key from start to
+// stop, both included.
+func (c *Client) LRange(ctx context.Context, key string, start, stop int64, opts ...ReadOption) ([][]byte, error) {
+	o := c.readOptions(opts)
+	req := &api.LRangeRequest{Key: key, Start: start, Stop: stop, Consistency: o.consistency}
+	var res *api.LRangeResponse
+	err := c.call(ctx, readRoute(o.consistency), true, func(client api.DatabaseClient) (err error) {
+		res, err = client.LRange(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Values, nil
+}
+
+// SAdd adds members to the set stored under key and returns the number of
+// members that weren't in the set.
+func (c *Client) SAdd(ctx context.Context, key string, members ...string) (uint32, error) {
+	var res *api.SAddResponse
+	err := c.call(ctx, toLeader, true, func(client api.DatabaseClient) (err error) {
+		res, err = client.SAdd(ctx, &api.SAddRequest{Key: key, Members: members})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Added, nil
+}
+
+// SRem removes members from the set stored under key and returns the
+// number of members removed.
+func (c *Client) SRem(ctx context.Context, key string, members ...string) (uint32, error) {
+	var res *api.SRemResponse
+	err := c.call(ctx, toLeader, true, func(client api.DatabaseClient) (err error) {
+		res, err = client.SRem(ctx, &api.SRemRequest{Key: key, Members: members})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Removed, nil
+}
+
+// SMembers returns the sorted members of the set stored under key.
+func (c *Client) SMembers(ctx context.Context, key string, opts ...ReadOption) ([]string, error) {
+	o := c.readOptions(opts)
+	var res *api.SMembersResponse
+	err := c.call(ctx, readRoute(o.consistency), true, func(client api.DatabaseClient) (err error) {
+		res, err = client.SMembers(ctx, &api.SMembersRequest{Key: key, Consistency: o.consistency})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Members, nil
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Get returns the value of key, the call fails with NotFound when the key
+// doesn't exist.
+func (c *Client) Get(ctx context.Context, key string, opts ...ReadOption) (*api.GetResponse, error) {
+	o := c.readOptions(opts)
+	var res *api.GetResponse
+	err := c.call(ctx, readRoute(o.consistency), true, func(client api.DatabaseClient) (err error) {
+		res, err = client.Get(ctx, &api.GetRequest{Key: key, Consistency: o.consistency})
+		return err
+	})
+	return res, err
+}
+
+// Set stores value under key and returns its new version.
+func (c *Client) Set(ctx context.Context, key string, value []byte, opts ...WriteOption) (uint64, error) {
+	o := newWriteOptions(opts)
+	req := &api.SetRequest{
+		Key:          key,
+		Value:        value,
+		Ttl:          o.ttl.Milliseconds(),
+		Flags:        o.flags,
+		Precondition: o.cond,
+	}
+	var res *api.SetResponse
+	// storing the same value twice leaves the key in the same state, only
+	// its version differs
+	err := c.call(ctx, toLeader, o.cond == nil, func(client api.DatabaseClient) (err error) {
+		res, err = client.Set(ctx, req)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Version, nil
+}
+
+// Delete removes key, deleting a key that doesn't exist succeeds unless
+// IfPresent is set.
+func (c *Client) Delete(ctx context.Context, key string, opts ...WriteOption) error {
+	o := newWriteOptions(opts)
+	req := &api.DeleteRequest{Key: key, Precondition: o.cond}
+	return c.call(ctx, toLeader, o.cond == nil, func(client api.DatabaseClient) error {
+		_, err := client.Delete(ctx, req)
+		return err
+	})
+}
+
+// Expire sets the time to live of key, a ttl lower or equal to zero expires
+// the key right away.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	req := &api.ExpireRequest{Key: key, Ttl: ttl.Milliseconds()}
+	return c.call(ctx, toLeader, true, func(client api.DatabaseClient) error {
+		_, err := client.Expire(ctx, req)
+		return err
+	})
+}
+
+// Persist removes the time to live of key.
+func (c *Client) Persist(ctx context.Context, key string) error {
+	req := &api.PersistRequest{Key: key}
+	return c.call(ctx, toLeader, true, func(client api.DatabaseClient) error {
+		_, err := client.Persist(ctx, req)
+		return err
+	})
+}
+
+// TTL returns the remaining time to live of key, -1 when it never expires.
+func (c *Client) TTL(ctx context.Context, key string, opts ...ReadOption) (time.Duration, error) {
+	o := c.readOptions(opts)
+	var res *api.TTLResponse
+	err := c.call(ctx, readRoute(o.consistency), true, func(client api.DatabaseClient) (err error) {
+		res, err = client.TTL(ctx, &api.TTLRequest{Key: key, Consistency: o.consistency})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if res.Ttl < 0 {
+		return -1, nil
+	}
+	return time.Duration(res.Ttl) * time.Millisecond, nil
+}
+
+// Incr adds delta to the integer stored under key and returns the result.
+// It is only retried when the node refused it, a retry could count it twice.
+func (c *Client) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	var res *api.IncrResponse
+	err := c.call(ctx, toLeader, false, func(client api.DatabaseClient) (err error) {
+		res, err = client.Incr(ctx, &api.IncrRequest{Key: key, Delta: delta})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Value, nil
+}
+
+// Decr subtracts delta from the integer stored under key, like Incr.
+func (c *Client) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	var res *api.DecrResponse
+	err := c.call(ctx, toLeader, false, func(client api.DatabaseClient) (err error) {
+		res, err = client.Decr(ctx, &api.DecrRequest{Key: key, Delta: delta})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Value, nil
+}
+
+// Txn runs a transaction, it is only retried when the node refused it.
+func (c *Client) Txn(ctx context.Context, req *api.TxnRequest) (*api.TxnResponse, error) {
+	var res *api.TxnResponse
+	err := c.call(ctx, toLeader, false, func(client api.DatabaseClient) (err error) {
+		res, err = client.Txn(ctx, req)
+		return err
+	})
+	return res, err
+}
+
+// MultiGet reads keys from the same view of the database, the results are
+// in the order of keys.
+func (c *Client) MultiGet(ctx context.Context, keys []string, opts ...ReadOption) ([]*api.MultiGetResponse_Result, error) {
+	o := c.readOptions(opts)
+	req := &api.MultiGetRequest{Keys: keys, Consistency: o.consistency}
+	var res *api.MultiGetResponse
+	err := c.call(ctx, readRoute(o.consistency), true, func(client api.DatabaseClient) (err error) {
+		res, err = client.MultiGet(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+// MultiSet writes items with a single raft entry, the results are in the
+// order of items.
+func (c *Client) MultiSet(ctx context.Context, items []*api.SetRequest) ([]*api.MultiSetResponse_Result, error) {
+	idempotent := true
+	for _, item := range items {
+		idempotent = idempotent && item.Precondition == nil
+	}
+	var res *api.MultiSetResponse
+	err := c.call(ctx, toLeader, idempotent, func(client api.DatabaseClient) (err error) {
+		res, err = client.MultiSet(ctx, &api.MultiSetRequest{Items: items})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+// MultiDelete removes keys with a single raft entry.
+func (c *Client) MultiDelete(ctx context.Context, keys []string) ([]*api.MultiDeleteResponse_Result, error) {
+	req := &api.MultiDeleteRequest{}
+	for _, key := range keys {
+		req.Items = append(req.Items, &api.DeleteRequest{Key: key})
+	}
+	var res *api.MultiDeleteResponse
+	err := c.call(ctx, toLeader, true, func(client api.DatabaseClient) (err error) {
+		res, err = client.MultiDelete(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+// Scan calls fn with the records of the range of req in order, and returns
+// the token that continues the scan when its Limit stopped it. The
+// consistency of req overrides the one of the client when it isn't STALE.
+// The scan is retried from the start when the stream fails before sending
+// any record.
+func (c *Client) Scan(ctx context.Context, req *api.ScanRequest, fn func(*api.Record) error) ([]byte, error) {
+	if req.Consistency == api.Consistency_STALE {
+		req = proto.Clone(req).(*api.ScanRequest)
+		req.Consistency = c.cfg.Consistency
+	}
+	var token []byte
+	err := c.call(ctx, readRoute(req.Consistency), true, func(client api.DatabaseClient) error {
+		// cancelling the context releases the stream when fn stops the scan
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, err := client.Scan(ctx, req)
+		if err != nil {
+			return err
+		}
+		for sent := false; ; sent = true {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				if sent {
+					// the records already handed to fn can't be taken back
+					return &permanent{err}
+				}
+				return err
+			}
+			if res.Record == nil {
+				token = res.ContinuationToken
+				continue
+			}
+			if err := fn(res.Record); err != nil {
+				return &permanent{err}
+			}
+		}
+	})
+	return token, unwrapPermanent(err)
+}
+
+// Watch returns the stream of the changes watched by req, it ends with ctx.
+// Only the call is retried, a stream that fails can be resumed with the
+// StartRevision following the last event received.
+func (c *Client) Watch(ctx context.Context, req *api.WatchRequest) (api.Database_WatchClient, error) {
+	var stream api.Database_WatchClient
+	err := c.call(ctx, toAny, true, func(client api.DatabaseClient) (err error) {
+		stream, err = client.Watch(ctx, req)
+		return err
+	})
+	return stream, err
+}
+
+// permanent stops the retries of the error it wraps, it has no status so
+// retryable always rejects it.
+type permanent struct {
+	err error
+}
+
+func (p *permanent) Error() string {
+	return p.err.Error()
+}
+
+func unwrapPermanent(err error) error {
+	if p, ok := err.(*permanent); ok {
+		return p.err
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+)
+
+// ReadOption changes a read.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	consistency api.Consistency
+}
+
+func (c *Client) readOptions(opts []ReadOption) readOptions {
+	o := readOptions{consistency: c.cfg.Consistency}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithConsistency overrides the consistency of the client for one read.
+func WithConsistency(consistency api.Consistency) ReadOption {
+	return func(o *readOptions) {
+		o.consistency = consistency
+	}
+}
+
+// WriteOption changes a Set or a Delete, the options that don't apply to
+// a Delete are ignored.
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	ttl   time.Duration
+	flags uint32
+	cond  *api.Precondition
+}
+
+func newWriteOptions(opts []WriteOption) writeOptions {
+	var o writeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o *writeOptions) precondition() *api.Precondition {
+	if o.cond == nil {
+		o.cond = &api.Precondition{}
+	}
+	return o.cond
+}
+
+// WithTTL sets the time to live of the key, it is rounded down to the
+// millisecond.
+func WithTTL(ttl time.Duration) WriteOption {
+	return func(o *writeOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithFlags stores flags along with the value.
+func WithFlags(flags uint32) WriteOption {
+	return func(o *writeOptions) {
+		o.flags = flags
+	}
+}
+
+// IfVersion applies the write only if the key is at version.
+func IfVersion(version uint64) WriteOption {
+	return func(o *writeOptions) {
+		o.precondition().IfVersion = version
+	}
+}
+
+// IfAbsent applies the write only if the key doesn't exist.
+func IfAbsent() WriteOption {
+	return func(o *writeOptions) {
+		o.precondition().IfAbsent = true
+	}
+}
+
+// IfPresent applies the write only if the key exists.
+func IfPresent() WriteOption {
+	return func(o *writeOptions) {
+		o.precondition().IfPresent = true
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/spf13/cobra"
+)
+
+func apiKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage the API keys replicated through the cluster",
+	}
+	cmd.AddCommand(
+		apiKeyCreateCmd(),
+		apiKeyRevokeCmd(),
+		apiKeyListCmd(),
+	)
+
+	return cmd
+}
+
+func apiKeyCreateCmd() *cobra.Command {
+	var f clientFlags
+	var roles []string
+	var ttl time.Duration
+	cmd := &cobra.Command{
+		Use:   "create SUBJECT",
+		Short: "Create a key authenticating as SUBJECT in the tenant of the caller and print it, it can't be read again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				res, err := client.CreateAPIKey(ctx, &api.CreateAPIKeyRequest{
+					Subject: args[0],
+					Roles:   roles,
+					Ttl:     ttl.Milliseconds(),
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\n%s\n", res.Id, res.Key)
+				return nil
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().StringSliceVar(&roles, "role", nil, "Roles of the subject, can be repeated.")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Time to live of the key, zero keeps it until revoked.")
+
+	return cmd
+}
+
+func apiKeyRevokeCmd() *cobra.Command {
+	var f clientFlags
+	cmd := &cobra.Command{
+		Use:     "revoke ID",
+		Aliases: []string{"rm"},
+		Short:   "Revoke the key of ID",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				res, err := client.RevokeAPIKey(ctx, &api.RevokeAPIKeyRequest{Id: args[0]})
+				if err != nil {
+					return err
+				}
+				if !res.Revoked {
+					return fmt.Errorf("api key not found: %s", args[0])
+				}
+				return nil
+			})
+		},
+	}
+	f.register(cmd)
+
+	return cmd
+}
+
+func apiKeyListCmd() *cobra.Command {
+	var f clientFlags
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "Print the id, subject, tenant, roles and expiration of the live keys",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				res, err := client.ListAPIKeys(ctx, &api.ListAPIKeysRequest{
+					Consistency: api.Consistency_LINEARIZABLE,
+				})
+				if err != nil {
+					return err
+				}
+				for _, k := range res.Keys {
+					expireAt := "never"
+					if k.ExpireAt > 0 {
+						expireAt = time.UnixMilli(k.ExpireAt).Format(time.RFC3339)
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\t%s\t%s\t%s\n", k.Id, k.Subject, k.Tenant, strings.Join(k.Roles, ","), expireAt)
+				}
+				return nil
+			})
+		},
+	}
+	f.register(cmd)
+
+	return cmd
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/dunielm02/memdist/internal/server"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+type clientFlags struct {
+	addr     string
+	caFile   string
+	certFile string
+	keyFile  string
+	tenant   string
+	token    string
+	timeout  time.Duration
+}
+
+func (f *clientFlags) register(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&f.addr, "addr", "127.0.0.1:8400", "Address of the memdist node.")
+	flags.StringVar(&f.caFile, "ca-file", config.CAFile, "Path to the certificate authority.")
+	flags.StringVar(&f.certFile, "cert-file", config.RootCertFile, "Path to the client tls cert.")
+	flags.StringVar(&f.keyFile, "key-file", config.RootKeyFile, "Path to the client tls key.")
+	flags.StringVar(&f.tenant, "tenant", "", "Tenant whose policies apply, empty uses the default one.")
+	flags.StringVar(&f.token, "token", "", "Bearer token, a JWT or an API key, sent instead of the client tls cert.")
+	flags.DurationVar(&f.timeout, "timeout", 10*time.Second, "Request timeout, zero disables it.")
+}
+
+// run dials the node over mTLS and hands the client to fn.
+func (f *clientFlags) run(fn func(ctx context.Context, client api.DatabaseClient) error) error {
+	return f.dial(func(ctx context.Context, conn *grpc.ClientConn) error {
+		return fn(ctx, api.NewDatabaseClient(conn))
+	})
+}
+
+// dial is run for the clients of the other services.
+func (f *clientFlags) dial(fn func(ctx context.Context, conn *grpc.ClientConn) error) error {
+	cfg := config.TLSConfig{CAFile: f.caFile}
+	if f.token == "" {
+		cfg.CertFile, cfg.KeyFile = f.certFile, f.keyFile
+	}
+	tlsConfig, err := config.GetTlsConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := grpc.NewClient(
+		f.addr,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	if f.tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, server.TenantKey, f.tenant)
+	}
+	if f.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+f.token)
+	}
+
+	return fn(ctx, conn)
+}
+
+func getCmd() *cobra.Command {
+	var f clientFlags
+	var consistency string
+	cmd := &cobra.Command{
+		Use:   "get KEY",
+		Short: "Print the value stored under KEY",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			level, ok := api.Consistency_value[strings.ToUpper(consistency)]
+			if !ok {
+				return fmt.Errorf("unknown consistency: %s", consistency)
+			}
+			return f.run(func(ctx context.Context, client api.DatabaseClient) error {
+				res, err := client.Get(ctx, &api.GetRequest{
+					Key:         args[0],
+					Consistency: api.Consistency(level),
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\n", res.Value)
+				return nil
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().StringVar(&consistency, "consistency", "stale", "Read consistency: stale, leader or linearizable.")
+
+	return cmd
+}
+
+func setCmd() *cobra.Command {
+	var f clientFlags
+	var ttl time.Duration
+	cmd := &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "Store VALUE under KEY",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return f.run(func(ctx context.Context, client api.DatabaseClient) error {
+				_, err := client.Set(ctx, &api.SetRequest{
+					Key:   args[0],
+					Value: []byte(args[1]),
+					Ttl:   ttl.Milliseconds(),
+				})
+				return err
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Time to live of the key, zero keeps it forever.")
+
+	return cmd
+}
+
+func deleteCmd() *cobra.Command {
+	var f clientFlags
+	cmd := &cobra.Command{
+		Use:     "del KEY",
+		Aliases: []string{"delete"},
+		Short:   "Delete KEY",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return f.run(func(ctx context.Context, client api.DatabaseClient) error {
+				_, err := client.Delete(ctx, &api.DeleteRequest{Key: args[0]})
+				return err
+			})
+		},
+	}
+	f.register(cmd)
+
+	return cmd
+}
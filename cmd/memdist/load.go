@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/spf13/cobra"
+)
+
+// loadRequestItems is the number of records sent by request, the server
+// regroups them in its own batches.
+const loadRequestItems = 100
+
+func loadCmd() *cobra.Command {
+	var f clientFlags
+	var format string
+	cmd := &cobra.Command{
+		Use:   "load FILE",
+		Short: "Store the key/value records of FILE, or of stdin when FILE is -",
+		Long: `Store the key/value records of FILE, or of stdin when FILE is -.
+
+The records are either newline delimited JSON objects:
+
+  {"key": "foo", "value": "bar", "ttl": "1m"}
+
+or CSV rows with the key, the value and an optional time to live:
+
+  foo,bar,1m
+
+The format is guessed from the extension of FILE unless --format is set.
+Big files may need a longer --timeout, zero disables it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := io.Reader(os.Stdin)
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+			if format == "" {
+				format = "ndjson"
+				if strings.EqualFold(filepath.Ext(args[0]), ".csv") {
+					format = "csv"
+				}
+			}
+
+			var next func() (*api.SetRequest, error)
+			switch format {
+			case "ndjson", "json":
+				next = ndjsonRecords(in)
+			case "csv":
+				next = csvRecords(in)
+			default:
+				return fmt.Errorf("unknown format: %s", format)
+			}
+
+			return f.run(func(ctx context.Context, client api.DatabaseClient) error {
+				res, err := load(ctx, client, next)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "loaded %d records at index %d\n", res.Count, res.Index)
+				return nil
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().StringVar(&format, "format", "", "Format of the records: ndjson or csv.")
+
+	return cmd
+}
+
+// load streams the records returned by next until it returns io.EOF.
+func load(ctx context.Context, client api.DatabaseClient, next func() (*api.SetRequest, error)) (*api.LoadResponse, error) {
+	// canceling the stream keeps the server from writing the records
+	// it didn't write yet
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &api.LoadRequest{}
+	for {
+		item, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		req.Items = append(req.Items, item)
+		if len(req.Items) < loadRequestItems {
+			continue
+		}
+		if err := stream.Send(req); err != nil {
+			// the server stopped the load, its status is returned by
+			// CloseAndRecv
+			break
+		}
+		req = &api.LoadRequest{}
+	}
+	if len(req.Items) > 0 {
+		// as above, a failure is reported by CloseAndRecv
+		_ = stream.Send(req)
+	}
+
+	return stream.CloseAndRecv()
+}
+
+type jsonRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// TTL is either a string or a number
+	TTL json.RawMessage `json:"ttl"`
+}
+
+func (r jsonRecord) ttl() (string, error) {
+	if len(r.TTL) == 0 || r.TTL[0] != '"' {
+		return string(r.TTL), nil
+	}
+	var ttl string
+	err := json.Unmarshal(r.TTL, &ttl)
+	return ttl, err
+}
+
+func ndjsonRecords(in io.Reader) func() (*api.SetRequest, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 8<<20)
+	line := 0
+	return func() (*api.SetRequest, error) {
+		for scanner.Scan() {
+			line++
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var record jsonRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			ttl, err := record.ttl()
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			item, err := setRequest(record.Key, record.Value, ttl)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			return item, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+func csvRecords(in io.Reader) func() (*api.SetRequest, error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	return func() (*api.SetRequest, error) {
+		fields, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		var ttl string
+		switch len(fields) {
+		case 2:
+		case 3:
+			ttl = fields[2]
+		default:
+			return nil, fmt.Errorf("line %d: expected 2 or 3 fields, got %d", line, len(fields))
+		}
+		item, err := setRequest(fields[0], fields[1], ttl)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		return item, nil
+	}
+}
+
+// setRequest builds the request of a record, ttl is either a duration or a
+// number of milliseconds and can be left empty.
+func setRequest(key, value, ttl string) (*api.SetRequest, error) {
+	if key == "" {
+		return nil, errors.New("the key is empty")
+	}
+	item := &api.SetRequest{Key: key, Value: []byte(value)}
+	if ttl == "" {
+		return item, nil
+	}
+	if ms, err := strconv.ParseInt(ttl, 10, 64); err == nil {
+		item.Ttl = ms
+		return item, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ttl %q", ttl)
+	}
+	item.Ttl = d.Milliseconds()
+
+	return item, nil
+}
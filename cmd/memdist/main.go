@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/status"
+)
+
+func main() {
+	cmd := &cobra.Command{
+		Use:           "memdist",
+		Short:         "A distributed in-memory key-value store",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.AddCommand(
+		serveCmd(),
+		getCmd(),
+		setCmd(),
+		deleteCmd(),
+		loadCmd(),
+		policyCmd(),
+		roleCmd(),
+		apiKeyCmd(),
+	)
+
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode maps gRPC status codes to the process exit code so scripts can
+// tell errors apart, e.g. NotFound exits with 5 and PermissionDenied with 7.
+// Errors that don't carry a status exit with 1.
+func exitCode(err error) int {
+	st, ok := status.FromError(err)
+	if !ok {
+		return 1
+	}
+	return int(st.Code())
+}
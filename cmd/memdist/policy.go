@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+func policyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Manage the access policies replicated through the cluster",
+	}
+	cmd.AddCommand(
+		policyAddCmd(),
+		policyRemoveCmd(),
+		policyListCmd(),
+	)
+
+	return cmd
+}
+
+func roleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "role",
+		Short: "Manage the role assignments replicated through the cluster",
+	}
+	cmd.AddCommand(
+		roleAddCmd(),
+		roleRemoveCmd(),
+		roleListCmd(),
+	)
+
+	return cmd
+}
+
+// runAdmin dials the node and hands the admin client to fn.
+func runAdmin(f *clientFlags, fn func(ctx context.Context, client api.AdminClient) error) error {
+	return f.dial(func(ctx context.Context, conn *grpc.ClientConn) error {
+		return fn(ctx, api.NewAdminClient(conn))
+	})
+}
+
+func policyAddCmd() *cobra.Command {
+	var f clientFlags
+	var domain string
+	cmd := &cobra.Command{
+		Use:   "add SUBJECT OBJECT ACTION",
+		Short: "Allow SUBJECT to run ACTION on the keys matched by OBJECT",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				_, err := client.AddPolicy(ctx, &api.AddPolicyRequest{
+					Policy: &api.Policy{Subject: args[0], Object: args[1], Action: args[2], Domain: domain},
+				})
+				return err
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().StringVar(&domain, "domain", "", "Tenants the policy applies to, empty applies to every tenant.")
+
+	return cmd
+}
+
+func policyRemoveCmd() *cobra.Command {
+	var f clientFlags
+	var domain string
+	cmd := &cobra.Command{
+		Use:     "remove SUBJECT OBJECT ACTION",
+		Aliases: []string{"rm"},
+		Short:   "Remove a policy added with policy add",
+		Args:    cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				_, err := client.RemovePolicy(ctx, &api.RemovePolicyRequest{
+					Policy: &api.Policy{Subject: args[0], Object: args[1], Action: args[2], Domain: domain},
+				})
+				return err
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().StringVar(&domain, "domain", "", "Domain the policy was added with.")
+
+	return cmd
+}
+
+func policyListCmd() *cobra.Command {
+	var f clientFlags
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "Print the replicated policies, the ones of the policy files aren't listed",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				res, err := client.ListPolicies(ctx, &api.ListPoliciesRequest{
+					Consistency: api.Consistency_LINEARIZABLE,
+				})
+				if err != nil {
+					return err
+				}
+				for _, p := range res.Policies {
+					fmt.Fprintf(cmd.OutOrStdout(), "p, %s, %s, %s, %s\n", p.Subject, orAny(p.Domain), p.Object, p.Action)
+				}
+				return nil
+			})
+		},
+	}
+	f.register(cmd)
+
+	return cmd
+}
+
+func roleAddCmd() *cobra.Command {
+	var f clientFlags
+	var domain string
+	cmd := &cobra.Command{
+		Use:   "add SUBJECT ROLE",
+		Short: "Give ROLE to SUBJECT",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				_, err := client.AddRole(ctx, &api.AddRoleRequest{
+					Role: &api.RoleAssignment{Subject: args[0], Role: args[1], Domain: domain},
+				})
+				return err
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().StringVar(&domain, "domain", "", "Tenants the role is given in, empty gives it in every tenant.")
+
+	return cmd
+}
+
+func roleRemoveCmd() *cobra.Command {
+	var f clientFlags
+	var domain string
+	cmd := &cobra.Command{
+		Use:     "remove SUBJECT ROLE",
+		Aliases: []string{"rm"},
+		Short:   "Remove a role given with role add",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				_, err := client.RemoveRole(ctx, &api.RemoveRoleRequest{
+					Role: &api.RoleAssignment{Subject: args[0], Role: args[1], Domain: domain},
+				})
+				return err
+			})
+		},
+	}
+	f.register(cmd)
+	cmd.Flags().StringVar(&domain, "domain", "", "Domain the role was given with.")
+
+	return cmd
+}
+
+func roleListCmd() *cobra.Command {
+	var f clientFlags
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "Print the replicated role assignments, the ones of the policy files aren't listed",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAdmin(&f, func(ctx context.Context, client api.AdminClient) error {
+				res, err := client.ListRoles(ctx, &api.ListRolesRequest{
+					Consistency: api.Consistency_LINEARIZABLE,
+				})
+				if err != nil {
+					return err
+				}
+				for _, r := range res.Roles {
+					fmt.Fprintf(cmd.OutOrStdout(), "g, %s, %s, %s\n", r.Subject, r.Role, orAny(r.Domain))
+				}
+				return nil
+			})
+		},
+	}
+	f.register(cmd)
+
+	return cmd
+}
+
+// orAny prints the empty domains the way the policy file writes them.
+func orAny(domain string) string {
+	if domain == "" {
+		return "*"
+	}
+	return domain
+}
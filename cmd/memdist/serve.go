@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/dunielm02/memdist/internal/agent"
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func serveCmd() *cobra.Command {
+	v := viper.New()
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a memdist node",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return loadConfig(v, cmd)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(agentConfig(v))
+		},
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "memdist"
+	}
+	dataDir := filepath.Join(os.TempDir(), "memdist")
+
+	flags := cmd.Flags()
+	flags.String("config-file", "", "Path to a config file.")
+	flags.String("node-name", hostname, "Unique server ID.")
+	flags.String("data-dir", dataDir, "Directory to store the raft log and snapshots.")
+	flags.String("bind-addr", "127.0.0.1:8401", "Address to bind serf on.")
+	flags.String("rpc-addr", "127.0.0.1:8400", "Address to bind raft and the gRPC server on.")
+	flags.StringSlice("start-join-addrs", nil, "Serf addresses to join.")
+	flags.Bool("bootstrap", false, "Bootstrap the cluster.")
+	flags.String("resp-addr", "", "Address to serve the Redis protocol on, disabled when empty.")
+	flags.String("http-addr", "", "Address to serve the HTTP gateway on, disabled when empty.")
+	flags.String("memcached-addr", "", "Address to serve the memcached protocol on, disabled when empty.")
+
+	flags.String("acl-model-file", config.ACLModelFile, "Path to the ACL model.")
+	flags.String("acl-policy-file", config.ACLPolicyFile, "Path to the ACL policies.")
+	flags.StringSlice("authenticators", []string{"mtls"}, "Authenticators tried in order: mtls, jwt and apikey.")
+	flags.String("jwks-file", "", "Path to the JWKS holding the keys of the JWTs.")
+	flags.String("jwt-issuer", "", "Issuer the JWTs must have, unchecked when empty.")
+	flags.String("jwt-audience", "", "Audience the JWTs must have, unchecked when empty.")
+
+	flags.String("audit-file", "", "Path to the audit log, disabled when empty.")
+	flags.Int64("audit-max-size", audit.DefaultMaxFileSize, "Size in bytes the audit log reaches before it is rotated.")
+	flags.Int("audit-max-backups", audit.DefaultMaxFileBackups, "Number of rotated audit logs kept.")
+	flags.Bool("audit-redact-values", false, "Leave the written values out of the audit log.")
+
+	flags.Int("max-key-size", db.DefaultMaxKeySize, "Maximum size of a key in bytes.")
+	flags.Int("max-value-size", db.DefaultMaxValueSize, "Maximum size of a value in bytes.")
+	flags.Int("max-batch-size", db.DefaultMaxBatchSize, "Maximum number of items of a batch.")
+
+	flags.String("server-tls-cert-file", "", "Path to the server tls cert.")
+	flags.String("server-tls-key-file", "", "Path to the server tls key.")
+	flags.String("server-tls-ca-file", "", "Path to the server certificate authority.")
+
+	flags.String("peer-tls-cert-file", "", "Path to the peer tls cert.")
+	flags.String("peer-tls-key-file", "", "Path to the peer tls key.")
+	flags.String("peer-tls-ca-file", "", "Path to the peer certificate authority.")
+
+	return cmd
+}
+
+// loadConfig merges, from the highest priority to the lowest, the command
+// line flags, the MEMDIST_* environment variables and the config file.
+func loadConfig(v *viper.Viper, cmd *cobra.Command) error {
+	if err := v.BindPFlags(cmd.Flags()); err != nil {
+		return err
+	}
+	v.SetEnvPrefix("memdist")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	if configFile := v.GetString("config-file"); configFile != "" {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func agentConfig(v *viper.Viper) agent.Config {
+	return agent.Config{
+		NodeName:       v.GetString("node-name"),
+		DataDir:        v.GetString("data-dir"),
+		BindAddr:       v.GetString("bind-addr"),
+		RPCAddr:        v.GetString("rpc-addr"),
+		StartJoinAddrs: v.GetStringSlice("start-join-addrs"),
+		Bootstrap:      v.GetBool("bootstrap"),
+		RESPAddr:       v.GetString("resp-addr"),
+		HTTPAddr:       v.GetString("http-addr"),
+		MemcachedAddr:  v.GetString("memcached-addr"),
+		ServerTLSConfig: config.TLSConfig{
+			CertFile: v.GetString("server-tls-cert-file"),
+			KeyFile:  v.GetString("server-tls-key-file"),
+			CAFile:   v.GetString("server-tls-ca-file"),
+			Server:   true,
+		},
+		PeerTLSConfig: config.TLSConfig{
+			CertFile: v.GetString("peer-tls-cert-file"),
+			KeyFile:  v.GetString("peer-tls-key-file"),
+			CAFile:   v.GetString("peer-tls-ca-file"),
+		},
+		ACLModelFile:      v.GetString("acl-model-file"),
+		ACLPolicyFile:     v.GetString("acl-policy-file"),
+		Authenticators:    v.GetStringSlice("authenticators"),
+		JWKSFile:          v.GetString("jwks-file"),
+		JWTIssuer:         v.GetString("jwt-issuer"),
+		JWTAudience:       v.GetString("jwt-audience"),
+		AuditFile:         v.GetString("audit-file"),
+		AuditMaxSize:      v.GetInt64("audit-max-size"),
+		AuditMaxBackups:   v.GetInt("audit-max-backups"),
+		AuditRedactValues: v.GetBool("audit-redact-values"),
+		MaxKeySize:        v.GetInt("max-key-size"),
+		MaxValueSize:      v.GetInt("max-value-size"),
+		MaxBatchSize:      v.GetInt("max-batch-size"),
+	}
+}
+
+func serve(cfg agent.Config) error {
+	a, err := agent.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	<-sigc
+
+	return a.Shutdown()
+}
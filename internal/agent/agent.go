@@ -0,0 +1,578 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/dunielm02/memdist/internal/discovery"
+	"github.com/dunielm02/memdist/internal/gateway"
+	"github.com/dunielm02/memdist/internal/memcache"
+	"github.com/dunielm02/memdist/internal/resp"
+	"github.com/dunielm02/memdist/internal/server"
+	"github.com/hashicorp/raft"
+	"github.com/soheilhy/cmux"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type Config struct {
+	NodeName string
+	DataDir  string
+	// BindAddr is the address serf listens on for membership gossip.
+	BindAddr string
+	// RPCAddr is the address both raft and the gRPC server listen on, it
+	// is advertised to the other members through the rpc_addr serf tag.
+	RPCAddr        string
+	StartJoinAddrs []string
+	Bootstrap      bool
+	// RESPAddr is the address of the Redis protocol listener, it is
+	// disabled when empty. It uses the ServerTLSConfig.
+	RESPAddr string
+	// HTTPAddr is the address of the HTTP gateway, it is disabled when
+	// empty. It uses the ServerTLSConfig.
+	HTTPAddr string
+	// MemcachedAddr is the address of the memcached protocol listener, it
+	// is disabled when empty. It uses the ServerTLSConfig.
+	MemcachedAddr string
+
+	// ServerTLSConfig secures the gRPC server and the incoming raft
+	// connections, PeerTLSConfig secures the outgoing raft connections.
+	// Leaving the files empty disables TLS.
+	ServerTLSConfig config.TLSConfig
+	PeerTLSConfig   config.TLSConfig
+
+	ACLModelFile  string
+	ACLPolicyFile string
+	// Authenticators are tried in order on the gRPC server and the HTTP
+	// gateway: mtls, jwt and apikey. Empty means mtls only. The RESP
+	// clients send the tokens with AUTH.
+	Authenticators []string
+	// JWKSFile holds the keys of the JWTs, JWTIssuer and JWTAudience are
+	// checked when set.
+	JWKSFile    string
+	JWTIssuer   string
+	JWTAudience string
+
+	// AuditFile is the JSON lines file of the audit log of the listeners,
+	// it is disabled when empty. It is rotated once it reaches AuditMaxSize
+	// bytes, AuditMaxBackups rotated files are kept. AuditRedactValues
+	// leaves the written values out.
+	AuditFile         string
+	AuditMaxSize      int64
+	AuditMaxBackups   int
+	AuditRedactValues bool
+
+	// MaxKeySize and MaxValueSize limit the size of the stored entries,
+	// zero values use the database defaults.
+	MaxKeySize   int
+	MaxValueSize int
+	// MaxBatchSize limits the number of items of the batch requests.
+	MaxBatchSize int
+}
+
+func (c Config) dbOptions() db.Options {
+	return db.Options{
+		MaxKeySize:   c.MaxKeySize,
+		MaxValueSize: c.MaxValueSize,
+		MaxBatchSize: c.MaxBatchSize,
+	}
+}
+
+const (
+	defaultMaxMsgSize = 4 << 20
+	maxMsgOverhead    = 1 << 10
+
+	gatewayReadHeaderTimeout = 10 * time.Second
+)
+
+type Agent struct {
+	Config
+
+	// ln is the listener shared through mux, closing the mux leaves it
+	// open.
+	ln         net.Listener
+	mux        cmux.CMux
+	db         *db.DistributedDB
+	authorizer *auth.Authorizer
+	authn      auth.Authenticator
+	audit      *audit.Logger
+	server     *grpc.Server
+	forwarder  *server.Forwarder
+	resp       *resp.Server
+	gateway    *http.Server
+	memcache   *memcache.Server
+	membership *discovery.Membership
+
+	shutdown     bool
+	shutdownLock sync.Mutex
+}
+
+func New(cfg Config) (*Agent, error) {
+	a := &Agent{
+		Config: cfg,
+	}
+
+	setup := []func() error{
+		a.setupLogger,
+		a.setupMux,
+		a.setupAuthorizer,
+		a.setupDB,
+		a.setupAuthenticator,
+		a.setupAudit,
+		a.setupServer,
+		a.setupRESP,
+		a.setupGateway,
+		a.setupMemcache,
+		a.setupMembership,
+	}
+	for _, fn := range setup {
+		if err := fn(); err != nil {
+			// stop what the previous steps started
+			return nil, errors.Join(err, a.Shutdown())
+		}
+	}
+	go a.serve()
+
+	return a, nil
+}
+
+func (a *Agent) setupLogger() error {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return err
+	}
+	zap.ReplaceGlobals(logger)
+	return nil
+}
+
+// setupMux opens the single listener shared by raft and gRPC, raft
+// connections are told apart by their first byte.
+func (a *Agent) setupMux() error {
+	ln, err := net.Listen("tcp", a.RPCAddr)
+	if err != nil {
+		return err
+	}
+	a.ln, a.mux = ln, cmux.New(ln)
+
+	return nil
+}
+
+// setupAuthorizer loads the policy file, it runs before setupDB so the
+// database can hand the replicated policies to the authorizer.
+func (a *Agent) setupAuthorizer() error {
+	var err error
+	a.authorizer, err = auth.New(a.ACLModelFile, a.ACLPolicyFile)
+	return err
+}
+
+// setupAuthenticator chains the configured authenticators, the API keys
+// are read from the database.
+func (a *Agent) setupAuthenticator() error {
+	names := a.Authenticators
+	if len(names) == 0 {
+		names = []string{"mtls"}
+	}
+
+	var chain auth.Chain
+	for _, name := range names {
+		switch name {
+		case "mtls":
+			chain = append(chain, auth.MTLS{})
+		case "jwt":
+			jwt, err := auth.NewJWT(auth.JWTConfig{
+				JWKSFile: a.JWKSFile,
+				Issuer:   a.JWTIssuer,
+				Audience: a.JWTAudience,
+			})
+			if err != nil {
+				return err
+			}
+			chain = append(chain, jwt)
+		case "apikey":
+			chain = append(chain, auth.APIKeys{Store: a.db})
+		default:
+			return fmt.Errorf("unknown authenticator: %s", name)
+		}
+	}
+	a.authn = chain
+
+	return nil
+}
+
+// setupAudit opens the audit log when AuditFile is set.
+func (a *Agent) setupAudit() error {
+	if a.AuditFile == "" {
+		return nil
+	}
+	file, err := audit.NewFile(audit.FileConfig{
+		Path:       a.AuditFile,
+		MaxSize:    a.AuditMaxSize,
+		MaxBackups: a.AuditMaxBackups,
+	})
+	if err != nil {
+		return err
+	}
+	a.audit = audit.New(audit.Config{
+		Sink:         file,
+		RedactValues: a.AuditRedactValues,
+	})
+
+	return nil
+}
+
+func (a *Agent) setupDB() error {
+	ln := a.mux.Match(func(reader io.Reader) bool {
+		b := make([]byte, 1)
+		if _, err := reader.Read(b); err != nil {
+			return false
+		}
+		return b[0] == db.RaftRPC
+	})
+
+	serverTLSConfig, err := tlsConfig(a.ServerTLSConfig)
+	if err != nil {
+		return err
+	}
+	peerTLSConfig, err := tlsConfig(a.PeerTLSConfig)
+	if err != nil {
+		return err
+	}
+
+	opts := a.dbOptions()
+	opts.OnPolicies = a.authorizer.SetPolicies
+	cfg := db.Config{
+		StreamLayer: db.NewStreamLayer(ln, serverTLSConfig, peerTLSConfig),
+		Bootstrap:   a.Bootstrap,
+		DB:          opts,
+	}
+	cfg.LocalID = raft.ServerID(a.NodeName)
+
+	a.db, err = db.NewDistributedDB(a.DataDir, cfg)
+	if err != nil {
+		return err
+	}
+	if a.Bootstrap {
+		return a.db.WaitForLeader(3 * time.Second)
+	}
+
+	return nil
+}
+
+func (a *Agent) setupServer() error {
+	// leave room for the largest entry on top of the rest of the message
+	limits := a.dbOptions().WithDefaults()
+	maxMsgSize := max(
+		limits.MaxKeySize+limits.MaxValueSize+maxMsgOverhead,
+		defaultMaxMsgSize,
+	)
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(maxMsgSize),
+		grpc.MaxSendMsgSize(maxMsgSize),
+	}
+	serverTLSConfig, err := a.serverTLSConfig(true)
+	if err != nil {
+		return err
+	}
+	if serverTLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(serverTLSConfig)))
+	}
+
+	// the followers forward the writes to the leader with the peer
+	// credentials, the ones received by the other listeners too
+	forwardCreds := insecure.NewCredentials()
+	peerTLSConfig, err := tlsConfig(a.PeerTLSConfig)
+	if err != nil {
+		return err
+	}
+	if peerTLSConfig != nil {
+		forwardCreds = credentials.NewTLS(peerTLSConfig)
+	}
+	forwardOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(forwardCreds),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(maxMsgSize),
+			grpc.MaxCallSendMsgSize(maxMsgSize),
+		),
+	}
+	a.forwarder = server.NewForwarder(a.db, forwardOpts...)
+
+	a.server, err = server.New(server.Config{
+		Data:               a.db,
+		Authorizer:         a.authorizer,
+		Limits:             limits,
+		Cluster:            a.db,
+		ForwardDialOptions: forwardOpts,
+		Policies:           a.db,
+		Authenticator:      a.authn,
+		Audit:              a.audit,
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	ln := a.mux.Match(cmux.Any())
+	go func() {
+		if err := a.server.Serve(ln); err != nil {
+			_ = a.Shutdown()
+		}
+	}()
+
+	return nil
+}
+
+// setupRESP starts the Redis protocol listener when RESPAddr is set, the
+// clients authenticate with the certificates of the gRPC server. When a
+// token authenticator is configured, AUTH takes a token as its password
+// and ignores the username. The followers forward the writes to the
+// leader.
+func (a *Agent) setupRESP() error {
+	if a.RESPAddr == "" {
+		return nil
+	}
+	ln, err := a.listen(a.RESPAddr, true)
+	if err != nil {
+		return err
+	}
+
+	cfg := resp.Config{
+		Data:       a.db,
+		Authorizer: a.authorizer,
+		Audit:      a.audit,
+		Forwarder:  a.forwarder,
+		Limits:     a.dbOptions(),
+	}
+	if a.tokenAuth() {
+		cfg.Authenticate = func(_, password string) (auth.Subject, error) {
+			return a.authn.Authenticate(context.Background(), auth.Credentials{Token: password})
+		}
+	}
+	a.resp = resp.New(cfg)
+	go func() {
+		if err := a.resp.Serve(ln); err != resp.ErrServerClosed {
+			_ = a.Shutdown()
+		}
+	}()
+
+	return nil
+}
+
+// setupGateway starts the HTTP gateway when HTTPAddr is set, the clients
+// authenticate with the certificates of the gRPC server. The followers
+// forward the writes to the leader.
+func (a *Agent) setupGateway() error {
+	if a.HTTPAddr == "" {
+		return nil
+	}
+	ln, err := a.listen(a.HTTPAddr, true)
+	if err != nil {
+		return err
+	}
+
+	a.gateway = &http.Server{
+		Handler: gateway.New(gateway.Config{
+			Data:          a.db,
+			Authorizer:    a.authorizer,
+			Forwarder:     a.forwarder,
+			Limits:        a.dbOptions(),
+			Authenticator: a.authn,
+			Audit:         a.audit,
+		}),
+		ReadHeaderTimeout: gatewayReadHeaderTimeout,
+	}
+	go func() {
+		if err := a.gateway.Serve(ln); err != http.ErrServerClosed {
+			_ = a.Shutdown()
+		}
+	}()
+
+	return nil
+}
+
+// setupMemcache starts the memcached protocol listener when MemcachedAddr
+// is set, the clients authenticate with the certificates of the gRPC server.
+// The followers forward the writes to the leader.
+func (a *Agent) setupMemcache() error {
+	if a.MemcachedAddr == "" {
+		return nil
+	}
+	ln, err := a.listen(a.MemcachedAddr, false)
+	if err != nil {
+		return err
+	}
+
+	a.memcache = memcache.New(memcache.Config{
+		Data:       a.db,
+		Authorizer: a.authorizer,
+		Audit:      a.audit,
+		Forwarder:  a.forwarder,
+		Limits:     a.dbOptions(),
+	})
+	go func() {
+		if err := a.memcache.Serve(ln); err != memcache.ErrServerClosed {
+			_ = a.Shutdown()
+		}
+	}()
+
+	return nil
+}
+
+// listen returns a listener on addr for the protocols served outside of the
+// mux, wrapped in TLS when the ServerTLSConfig is set.
+func (a *Agent) listen(addr string, tokens bool) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	serverTLSConfig, err := a.serverTLSConfig(tokens)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if serverTLSConfig != nil {
+		ln = tls.NewListener(ln, serverTLSConfig)
+	}
+	return ln, nil
+}
+
+func (a *Agent) setupMembership() error {
+	var err error
+	a.membership, err = discovery.New(discovery.Config{
+		NodeName:  a.NodeName,
+		BindAddrs: a.BindAddr,
+		Tags: map[string]string{
+			"rpc_addr": a.RPCAddr,
+		},
+		StartJoinAddrs: a.StartJoinAddrs,
+	}, a.db)
+
+	return err
+}
+
+func (a *Agent) serve() {
+	if err := a.mux.Serve(); err != nil {
+		_ = a.Shutdown()
+	}
+}
+
+// Shutdown leaves the cluster, stops serving requests and closes the
+// database, in that order. It is safe to call it more than once.
+func (a *Agent) Shutdown() error {
+	a.shutdownLock.Lock()
+	defer a.shutdownLock.Unlock()
+	if a.shutdown {
+		return nil
+	}
+	a.shutdown = true
+
+	// the steps skip the parts that a failed New didn't start
+	shutdown := []func() error{
+		func() error {
+			if a.membership == nil {
+				return nil
+			}
+			return errors.Join(a.membership.Leave(), a.membership.Shutdown())
+		},
+		func() error {
+			if a.server != nil {
+				a.server.GracefulStop()
+			}
+			return nil
+		},
+		func() error {
+			if a.resp == nil {
+				return nil
+			}
+			return a.resp.Close()
+		},
+		func() error {
+			if a.gateway == nil {
+				return nil
+			}
+			// the watches never end on their own, so the connections
+			// are closed without waiting for them
+			return a.gateway.Close()
+		},
+		func() error {
+			if a.memcache == nil {
+				return nil
+			}
+			return a.memcache.Close()
+		},
+		func() error {
+			if a.forwarder == nil {
+				return nil
+			}
+			return a.forwarder.Close()
+		},
+		func() error {
+			if a.db == nil {
+				return nil
+			}
+			return a.db.Close()
+		},
+		// the servers are stopped, no record is written anymore
+		a.audit.Close,
+		func() error {
+			if a.mux == nil {
+				return nil
+			}
+			a.mux.Close()
+			// raft or the gRPC server usually closed it already
+			if err := a.ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	// every step runs, a failure doesn't keep the rest open
+	var errs []error
+	for _, fn := range shutdown {
+		errs = append(errs, fn())
+	}
+
+	return errors.Join(errs...)
+}
+
+// serverTLSConfig returns the config of the client listeners. The ones that
+// accept tokens, when a token authenticator is configured, let the clients
+// connect without a certificate.
+func (a *Agent) serverTLSConfig(tokens bool) (*tls.Config, error) {
+	cfg, err := tlsConfig(a.ServerTLSConfig)
+	if err != nil || cfg == nil || !tokens {
+		return cfg, err
+	}
+	if a.tokenAuth() {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// tokenAuth reports whether a token authenticator is configured.
+func (a *Agent) tokenAuth() bool {
+	for _, name := range a.Authenticators {
+		if name == "jwt" || name == "apikey" {
+			return true
+		}
+	}
+	return false
+}
+
+func tlsConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" && cfg.KeyFile == "" && cfg.CAFile == "" {
+		return nil, nil
+	}
+	return config.GetTlsConfig(cfg)
+}
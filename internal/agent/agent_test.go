@@ -0,0 +1,362 @@
+package agent_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/agent"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/go-dynaport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func TestAgent(t *testing.T) {
+	nodeCount := 3
+	agents := setupAgents(t, nodeCount)
+	defer func() {
+		for _, a := range agents {
+			require.NoError(t, a.Shutdown())
+		}
+	}()
+
+	// wait for the followers to join the cluster
+	time.Sleep(3 * time.Second)
+
+	leader := client(t, agents[0])
+	_, err := leader.Set(context.Background(), &api.SetRequest{
+		Key:   "foo",
+		Value: []byte("bar"),
+	})
+	require.NoError(t, err)
+
+	res, err := leader.Get(context.Background(), &api.GetRequest{Key: "foo"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("bar"), res.Value)
+
+	// wait for the followers to replicate the write
+	time.Sleep(3 * time.Second)
+
+	for _, a := range agents[1:] {
+		res, err := client(t, a).Get(context.Background(), &api.GetRequest{Key: "foo"})
+		require.NoError(t, err)
+		require.Equal(t, []byte("bar"), res.Value)
+	}
+
+	// the followers forward the writes to the leader
+	follower := client(t, agents[1])
+	setRes, err := follower.Set(context.Background(), &api.SetRequest{
+		Key:   "john",
+		Value: []byte("doe"),
+	})
+	require.NoError(t, err)
+	require.True(t, setRes.Forwarded)
+
+	res, err = leader.Get(context.Background(), &api.GetRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("doe"), res.Value)
+
+	// consistent reads on a follower are served by the leader
+	for _, consistency := range []api.Consistency{
+		api.Consistency_LEADER,
+		api.Consistency_LINEARIZABLE,
+	} {
+		res, err = client(t, agents[2]).Get(context.Background(), &api.GetRequest{
+			Key:         "john",
+			Consistency: consistency,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []byte("doe"), res.Value)
+	}
+
+	// so are the consistent scans
+	stream, err := client(t, agents[2]).Scan(context.Background(), &api.ScanRequest{
+		Consistency: api.Consistency_LINEARIZABLE,
+	})
+	require.NoError(t, err)
+	var keys []string
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		keys = append(keys, res.Record.Key)
+	}
+	require.Equal(t, []string{"foo", "john"}, keys)
+
+	delRes, err := follower.Delete(context.Background(), &api.DeleteRequest{Key: "john"})
+	require.NoError(t, err)
+	require.True(t, delRes.Forwarded)
+
+	_, err = leader.Get(context.Background(), &api.GetRequest{Key: "john"})
+	require.Error(t, err)
+
+	// the leader still authorizes the original caller
+	_, err = nobodyClient(t, agents[2]).Set(context.Background(), &api.SetRequest{
+		Key:   "john",
+		Value: []byte("doe"),
+	})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the followers forward the writes of the other protocols too
+	require.Equal(t, "+OK", respClient(t, agents[1], config.RootCertFile, config.RootKeyFile)("SET", "resp", "yes"))
+	res, err = leader.Get(context.Background(), &api.GetRequest{Key: "resp"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("yes"), res.Value)
+
+	memcached := dial(t, agents[1].MemcachedAddr, config.RootCertFile, config.RootKeyFile)
+	_, err = memcached.Write([]byte("set memcache 0 0 3\r\nyes\r\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(memcached).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "STORED\r\n", line)
+	res, err = leader.Get(context.Background(), &api.GetRequest{Key: "memcache"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("yes"), res.Value)
+
+	tlsConfig, err := config.GetTlsConfig(config.TLSConfig{
+		CertFile: config.RootCertFile,
+		KeyFile:  config.RootKeyFile,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	defer transport.CloseIdleConnections()
+	req, err := http.NewRequest(http.MethodPut, "https://"+agents[1].HTTPAddr+"/v1/keys/http", strings.NewReader("yes"))
+	require.NoError(t, err)
+	httpRes, err := (&http.Client{Transport: transport}).Do(req)
+	require.NoError(t, err)
+	httpRes.Body.Close()
+	require.Equal(t, http.StatusOK, httpRes.StatusCode)
+	res, err = leader.Get(context.Background(), &api.GetRequest{Key: "http"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("yes"), res.Value)
+
+	// the policies added through any node are enforced by every node
+	admin := api.NewAdminClient(newConn(t, agents[1], config.RootCertFile, config.RootKeyFile))
+	addRes, err := admin.AddPolicy(context.Background(), &api.AddPolicyRequest{
+		Policy: &api.Policy{Subject: "nobody", Object: "foo", Action: "get"},
+	})
+	require.NoError(t, err)
+	require.True(t, addRes.Forwarded)
+	for _, a := range agents {
+		require.Eventually(t, func() bool {
+			_, err := nobodyClient(t, a).Get(context.Background(), &api.GetRequest{Key: "foo"})
+			return err == nil
+		}, 3*time.Second, 50*time.Millisecond)
+	}
+
+	// the roles of the certificate travel with the forwarded requests
+	_, err = admin.AddPolicy(context.Background(), &api.AddPolicyRequest{
+		Policy: &api.Policy{Subject: "Distributed Services", Object: "foo", Action: "set"},
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		setRes, err = nobodyClient(t, agents[2]).Set(context.Background(), &api.SetRequest{
+			Key:   "foo",
+			Value: []byte("baz"),
+		})
+		return err == nil && setRes.Forwarded
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestAgentSetupFailure(t *testing.T) {
+	ports := dynaport.Get(2)
+	cfg := agent.Config{
+		NodeName:       "0",
+		DataDir:        t.TempDir(),
+		BindAddr:       fmt.Sprintf("127.0.0.1:%d", ports[0]),
+		RPCAddr:        fmt.Sprintf("127.0.0.1:%d", ports[1]),
+		Bootstrap:      true,
+		ACLModelFile:   config.ACLModelFile,
+		ACLPolicyFile:  config.ACLPolicyFile,
+		Authenticators: []string{"unknown"},
+	}
+	_, err := agent.New(cfg)
+	require.ErrorContains(t, err, "unknown authenticator")
+
+	// the listener and the stores of the database were released
+	cfg.Authenticators = nil
+	a, err := agent.New(cfg)
+	require.NoError(t, err)
+	require.NoError(t, a.Shutdown())
+}
+
+func setupAgents(t *testing.T, nodeCount int) []*agent.Agent {
+	t.Helper()
+
+	var agents []*agent.Agent
+	for i := range nodeCount {
+		ports := dynaport.Get(5)
+		bindAddr := fmt.Sprintf("127.0.0.1:%d", ports[0])
+
+		var startJoinAddrs []string
+		if i != 0 {
+			startJoinAddrs = []string{agents[0].BindAddr}
+		}
+
+		a, err := agent.New(agent.Config{
+			NodeName:       fmt.Sprintf("%d", i),
+			DataDir:        t.TempDir(),
+			BindAddr:       bindAddr,
+			RPCAddr:        fmt.Sprintf("127.0.0.1:%d", ports[1]),
+			RESPAddr:       fmt.Sprintf("127.0.0.1:%d", ports[2]),
+			MemcachedAddr:  fmt.Sprintf("127.0.0.1:%d", ports[3]),
+			HTTPAddr:       fmt.Sprintf("127.0.0.1:%d", ports[4]),
+			StartJoinAddrs: startJoinAddrs,
+			Bootstrap:      i == 0,
+			ServerTLSConfig: config.TLSConfig{
+				CertFile: config.ServerCertFile,
+				KeyFile:  config.ServerKeyFile,
+				CAFile:   config.CAFile,
+				Server:   true,
+			},
+			PeerTLSConfig: config.TLSConfig{
+				CertFile: config.ServerCertFile,
+				KeyFile:  config.ServerKeyFile,
+				CAFile:   config.CAFile,
+			},
+			ACLModelFile:  config.ACLModelFile,
+			ACLPolicyFile: config.ACLPolicyFile,
+		})
+		require.NoError(t, err)
+
+		agents = append(agents, a)
+	}
+
+	return agents
+}
+
+// respClient connects to the RESP listener of a, with a client certificate
+// unless cert is empty, and returns a function sending a command and
+// returning the first line of its reply.
+func respClient(t *testing.T, a *agent.Agent, cert, key string) func(args ...string) string {
+	t.Helper()
+
+	conn := dial(t, a.RESPAddr, cert, key)
+	r := bufio.NewReader(conn)
+
+	return func(args ...string) string {
+		t.Helper()
+		cmd := fmt.Sprintf("*%d\r\n", len(args))
+		for _, arg := range args {
+			cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+		}
+		_, err := conn.Write([]byte(cmd))
+		require.NoError(t, err)
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		return strings.TrimSuffix(line, "\r\n")
+	}
+}
+
+// dial opens a TLS connection to addr, with a client certificate unless
+// cert is empty.
+func dial(t *testing.T, addr, cert, key string) net.Conn {
+	t.Helper()
+
+	tlsConfig, err := config.GetTlsConfig(config.TLSConfig{
+		CertFile: cert,
+		KeyFile:  key,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func client(t *testing.T, a *agent.Agent) api.DatabaseClient {
+	t.Helper()
+	return newClient(t, a, config.RootCertFile, config.RootKeyFile)
+}
+
+func nobodyClient(t *testing.T, a *agent.Agent) api.DatabaseClient {
+	t.Helper()
+	return newClient(t, a, config.NobodyCertFile, config.NobodyKeyFile)
+}
+
+func newClient(t *testing.T, a *agent.Agent, cert, key string) api.DatabaseClient {
+	t.Helper()
+	return api.NewDatabaseClient(newConn(t, a, cert, key))
+}
+
+func newConn(t *testing.T, a *agent.Agent, cert, key string) *grpc.ClientConn {
+	t.Helper()
+
+	tlsConfig, err := config.GetTlsConfig(config.TLSConfig{
+		CertFile: cert,
+		KeyFile:  key,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+
+	conn, err := grpc.NewClient(
+		a.RPCAddr,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestAgentRESPLogin(t *testing.T) {
+	ports := dynaport.Get(3)
+	a, err := agent.New(agent.Config{
+		NodeName:  "0",
+		DataDir:   t.TempDir(),
+		BindAddr:  fmt.Sprintf("127.0.0.1:%d", ports[0]),
+		RPCAddr:   fmt.Sprintf("127.0.0.1:%d", ports[1]),
+		RESPAddr:  fmt.Sprintf("127.0.0.1:%d", ports[2]),
+		Bootstrap: true,
+		ServerTLSConfig: config.TLSConfig{
+			CertFile: config.ServerCertFile,
+			KeyFile:  config.ServerKeyFile,
+			CAFile:   config.CAFile,
+			Server:   true,
+		},
+		PeerTLSConfig: config.TLSConfig{
+			CertFile: config.ServerCertFile,
+			KeyFile:  config.ServerKeyFile,
+			CAFile:   config.CAFile,
+		},
+		ACLModelFile:   config.ACLModelFile,
+		ACLPolicyFile:  config.ACLPolicyFile,
+		Authenticators: []string{"mtls", "apikey"},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, a.Shutdown())
+	}()
+
+	admin := api.NewAdminClient(newConn(t, a, config.RootCertFile, config.RootKeyFile))
+	var key *api.CreateAPIKeyResponse
+	require.Eventually(t, func() bool {
+		key, err = admin.CreateAPIKey(context.Background(), &api.CreateAPIKeyRequest{Subject: "root"})
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// the client has no certificate, the api key is its only credential
+	do := respClient(t, a, "", "")
+
+	require.True(t, strings.HasPrefix(do("SET", "foo", "bar"), "-"))
+	require.True(t, strings.HasPrefix(do("AUTH", "not-a-key"), "-WRONGPASS"))
+	require.Equal(t, "+OK", do("AUTH", key.Key))
+	require.Equal(t, "+OK", do("SET", "foo", "bar"))
+}
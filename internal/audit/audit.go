@@ -0,0 +1,105 @@
+// Package audit records who was allowed or denied each operation, with the
+// raft index of the writes, for the compliance reviews.
+package audit
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Decision is the outcome of the authorization of an operation.
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	Deny  Decision = "deny"
+)
+
+// Record is one line of the audit log.
+type Record struct {
+	Time     time.Time `json:"time"`
+	Subject  string    `json:"subject"`
+	Roles    []string  `json:"roles,omitempty"`
+	Tenant   string    `json:"tenant,omitempty"`
+	Action   string    `json:"action,omitempty"`
+	Key      string    `json:"key"`
+	Decision Decision  `json:"decision"`
+	// Peer is the address of the client, Method the gRPC method or the
+	// HTTP request line.
+	Peer   string `json:"peer,omitempty"`
+	Method string `json:"method,omitempty"`
+	// Index is the raft index of the allowed writes whose response carries
+	// it.
+	Index uint64 `json:"index,omitempty"`
+	// Value is the written value, it is left out and Redacted is set when
+	// the values are redacted.
+	Value    []byte `json:"value,omitempty"`
+	Redacted bool   `json:"redacted,omitempty"`
+	// Error is the error the operation failed with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Sink stores the records, Write is called by many goroutines at once.
+type Sink interface {
+	Write(Record) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(Record) error
+
+func (f SinkFunc) Write(r Record) error {
+	return f(r)
+}
+
+type Config struct {
+	Sink Sink
+	// RedactValues leaves the values out of the records.
+	RedactValues bool
+}
+
+// Logger hands the records to its sink. A nil Logger drops them, so the
+// callers don't check whether the audit is enabled.
+type Logger struct {
+	Config
+
+	// errOnce keeps a broken sink from flooding the logs.
+	errOnce sync.Once
+}
+
+func New(cfg Config) *Logger {
+	return &Logger{Config: cfg}
+}
+
+// Log stamps and redacts r before writing it. The requests don't fail when
+// the sink does, the first error is logged.
+func (l *Logger) Log(r Record) {
+	if l == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if l.RedactValues && r.Value != nil {
+		r.Value = nil
+		r.Redacted = true
+	}
+	if err := l.Sink.Write(r); err != nil {
+		l.errOnce.Do(func() {
+			zap.L().Error("error writing the audit log", zap.Error(err))
+		})
+	}
+}
+
+// Close closes the sink when it is an io.Closer.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	if c, ok := l.Sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogger(t *testing.T) {
+	var records []audit.Record
+	sink := audit.SinkFunc(func(r audit.Record) error {
+		records = append(records, r)
+		return nil
+	})
+
+	audit.New(audit.Config{Sink: sink}).Log(audit.Record{Key: "a", Value: []byte("secret")})
+	audit.New(audit.Config{Sink: sink, RedactValues: true}).Log(audit.Record{Key: "b", Value: []byte("secret")})
+	require.Len(t, records, 2)
+	require.Equal(t, []byte("secret"), records[0].Value)
+	require.False(t, records[0].Redacted)
+	require.Nil(t, records[1].Value)
+	require.True(t, records[1].Redacted)
+	require.False(t, records[1].Time.IsZero())
+
+	// the failures of the sink don't reach the callers
+	broken := audit.New(audit.Config{Sink: audit.SinkFunc(func(audit.Record) error {
+		return errors.New("disk full")
+	})})
+	broken.Log(audit.Record{Key: "c"})
+
+	// a nil logger drops the records
+	var disabled *audit.Logger
+	disabled.Log(audit.Record{Key: "d"})
+	require.NoError(t, disabled.Close())
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	file, err := audit.NewFile(audit.FileConfig{Path: path, MaxSize: 200, MaxBackups: 2})
+	require.NoError(t, err)
+
+	keys := []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7"}
+	for _, key := range keys {
+		require.NoError(t, file.Write(audit.Record{Subject: "root", Key: key, Decision: audit.Allow}))
+	}
+	require.NoError(t, file.Close())
+
+	// the oldest records were dropped with the files beyond MaxBackups
+	var read []string
+	for _, name := range []string{path + ".2", path + ".1", path} {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+		require.LessOrEqual(t, info.Size(), int64(200))
+		read = append(read, readKeys(t, name)...)
+	}
+	require.NoFileExists(t, path+".3")
+	require.Equal(t, keys[len(keys)-len(read):], read)
+
+	// a reopened file is appended to
+	file, err = audit.NewFile(audit.FileConfig{Path: path, MaxSize: 200, MaxBackups: 2})
+	require.NoError(t, err)
+	require.NoError(t, file.Write(audit.Record{Subject: "root", Key: "k8", Decision: audit.Deny}))
+	require.NoError(t, file.Close())
+	require.Error(t, file.Write(audit.Record{Key: "k9"}))
+
+	all := append(readKeys(t, path+".1"), readKeys(t, path)...)
+	require.Equal(t, "k8", all[len(all)-1])
+}
+
+func TestFileRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// a directory in the way of the backup makes the rename fail
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "x"), 0755))
+	file, err := audit.NewFile(audit.FileConfig{Path: path, MaxSize: 100, MaxBackups: 1})
+	require.NoError(t, err)
+	defer file.Close()
+
+	require.NoError(t, file.Write(audit.Record{Subject: "root", Key: "k0", Decision: audit.Allow}))
+	require.Error(t, file.Write(audit.Record{Subject: "root", Key: "k1", Decision: audit.Allow}))
+
+	// the records still reach the file, and the rotation is retried
+	require.NoError(t, os.RemoveAll(path+".1"))
+	require.NoError(t, file.Write(audit.Record{Subject: "root", Key: "k2", Decision: audit.Allow}))
+	require.Equal(t, []string{"k0", "k1"}, readKeys(t, path+".1"))
+	require.Equal(t, []string{"k2"}, readKeys(t, path))
+}
+
+func readKeys(t *testing.T, name string) []string {
+	t.Helper()
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r audit.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		keys = append(keys, r.Key)
+	}
+	require.NoError(t, scanner.Err())
+	return keys
+}
+
+type authorizer struct{}
+
+func (authorizer) Authorize(sub auth.Subject, obj string, act string) error {
+	if sub.Name != "root" {
+		return status.Error(codes.PermissionDenied, "denied")
+	}
+	return nil
+}
+
+func (authorizer) Roles(sub auth.Subject) []string {
+	return nil
+}
+
+func TestAuthorizer(t *testing.T) {
+	var records []audit.Record
+	logger := audit.New(audit.Config{Sink: audit.SinkFunc(func(r audit.Record) error {
+		records = append(records, r)
+		return nil
+	})})
+
+	a := logger.Authorizer(authorizer{}, "resp", "127.0.0.1:6379")
+	require.NoError(t, a.Authorize(auth.Subject{Name: "root", Tenant: "t"}, "foo", "get"))
+	require.Error(t, a.Authorize(auth.Subject{Name: "nobody"}, "bar", "set"))
+	require.Len(t, records, 2)
+	require.Equal(t, "root", records[0].Subject)
+	require.Equal(t, "t", records[0].Tenant)
+	require.Equal(t, "foo", records[0].Key)
+	require.Equal(t, audit.Allow, records[0].Decision)
+	require.Equal(t, "resp", records[0].Method)
+	require.Equal(t, "127.0.0.1:6379", records[0].Peer)
+	require.Equal(t, "nobody", records[1].Subject)
+	require.Equal(t, "set", records[1].Action)
+	require.Equal(t, audit.Deny, records[1].Decision)
+	require.Equal(t, "denied", records[1].Error)
+
+	// without a logger the decisions aren't wrapped
+	var disabled *audit.Logger
+	require.Equal(t, authorizer{}, disabled.Authorizer(authorizer{}, "resp", ""))
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"github.com/dunielm02/memdist/internal/auth"
+	"google.golang.org/grpc/status"
+)
+
+// Authorizer is the authorizer shared by the servers.
+type Authorizer interface {
+	Authorize(sub auth.Subject, obj string, act string) error
+	Roles(sub auth.Subject) []string
+}
+
+// Authorizer returns an authorizer that logs each decision of authorizer
+// under method for the client at peer, for the servers that don't audit
+// their requests themselves. The records have no raft index. A nil Logger
+// returns authorizer as is.
+func (l *Logger) Authorizer(authorizer Authorizer, method, peer string) Authorizer {
+	if l == nil {
+		return authorizer
+	}
+	return &audited{Authorizer: authorizer, logger: l, method: method, peer: peer}
+}
+
+type audited struct {
+	Authorizer
+	logger *Logger
+	method string
+	peer   string
+}
+
+func (a *audited) Authorize(sub auth.Subject, obj string, act string) error {
+	err := a.Authorizer.Authorize(sub, obj, act)
+	r := Record{
+		Subject:  sub.Name,
+		Roles:    sub.Roles,
+		Tenant:   sub.Tenant,
+		Action:   act,
+		Key:      obj,
+		Decision: Allow,
+		Peer:     a.peer,
+		Method:   a.method,
+	}
+	if err != nil {
+		r.Decision = Deny
+		r.Error = status.Convert(err).Message()
+	}
+	a.logger.Log(r)
+	return err
+}
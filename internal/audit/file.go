@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	DefaultMaxFileSize    = 100 << 20
+	DefaultMaxFileBackups = 10
+)
+
+type FileConfig struct {
+	Path string
+	// MaxSize is the size in bytes a file reaches before it is rotated,
+	// MaxBackups the number of rotated files kept. Zero values use the
+	// defaults.
+	MaxSize    int64
+	MaxBackups int
+}
+
+// File writes the records as JSON lines. Once the file reaches MaxSize it
+// is renamed Path.1, the older files are shifted to Path.2 and so on, and
+// a new file is started.
+type File struct {
+	FileConfig
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+var _ Sink = (*File)(nil)
+
+func NewFile(cfg FileConfig) (*File, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxFileSize
+	}
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = DefaultMaxFileBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, err
+	}
+
+	f := &File{FileConfig: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Write(r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	// a record larger than MaxSize still gets a file of its own. When the
+	// rotation fails the record goes to the current file, the next write
+	// tries again.
+	var rotateErr error
+	if f.size > 0 && f.size+int64(len(line)) > f.MaxSize {
+		rotateErr = f.rotate()
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return errors.Join(rotateErr, err)
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open appends to the current file, the caller must hold the lock.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate shifts the backups and starts a new file, the caller must hold
+// the lock. The current file is renamed while open and only closed once the
+// new one is, so a failure leaves it in use.
+func (f *File) rotate() error {
+	// the oldest backup is overwritten by the rename
+	for i := f.MaxBackups - 1; i > 0; i-- {
+		err := os.Rename(f.backup(i), f.backup(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.Path, f.backup(1)); err != nil {
+		return err
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+func (f *File) backup(i int) string {
+	return fmt.Sprintf("%s.%d", f.Path, i)
+}
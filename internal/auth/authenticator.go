@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNoCredentials is returned by the authenticators that don't find
+	// their kind of credentials, Chain tries the next one.
+	ErrNoCredentials = errors.New("auth: no credentials")
+
+	errUnauthenticated = status.Error(codes.Unauthenticated, "the request has no valid credentials")
+)
+
+// Credentials are what a request carries to identify its caller.
+type Credentials struct {
+	// Chains are the verified chains of the client certificate, empty when
+	// the caller didn't send one.
+	Chains [][]*x509.Certificate
+	// Token is the bearer token, a JWT or an API key.
+	Token string
+	// Tenant is the tenant picked by the caller.
+	Tenant string
+}
+
+// Authenticator returns the subject of the credentials. It fails with
+// ErrNoCredentials when they don't hold the kind it checks, and with an
+// Unauthenticated status when they are invalid.
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds Credentials) (Subject, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(ctx context.Context, creds Credentials) (Subject, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, creds Credentials) (Subject, error) {
+	return f(ctx, creds)
+}
+
+// Chain tries the authenticators in order and returns the result of the
+// first one that finds its credentials.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, creds Credentials) (Subject, error) {
+	for _, a := range c {
+		sub, err := a.Authenticate(ctx, creds)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return sub, err
+	}
+	return Subject{}, errUnauthenticated
+}
+
+// MTLS authenticates the callers with the common name of their verified
+// client certificate, see SubjectOf.
+type MTLS struct{}
+
+func (MTLS) Authenticate(ctx context.Context, creds Credentials) (Subject, error) {
+	if len(creds.Chains) == 0 || len(creds.Chains[0]) == 0 {
+		return Subject{}, ErrNoCredentials
+	}
+	return SubjectOf(creds.Chains[0][0], creds.Tenant), nil
+}
+
+// apiKeyPrefix starts the API keys, it tells them apart from the JWTs.
+const apiKeyPrefix = "mdk_"
+
+// APIKeyStore reads the API keys replicated through the cluster.
+type APIKeyStore interface {
+	GetAPIKey(id string) (*api.APIKey, error)
+}
+
+// APIKeys authenticates the bearer tokens created by NewAPIKey against the
+// hashes kept in Store.
+type APIKeys struct {
+	Store APIKeyStore
+}
+
+func (a APIKeys) Authenticate(ctx context.Context, creds Credentials) (Subject, error) {
+	id, secret, ok := parseAPIKey(creds.Token)
+	if !ok {
+		return Subject{}, ErrNoCredentials
+	}
+	key, err := a.Store.GetAPIKey(id)
+	if err != nil {
+		return Subject{}, errUnauthenticated
+	}
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], key.Hash) != 1 {
+		return Subject{}, errUnauthenticated
+	}
+	// the keys are bound to the tenant they were made in
+	tenant := creds.Tenant
+	if key.Tenant != "" {
+		if tenant != "" && tenant != key.Tenant {
+			return Subject{}, status.Error(codes.Unauthenticated, "the api key belongs to another tenant")
+		}
+		tenant = key.Tenant
+	}
+	return Subject{Name: key.Subject, Roles: key.Roles, Tenant: tenant}, nil
+}
+
+// NewAPIKey returns a random key for subject: its Id and Hash ready to be
+// stored, and the token handed to the client once.
+func NewAPIKey(subject string, roles []string) (*api.APIKey, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	key := &api.APIKey{
+		Id:      hex.EncodeToString(id),
+		Subject: subject,
+		Roles:   roles,
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	hash := sha256.Sum256([]byte(encoded))
+	key.Hash = hash[:]
+
+	return key, apiKeyPrefix + key.Id + "_" + encoded, nil
+}
+
+// parseAPIKey splits a token made by NewAPIKey, ok is false for the other
+// tokens.
+func parseAPIKey(token string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(token, apiKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, "_")
+}
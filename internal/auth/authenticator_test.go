@@ -0,0 +1,66 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type apiKeyStore map[string]*api.APIKey
+
+func (s apiKeyStore) GetAPIKey(id string) (*api.APIKey, error) {
+	key, ok := s[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "api key not found")
+	}
+	return key, nil
+}
+
+func TestAuthenticators(t *testing.T) {
+	ctx := context.Background()
+	key, token, err := auth.NewAPIKey("alice", []string{"readers"})
+	require.NoError(t, err)
+	store := apiKeyStore{key.Id: key}
+
+	chain := auth.Chain{auth.MTLS{}, auth.APIKeys{Store: store}}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "root"}}
+	sub, err := chain.Authenticate(ctx, auth.Credentials{
+		Chains: [][]*x509.Certificate{{cert}},
+		Token:  token,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "root", sub.Name)
+
+	sub, err = chain.Authenticate(ctx, auth.Credentials{Token: token, Tenant: "tenant-a"})
+	require.NoError(t, err)
+	require.Equal(t, auth.Subject{Name: "alice", Roles: []string{"readers"}, Tenant: "tenant-a"}, sub)
+
+	for _, creds := range []auth.Credentials{
+		{},
+		{Token: token + "x"},
+		{Token: "mdk_0000_secret"},
+		{Token: "not-a-key"},
+	} {
+		_, err = chain.Authenticate(ctx, creds)
+		require.Equal(t, codes.Unauthenticated, status.Code(err), creds.Token)
+	}
+
+	// a key bound to a tenant can't be used in another one
+	key.Tenant = "tenant-a"
+	sub, err = chain.Authenticate(ctx, auth.Credentials{Token: token})
+	require.NoError(t, err)
+	require.Equal(t, "tenant-a", sub.Tenant)
+	_, err = chain.Authenticate(ctx, auth.Credentials{Token: token, Tenant: "tenant-b"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = auth.APIKeys{Store: store}.Authenticate(ctx, auth.Credentials{Token: "a.b.c"})
+	require.ErrorIs(t, err, auth.ErrNoCredentials)
+}
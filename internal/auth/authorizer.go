@@ -2,44 +2,207 @@ package auth
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/casbin/casbin/v2"
-	"github.com/dunielm02/memdist/internal/config"
+	"github.com/casbin/casbin/v2/util"
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// anyDomain is the domain of the replicated rules that leave it empty.
+const anyDomain = "*"
+
 type Authorizer struct {
+	// mu keeps Authorize from seeing the enforcer while SetPolicies
+	// rebuilds it.
+	mu       sync.RWMutex
 	enforcer *casbin.Enforcer
+	// domains is false for the models written before the tenants, their
+	// requests are sub, obj, act.
+	domains bool
+	// base and baseRoles hold the rules of the policy file, they are kept
+	// when the replicated rules change.
+	base      [][]string
+	baseRoles [][]string
 }
 
-func New() (*Authorizer, error) {
-	e, err := casbin.NewEnforcer(config.ACLModelFile, config.ACLPolicyFile)
+func New(model, policy string) (*Authorizer, error) {
+	e, err := casbin.NewEnforcer(model, policy)
 	if err != nil {
 		return nil, err
 	}
-	return &Authorizer{
-		enforcer: e,
-	}, nil
+	// the replicated policies live in the database, not in the file
+	e.EnableAutoSave(false)
+
+	auth := &Authorizer{enforcer: e}
+	if r, ok := e.GetModel()["r"]["r"]; ok {
+		auth.domains = len(r.Tokens) == 4
+	}
+	if auth.domains {
+		// a role given in the * domain holds in every tenant
+		e.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+	}
+	if auth.base, err = e.GetPolicy(); err != nil {
+		return nil, err
+	}
+	if auth.baseRoles, err = e.GetGroupingPolicy(); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// Authorize checks obj against the policies of the file and the replicated
+// ones, for the name of the subject and then for each of its roles. The
+// keys reserved by the database are denied to everyone, they are only
+// reached through the admin actions on the wildcard.
+func (auth *Authorizer) Authorize(sub Subject, obj, act string) error {
+	if db.Reserved(obj) {
+		msg := fmt.Sprintf("the keys starting with %s are reserved", db.ReservedPrefix)
+		return status.Error(codes.PermissionDenied, msg)
+	}
+
+	auth.mu.RLock()
+	defer auth.mu.RUnlock()
+	for _, name := range append([]string{sub.Name}, sub.Roles...) {
+		if auth.enforce(name, sub.tenant(), obj, act) {
+			return nil
+		}
+	}
+
+	msg := fmt.Sprintf("%s not permitted to %s to %s", sub.Name, act, obj)
+	st := status.New(codes.PermissionDenied, msg)
+	return st.Err()
+}
+
+// Roles returns the roles sub holds in its tenant: the ones of its
+// credentials, the ones assigned to its name and the ones they inherit.
+func (auth *Authorizer) Roles(sub Subject) []string {
+	auth.mu.RLock()
+	defer auth.mu.RUnlock()
+
+	var roles []string
+	seen := map[string]bool{sub.Name: true}
+	add := func(role string) {
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	for _, role := range sub.Roles {
+		add(role)
+	}
+	for _, name := range append([]string{sub.Name}, sub.Roles...) {
+		var inherited []string
+		var err error
+		if auth.domains {
+			inherited, err = auth.enforcer.GetImplicitRolesForUser(name, sub.tenant())
+		} else {
+			inherited, err = auth.enforcer.GetImplicitRolesForUser(name)
+		}
+		if err != nil {
+			zap.L().Error("error reading the roles", zap.String("subject", name), zap.Error(err))
+		}
+		for _, role := range inherited {
+			add(role)
+		}
+	}
+	return roles
 }
 
-func (auth *Authorizer) Authorize(sub, obj, act string) error {
-	ok, err := auth.enforcer.Enforce(sub, obj, act)
+// enforce checks a single name, the caller must hold the lock.
+func (auth *Authorizer) enforce(name, tenant, obj, act string) bool {
+	var ok bool
+	var err error
+	if auth.domains {
+		ok, err = auth.enforcer.Enforce(name, tenant, obj, act)
+	} else {
+		ok, err = auth.enforcer.Enforce(name, obj, act)
+	}
 	if err != nil {
 		zap.L().Error(
 			"error checking authentication",
-			zap.String("subject", sub),
+			zap.String("subject", name),
+			zap.String("tenant", tenant),
 			zap.String("object", obj),
 			zap.String("action", act),
 		)
 	}
+	return ok
+}
+
+// SetPolicies replaces the replicated policies and role assignments, it is
+// given to the database as its OnPolicies hook.
+func (auth *Authorizer) SetPolicies(policies []*api.Policy, roles []*api.RoleAssignment) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.enforcer.ClearPolicy()
+	// a replicated rule may repeat one of the file, the enforcer skips the
+	// rules it already holds
+	for _, rule := range auth.base {
+		auth.enforcer.AddPolicy(rule)
+	}
+	for _, rule := range auth.baseRoles {
+		auth.enforcer.AddGroupingPolicy(rule)
+	}
 
-	if !ok {
-		msg := fmt.Sprintf("%s not permitted to %s to %s", sub, act, obj)
-		st := status.New(codes.PermissionDenied, msg)
-		return st.Err()
+	for _, p := range policies {
+		rule := []string{p.Subject, domain(p.Domain), p.Object, p.Action}
+		if !auth.domains {
+			if !auth.unscoped(rule, p.Domain) {
+				continue
+			}
+			rule = []string{p.Subject, p.Object, p.Action}
+		}
+		if _, err := auth.enforcer.AddPolicy(rule); err != nil {
+			auth.skip(rule, err)
+		}
 	}
+	for _, r := range roles {
+		rule := []string{r.Subject, r.Role, domain(r.Domain)}
+		if !auth.domains {
+			if !auth.unscoped(rule, r.Domain) {
+				continue
+			}
+			rule = rule[:2]
+		}
+		if _, err := auth.enforcer.AddGroupingPolicy(rule); err != nil {
+			auth.skip(rule, err)
+		}
+	}
+	// the role links are only added as the rules are, the links of the
+	// removed assignments are dropped by rebuilding them
+	if err := auth.enforcer.BuildRoleLinks(); err != nil {
+		zap.L().Error("error building the role links", zap.Error(err))
+	}
+}
 
-	return nil
+// unscoped reports whether a rule applies to every tenant, the models
+// without domains can't scope the other ones and skip them.
+func (auth *Authorizer) unscoped(rule []string, d string) bool {
+	if domain(d) == anyDomain {
+		return true
+	}
+	auth.skip(rule, fmt.Errorf("the model has no domains"))
+	return false
+}
+
+func (auth *Authorizer) skip(rule []string, err error) {
+	zap.L().Error(
+		"error adding a replicated rule",
+		zap.Strings("rule", rule),
+		zap.Error(err),
+	)
+}
+
+func domain(d string) string {
+	if d == "" {
+		return anyDomain
+	}
+	return d
 }
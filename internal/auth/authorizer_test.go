@@ -0,0 +1,114 @@
+package auth_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizerRoles(t *testing.T) {
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+
+	alice := auth.Subject{Name: "alice", Tenant: "tenant-a"}
+	requireDenied(t, authorizer.Authorize(alice, "reports/1", "get"))
+
+	authorizer.SetPolicies(
+		[]*api.Policy{
+			{Subject: "readers", Domain: "tenant-*", Object: "reports/*", Action: "get"},
+			{Subject: "writers", Object: "reports/*", Action: "set"},
+		},
+		[]*api.RoleAssignment{
+			{Subject: "alice", Role: "readers", Domain: "tenant-a"},
+			{Subject: "bob", Role: "writers"},
+		},
+	)
+
+	// the roles only hold in their domain
+	require.NoError(t, authorizer.Authorize(alice, "reports/1", "get"))
+	requireDenied(t, authorizer.Authorize(alice, "reports/1", "set"))
+	alice.Tenant = "tenant-b"
+	requireDenied(t, authorizer.Authorize(alice, "reports/1", "get"))
+
+	// the roles held in a tenant include the assigned ones
+	require.Equal(t, []string{"readers"}, authorizer.Roles(auth.Subject{Name: "alice", Tenant: "tenant-a"}))
+	require.Empty(t, authorizer.Roles(auth.Subject{Name: "alice", Tenant: "tenant-b"}))
+	require.Equal(t, []string{"ops", "writers"}, authorizer.Roles(auth.Subject{Name: "bob", Roles: []string{"ops"}, Tenant: "tenant-b"}))
+
+	// the empty domain is every tenant, including the default one
+	require.NoError(t, authorizer.Authorize(auth.Subject{Name: "bob"}, "reports/1", "set"))
+
+	// the policies of the file are kept
+	require.NoError(t, authorizer.Authorize(auth.Subject{Name: "root"}, "reports/1", "get"))
+
+	// the certificates carry roles in their OU and their role URIs
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "carol", OrganizationalUnit: []string{"ops"}},
+		URIs:    []*url.URL{{Scheme: "role", Opaque: "readers"}, {Scheme: "spiffe", Host: "example.org"}},
+	}
+	carol := auth.SubjectOf(cert, "tenant-c")
+	require.Equal(t, []string{"ops", "readers"}, carol.Roles)
+	require.NoError(t, authorizer.Authorize(carol, "reports/1", "get"))
+	requireDenied(t, authorizer.Authorize(carol, "reports/1", "set"))
+
+	authorizer.SetPolicies(nil, nil)
+	requireDenied(t, authorizer.Authorize(carol, "reports/1", "get"))
+	alice.Tenant = "tenant-a"
+	requireDenied(t, authorizer.Authorize(alice, "reports/1", "get"))
+	require.NoError(t, authorizer.Authorize(auth.Subject{Name: "root"}, "reports/1", "get"))
+
+	// nobody reaches the reserved keys
+	requireDenied(t, authorizer.Authorize(auth.Subject{Name: "root"}, "_memdist/policies/x", "get"))
+}
+
+func TestAuthorizerWithoutDomains(t *testing.T) {
+	dir := t.TempDir()
+	model := filepath.Join(dir, "model.conf")
+	policy := filepath.Join(dir, "policy.csv")
+	require.NoError(t, os.WriteFile(model, []byte(`[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch(r.obj, p.obj) && r.act == p.act
+`), 0600))
+	require.NoError(t, os.WriteFile(policy, []byte("p, root, *, get\n"), 0600))
+
+	authorizer, err := auth.New(model, policy)
+	require.NoError(t, err)
+	require.NoError(t, authorizer.Authorize(auth.Subject{Name: "root"}, "foo", "get"))
+
+	// the rules scoped to a tenant can't be enforced and are left out
+	authorizer.SetPolicies(
+		[]*api.Policy{{Subject: "readers", Object: "*", Action: "get"}},
+		[]*api.RoleAssignment{
+			{Subject: "alice", Role: "readers"},
+			{Subject: "bob", Role: "readers", Domain: "tenant-a"},
+		},
+	)
+	require.NoError(t, authorizer.Authorize(auth.Subject{Name: "alice"}, "foo", "get"))
+	requireDenied(t, authorizer.Authorize(auth.Subject{Name: "bob", Tenant: "tenant-a"}, "foo", "get"))
+}
+
+func requireDenied(t *testing.T, err error) {
+	t.Helper()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,104 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestJWT(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "k1",
+			"use": "sig",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}},
+	})
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, jwks, 0600))
+
+	authenticator, err := auth.NewJWT(auth.JWTConfig{
+		JWKSFile: file,
+		Issuer:   "https://issuer.example",
+		Audience: "memdist",
+	})
+	require.NoError(t, err)
+
+	sign := func(claims jwt.MapClaims, kid string, key *ecdsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":   "alice",
+			"iss":   "https://issuer.example",
+			"aud":   "memdist",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"roles": []string{"readers"},
+		}
+	}
+
+	sub, err := authenticator.Authenticate(ctx, auth.Credentials{
+		Token:  sign(claims(), "k1", key),
+		Tenant: "tenant-a",
+	})
+	require.NoError(t, err)
+	require.Equal(t, auth.Subject{Name: "alice", Roles: []string{"readers"}, Tenant: "tenant-a"}, sub)
+
+	expired := claims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	noExp := claims()
+	delete(noExp, "exp")
+	wrongAudience := claims()
+	wrongAudience["aud"] = "other"
+	noSubject := claims()
+	delete(noSubject, "sub")
+	for _, token := range []string{
+		sign(claims(), "k1", other),
+		sign(claims(), "k2", key),
+		sign(expired, "k1", key),
+		sign(noExp, "k1", key),
+		sign(wrongAudience, "k1", key),
+		sign(noSubject, "k1", key),
+	} {
+		_, err = authenticator.Authenticate(ctx, auth.Credentials{Token: token})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	// the symmetric algorithms are refused, the public key isn't a secret
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	signed, err := hs.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate(ctx, auth.Credentials{Token: signed})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the other tokens are left to the next authenticators
+	_, err = authenticator.Authenticate(ctx, auth.Credentials{Token: "mdk_0000_secret"})
+	require.ErrorIs(t, err, auth.ErrNoCredentials)
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/x509"
+	"slices"
+)
+
+const (
+	// DefaultTenant is the domain of the callers that don't pick one.
+	DefaultTenant = "default"
+	// roleScheme is the scheme of the URI SANs that carry a role, like
+	// role:readers.
+	roleScheme = "role"
+)
+
+// Subject is the identity of a caller.
+type Subject struct {
+	// Name is the common name of the client certificate.
+	Name string
+	// Roles are held by the caller on top of the ones assigned to Name by
+	// the policies, they come from its certificate.
+	Roles []string
+	// Tenant is the domain of the policies checked for the caller, empty
+	// uses DefaultTenant.
+	Tenant string
+}
+
+// SubjectOf returns the subject of a verified client certificate: its
+// common name, and the roles of its organizational units and of its URI
+// SANs with the role scheme.
+func SubjectOf(cert *x509.Certificate, tenant string) Subject {
+	sub := Subject{
+		Name:   cert.Subject.CommonName,
+		Roles:  slices.Clone(cert.Subject.OrganizationalUnit),
+		Tenant: tenant,
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == roleScheme && uri.Opaque != "" {
+			sub.Roles = append(sub.Roles, uri.Opaque)
+		}
+	}
+	return sub
+}
+
+func (s Subject) tenant() string {
+	if s.Tenant == "" {
+		return DefaultTenant
+	}
+	return s.Tenant
+}
@@ -27,8 +27,8 @@ func GetTlsConfig(cfg TLSConfig) (*tls.Config, error) {
 		config.Certificates[0] = cert
 	}
 
-	if CAFile != "" {
-		cert, err := os.ReadFile(CAFile)
+	if cfg.CAFile != "" {
+		cert, err := os.ReadFile(cfg.CAFile)
 		if err != nil {
 			return nil, err
 		}
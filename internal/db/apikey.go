@@ -0,0 +1,98 @@
+package db
+
+import (
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrAPIKeyNotFound is returned by GetAPIKey for the keys that don't exist
+// or expired.
+var ErrAPIKeyNotFound = status.Error(codes.NotFound, "api key not found")
+
+func apiKeyKey(id string) string {
+	return ruleKey(apiKeyPrefix, id)
+}
+
+// ValidateAPIKey returns an InvalidArgument error when the key misses its
+// Id, Hash or Subject, or when its fields exceed the limits.
+func (o Options) ValidateAPIKey(req *api.AddAPIKeyRequest) error {
+	k := req.Key
+	if k == nil || k.Id == "" || len(k.Hash) == 0 || k.Subject == "" {
+		return status.Error(codes.InvalidArgument, "the APIKey needs an Id, a Hash and a Subject")
+	}
+	if req.Ttl < 0 {
+		return status.Error(codes.InvalidArgument, "the Ttl can't be negative")
+	}
+	return o.validateRule(apiKeyKey(k.Id), append([]string{k.Id, k.Subject}, k.Roles...)...)
+}
+
+// AddAPIKey stores a hashed key, the Id of a live key can't be reused.
+func (db *DB) AddAPIKey(req *api.AddAPIKeyRequest) error {
+	if err := db.opts.ValidateAPIKey(req); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.addAPIKey(req, db.next())
+}
+
+// addAPIKey stores the key, it expires like the other keys. The caller
+// must hold the lock.
+func (db *DB) addAPIKey(req *api.AddAPIKeyRequest, o op) error {
+	e := &entry{key: apiKeyKey(req.Key.Id), version: o.index}
+	key := req.Key
+	if req.Ttl > 0 {
+		e.expireAt = o.now + req.Ttl
+		key = proto.Clone(req.Key).(*api.APIKey)
+		key.ExpireAt = e.expireAt
+	}
+	added, err := db.addRule(e, key, o)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return status.Error(codes.AlreadyExists, "the api key already exists")
+	}
+	return nil
+}
+
+func (db *DB) RevokeAPIKey(req *api.RevokeAPIKeyRequest) (*api.RevokeAPIKeyResponse, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.revokeAPIKey(req, db.next()), nil
+}
+
+// revokeAPIKey deletes the key, the caller must hold the lock.
+func (db *DB) revokeAPIKey(req *api.RevokeAPIKeyRequest, o op) *api.RevokeAPIKeyResponse {
+	return &api.RevokeAPIKeyResponse{Revoked: db.removeRule(apiKeyKey(req.Id), o)}
+}
+
+// ListAPIKeys returns the live keys ordered by Id, without their Hash.
+func (db *DB) ListAPIKeys(req *api.ListAPIKeysRequest) (*api.ListAPIKeysResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keys := db.apiKeys(now())
+	for _, k := range keys {
+		k.Hash = nil
+	}
+	return &api.ListAPIKeysResponse{Keys: keys}, nil
+}
+
+// GetAPIKey returns the live key of id from the local state, the
+// authenticators call it for every request so it never waits for raft.
+func (db *DB) GetAPIKey(id string) (*api.APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	e, ok := db.live(apiKeyKey(id), now())
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	key := &api.APIKey{}
+	if err := proto.Unmarshal(e.value, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMaxBatchSize is the default number of items of a batch.
+const DefaultMaxBatchSize = 1000
+
+// ValidateBatch returns an InvalidArgument error when a batch has more than
+// MaxBatchSize items.
+func (o Options) ValidateBatch(size int) error {
+	o = o.WithDefaults()
+	if size > o.MaxBatchSize {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("the batch has more than %d items", o.MaxBatchSize))
+	}
+	return nil
+}
+
+// ItemError converts the error of an item of a batch to its result.
+func ItemError(err error) *api.Error {
+	st := status.Convert(err)
+	return &api.Error{Code: uint32(st.Code()), Message: st.Message()}
+}
+
+// Merge places the results of the pending items of a batch, pending holds
+// their position in the batch.
+func Merge[T any](results []T, pending []int, applied []T) []T {
+	for i, result := range applied {
+		results[pending[i]] = result
+	}
+	return results
+}
+
+func (db *DB) MultiGet(req *api.MultiGetRequest) (*api.MultiGetResponse, error) {
+	if err := db.opts.ValidateBatch(len(req.Keys)); err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := now()
+	res := &api.MultiGetResponse{}
+	for _, key := range req.Keys {
+		result := &api.MultiGetResponse_Result{}
+		if e, ok := db.live(key, now); !ok {
+			result.Error = ItemError(ErrKeyNotFound)
+		} else if e.typ != api.Type_STRING {
+			result.Error = ItemError(ErrWrongType)
+		} else {
+			result.Value = e.value
+			result.Version = e.version
+			result.Flags = e.flags
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	return res, nil
+}
+
+func (db *DB) MultiSet(req *api.MultiSetRequest) (*api.MultiSetResponse, error) {
+	valid, res, pending, err := db.opts.splitMultiSet(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(valid.Items) == 0 {
+		return res, nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	applied := db.multiSet(valid, db.next())
+	res.Results = Merge(res.Results, pending, applied.Results)
+
+	return res, nil
+}
+
+// splitMultiSet checks the limits of the batch and of its items. It returns
+// the request made of the valid items, the response holding the errors of
+// the others and the position of the valid items in the batch.
+func (o Options) splitMultiSet(req *api.MultiSetRequest) (*api.MultiSetRequest, *api.MultiSetResponse, []int, error) {
+	if err := o.ValidateBatch(len(req.Items)); err != nil {
+		return nil, nil, nil, err
+	}
+
+	valid := &api.MultiSetRequest{}
+	res := &api.MultiSetResponse{
+		Results: make([]*api.MultiSetResponse_Result, len(req.Items)),
+	}
+	var pending []int
+	for i, item := range req.Items {
+		err := o.Validate(item.Key, item.Value)
+		if err == nil && item.Ttl < 0 {
+			err = status.Error(codes.InvalidArgument, "the Ttl can't be negative")
+		}
+		if err != nil {
+			res.Results[i] = &api.MultiSetResponse_Result{Error: ItemError(err)}
+			continue
+		}
+		valid.Items = append(valid.Items, item)
+		pending = append(pending, i)
+	}
+
+	return valid, res, pending, nil
+}
+
+// multiSet writes the items, they all get the version of the op. The
+// caller must hold the lock.
+func (db *DB) multiSet(req *api.MultiSetRequest, o op) *api.MultiSetResponse {
+	res := &api.MultiSetResponse{}
+	for _, item := range req.Items {
+		result := &api.MultiSetResponse_Result{}
+		if setRes, err := db.set(item, o); err != nil {
+			result.Error = ItemError(err)
+		} else {
+			result.Version = setRes.Version
+		}
+		res.Results = append(res.Results, result)
+	}
+	db.applied(o)
+
+	return res
+}
+
+func (db *DB) MultiDelete(req *api.MultiDeleteRequest) (*api.MultiDeleteResponse, error) {
+	if err := db.opts.ValidateBatch(len(req.Items)); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.multiDelete(req, db.next()), nil
+}
+
+// multiDelete removes the items, the caller must hold the lock.
+func (db *DB) multiDelete(req *api.MultiDeleteRequest, o op) *api.MultiDeleteResponse {
+	res := &api.MultiDeleteResponse{Index: o.index}
+	for _, item := range req.Items {
+		result := &api.MultiDeleteResponse_Result{}
+		if _, err := db.delete(item, o); err != nil {
+			result.Error = ItemError(err)
+		}
+		res.Results = append(res.Results, result)
+	}
+	db.applied(o)
+
+	return res
+}
@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDbBatch(t *testing.T) {
+	data := db.NewDB(db.Options{MaxKeySize: 8, MaxBatchSize: 3})
+
+	set, err := data.MultiSet(&api.MultiSetRequest{Items: []*api.SetRequest{
+		{Key: "foo", Value: []byte("bar")},
+		{Key: strings.Repeat("k", 9), Value: []byte("too long")},
+		{Key: "john", Value: []byte("doe")},
+	}})
+	require.NoError(t, err)
+	require.Len(t, set.Results, 3)
+	require.Nil(t, set.Results[0].Error)
+	require.Equal(t, uint32(codes.InvalidArgument), set.Results[1].Error.Code)
+	require.Nil(t, set.Results[2].Error)
+	// the items are written at once
+	require.NotZero(t, set.Results[0].Version)
+	require.Equal(t, set.Results[0].Version, set.Results[2].Version)
+
+	get, err := data.MultiGet(&api.MultiGetRequest{Keys: []string{"john", "missing", "foo"}})
+	require.NoError(t, err)
+	require.Equal(t, []byte("doe"), get.Results[0].Value)
+	require.Equal(t, uint32(codes.NotFound), get.Results[1].Error.Code)
+	require.Equal(t, []byte("bar"), get.Results[2].Value)
+	require.Equal(t, set.Results[0].Version, get.Results[2].Version)
+
+	del, err := data.MultiDelete(&api.MultiDeleteRequest{Items: []*api.DeleteRequest{
+		{Key: "foo"},
+		{Key: "john", Precondition: &api.Precondition{IfVersion: 1000}},
+	}})
+	require.NoError(t, err)
+	require.Nil(t, del.Results[0].Error)
+	require.Equal(t, uint32(codes.FailedPrecondition), del.Results[1].Error.Code)
+
+	get, err = data.MultiGet(&api.MultiGetRequest{Keys: []string{"foo", "john"}})
+	require.NoError(t, err)
+	require.NotNil(t, get.Results[0].Error)
+	require.Nil(t, get.Results[1].Error)
+
+	_, err = data.MultiGet(&api.MultiGetRequest{Keys: []string{"a", "b", "c", "d"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
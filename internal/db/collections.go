@@ -0,0 +1,386 @@
+package db
+
+import (
+	"slices"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrWrongType      = status.Error(codes.FailedPrecondition, "WRONGTYPE operation against a key holding the wrong kind of value")
+	ErrFieldNotFound  = status.Error(codes.NotFound, "field not found")
+	errEmptyOperation = status.Error(codes.InvalidArgument, "the request has nothing to write")
+)
+
+// list holds the values of a list, the entries of a list share it.
+type list struct {
+	values [][]byte
+}
+
+func newCollection(key string, typ api.Type) *entry {
+	e := &entry{key: key, typ: typ}
+	switch typ {
+	case api.Type_HASH:
+		e.hash = make(map[string][]byte)
+	case api.Type_LIST:
+		e.list = &list{}
+	case api.Type_SET:
+		e.set = make(map[string]struct{})
+	}
+	return e
+}
+
+// size returns the number of items of a collection.
+func (e *entry) size() int {
+	switch e.typ {
+	case api.Type_HASH:
+		return len(e.hash)
+	case api.Type_LIST:
+		return len(e.list.values)
+	case api.Type_SET:
+		return len(e.set)
+	}
+	return 0
+}
+
+// collection returns the live entry of key, or a new one when the key
+// doesn't exist, along with whether it exists. It fails with ErrWrongType
+// when the key holds another type. The caller must hold the lock.
+func (db *DB) collection(key string, typ api.Type, now int64) (*entry, bool, error) {
+	e, ok := db.live(key, now)
+	if !ok {
+		return newCollection(key, typ), false, nil
+	}
+	if e.typ != typ {
+		return nil, false, ErrWrongType
+	}
+	return e, true, nil
+}
+
+// store saves a collection modified by o, the key is removed once the
+// collection is empty. The caller must hold the lock.
+func (db *DB) store(e *entry, exists bool, o op) {
+	if e.size() == 0 {
+		if exists {
+			db.remove(e.key, o)
+		}
+		return
+	}
+	stored := *e
+	stored.version = o.index
+	db.put(&stored)
+}
+
+// ValidateHSet checks the limits of the key and of every field of req, the
+// fields are checked like keys.
+func (o Options) ValidateHSet(req *api.HSetRequest) error {
+	if len(req.Fields) == 0 {
+		return errEmptyOperation
+	}
+	if err := o.Validate(req.Key, nil); err != nil {
+		return err
+	}
+	for field, value := range req.Fields {
+		if err := o.Validate(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateLPush checks the limits of the key and of every value of req.
+func (o Options) ValidateLPush(req *api.LPushRequest) error {
+	if len(req.Values) == 0 {
+		return errEmptyOperation
+	}
+	for _, value := range req.Values {
+		if err := o.Validate(req.Key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateMembers checks the limits of the key and of the members of a
+// set, the members are checked like keys.
+func (o Options) ValidateMembers(key string, members []string) error {
+	if len(members) == 0 {
+		return errEmptyOperation
+	}
+	if err := o.Validate(key, nil); err != nil {
+		return err
+	}
+	for _, member := range members {
+		if err := o.Validate(member, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) HSet(req *api.HSetRequest) (*api.HSetResponse, error) {
+	if err := db.opts.ValidateHSet(req); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.hset(req, db.next())
+}
+
+// hset writes the fields of the hash, the caller must hold the lock.
+func (db *DB) hset(req *api.HSetRequest, o op) (*api.HSetResponse, error) {
+	e, exists, err := db.collection(req.Key, api.Type_HASH, o.now)
+	if err != nil {
+		return nil, err
+	}
+	var added uint32
+	for field, value := range req.Fields {
+		if _, ok := e.hash[field]; !ok {
+			added++
+		}
+		e.hash[field] = value
+	}
+	db.store(e, exists, o)
+	db.applied(o)
+
+	return &api.HSetResponse{Added: added, Version: o.index}, nil
+}
+
+func (db *DB) HGet(req *api.HGetRequest) (*api.HGetResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	e, exists, err := db.collection(req.Key, api.Type_HASH, now())
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+	value, ok := e.hash[req.Field]
+	if !ok {
+		return nil, ErrFieldNotFound
+	}
+
+	return &api.HGetResponse{Value: value}, nil
+}
+
+func (db *DB) HDel(req *api.HDelRequest) (*api.HDelResponse, error) {
+	if len(req.Fields) == 0 {
+		return nil, errEmptyOperation
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.hdel(req, db.next())
+}
+
+// hdel removes the fields of the hash, the caller must hold the lock.
+func (db *DB) hdel(req *api.HDelRequest, o op) (*api.HDelResponse, error) {
+	e, exists, err := db.collection(req.Key, api.Type_HASH, o.now)
+	if err != nil {
+		return nil, err
+	}
+	var removed uint32
+	for _, field := range req.Fields {
+		if _, ok := e.hash[field]; ok {
+			delete(e.hash, field)
+			removed++
+		}
+	}
+	if removed > 0 {
+		db.store(e, exists, o)
+	}
+	db.applied(o)
+
+	return &api.HDelResponse{Removed: removed}, nil
+}
+
+func (db *DB) HGetAll(req *api.HGetAllRequest) (*api.HGetAllResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	e, _, err := db.collection(req.Key, api.Type_HASH, now())
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string][]byte, len(e.hash))
+	for field, value := range e.hash {
+		fields[field] = value
+	}
+
+	return &api.HGetAllResponse{Fields: fields}, nil
+}
+
+func (db *DB) LPush(req *api.LPushRequest) (*api.LPushResponse, error) {
+	if err := db.opts.ValidateLPush(req); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.lpush(req, db.next())
+}
+
+// lpush pushes the values to the list, the caller must hold the lock.
+func (db *DB) lpush(req *api.LPushRequest, o op) (*api.LPushResponse, error) {
+	e, exists, err := db.collection(req.Key, api.Type_LIST, o.now)
+	if err != nil {
+		return nil, err
+	}
+	if req.End == api.ListEnd_TAIL {
+		e.list.values = append(e.list.values, req.Values...)
+	} else {
+		values := slices.Clone(req.Values)
+		slices.Reverse(values)
+		e.list.values = append(values, e.list.values...)
+	}
+	db.store(e, exists, o)
+	db.applied(o)
+
+	return &api.LPushResponse{Length: uint64(len(e.list.values)), Version: o.index}, nil
+}
+
+func (db *DB) LPop(req *api.LPopRequest) (*api.LPopResponse, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.lpop(req, db.next())
+}
+
+// lpop removes up to Count values from the list, the caller must hold the
+// lock.
+func (db *DB) lpop(req *api.LPopRequest, o op) (*api.LPopResponse, error) {
+	e, exists, err := db.collection(req.Key, api.Type_LIST, o.now)
+	if err != nil {
+		return nil, err
+	}
+	defer db.applied(o)
+	if !exists {
+		return &api.LPopResponse{}, nil
+	}
+	count := min(max(int(req.Count), 1), len(e.list.values))
+
+	// the popped slots stay in the backing array of the list, they are
+	// cleared so that they don't keep the values reachable
+	var values [][]byte
+	if req.End == api.ListEnd_TAIL {
+		rest := len(e.list.values) - count
+		values = slices.Clone(e.list.values[rest:])
+		slices.Reverse(values)
+		clear(e.list.values[rest:])
+		e.list.values = e.list.values[:rest]
+	} else {
+		values = slices.Clone(e.list.values[:count])
+		clear(e.list.values[:count])
+		e.list.values = e.list.values[count:]
+	}
+	db.store(e, exists, o)
+
+	return &api.LPopResponse{Values: values}, nil
+}
+
+func (db *DB) LRange(req *api.LRangeRequest) (*api.LRangeResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	e, _, err := db.collection(req.Key, api.Type_LIST, now())
+	if err != nil {
+		return nil, err
+	}
+	length := int64(len(e.list.values))
+	start, stop := req.Start, req.Stop
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	stop = min(stop, length-1)
+	if start > stop {
+		return &api.LRangeResponse{}, nil
+	}
+
+	return &api.LRangeResponse{
+		Values: slices.Clone(e.list.values[start : stop+1]),
+	}, nil
+}
+
+func (db *DB) SAdd(req *api.SAddRequest) (*api.SAddResponse, error) {
+	if err := db.opts.ValidateMembers(req.Key, req.Members); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.sadd(req, db.next())
+}
+
+// sadd adds the members to the set, the caller must hold the lock.
+func (db *DB) sadd(req *api.SAddRequest, o op) (*api.SAddResponse, error) {
+	e, exists, err := db.collection(req.Key, api.Type_SET, o.now)
+	if err != nil {
+		return nil, err
+	}
+	var added uint32
+	for _, member := range req.Members {
+		if _, ok := e.set[member]; !ok {
+			e.set[member] = struct{}{}
+			added++
+		}
+	}
+	db.store(e, exists, o)
+	db.applied(o)
+
+	return &api.SAddResponse{Added: added, Version: o.index}, nil
+}
+
+func (db *DB) SRem(req *api.SRemRequest) (*api.SRemResponse, error) {
+	if len(req.Members) == 0 {
+		return nil, errEmptyOperation
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.srem(req, db.next())
+}
+
+// srem removes the members from the set, the caller must hold the lock.
+func (db *DB) srem(req *api.SRemRequest, o op) (*api.SRemResponse, error) {
+	e, exists, err := db.collection(req.Key, api.Type_SET, o.now)
+	if err != nil {
+		return nil, err
+	}
+	var removed uint32
+	for _, member := range req.Members {
+		if _, ok := e.set[member]; ok {
+			delete(e.set, member)
+			removed++
+		}
+	}
+	if removed > 0 {
+		db.store(e, exists, o)
+	}
+	db.applied(o)
+
+	return &api.SRemResponse{Removed: removed}, nil
+}
+
+func (db *DB) SMembers(req *api.SMembersRequest) (*api.SMembersResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	e, _, err := db.collection(req.Key, api.Type_SET, now())
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(e.set))
+	for member := range e.set {
+		members = append(members, member)
+	}
+	slices.Sort(members)
+
+	return &api.SMembersResponse{Members: members}, nil
+}
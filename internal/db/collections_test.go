@@ -0,0 +1,94 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDbCollections(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	hset, err := data.HSet(&api.HSetRequest{
+		Key:    "user",
+		Fields: map[string][]byte{"name": []byte("john"), "age": []byte("30")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), hset.Added)
+	hset, err = data.HSet(&api.HSetRequest{
+		Key:    "user",
+		Fields: map[string][]byte{"name": []byte("jane")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), hset.Added)
+
+	hget, err := data.HGet(&api.HGetRequest{Key: "user", Field: "name"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("jane"), hget.Value)
+	_, err = data.HGet(&api.HGetRequest{Key: "user", Field: "email"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	for _, end := range []api.ListEnd{api.ListEnd_TAIL, api.ListEnd_HEAD} {
+		_, err = data.LPush(&api.LPushRequest{
+			Key:    "queue",
+			Values: [][]byte{[]byte("a"), []byte("b")},
+			End:    end,
+		})
+		require.NoError(t, err)
+	}
+	lrange, err := data.LRange(&api.LRangeRequest{Key: "queue", Start: 0, Stop: -1})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("b"), []byte("a"), []byte("a"), []byte("b")}, lrange.Values)
+	lrange, err = data.LRange(&api.LRangeRequest{Key: "queue", Start: -2, Stop: 10})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b")}, lrange.Values)
+
+	lpop, err := data.LPop(&api.LPopRequest{Key: "queue", End: api.ListEnd_TAIL, Count: 3})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("b"), []byte("a"), []byte("a")}, lpop.Values)
+
+	sadd, err := data.SAdd(&api.SAddRequest{Key: "tags", Members: []string{"go", "db", "go"}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), sadd.Added)
+	smembers, err := data.SMembers(&api.SMembersRequest{Key: "tags"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"db", "go"}, smembers.Members)
+
+	// the commands of a type fail on the keys holding another one
+	_, err = data.Get(&api.GetRequest{Key: "user"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = data.SAdd(&api.SAddRequest{Key: "queue", Members: []string{"a"}})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = data.Set(&api.SetRequest{Key: "name", Value: []byte("john")})
+	require.NoError(t, err)
+	_, err = data.HGetAll(&api.HGetAllRequest{Key: "name"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// the collections survive a snapshot
+	restored := db.NewDB(db.Options{})
+	require.NoError(t, restored.Restore(data.Read()))
+	hgetall, err := restored.HGetAll(&api.HGetAllRequest{Key: "user"})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"name": []byte("jane"), "age": []byte("30")}, hgetall.Fields)
+	lrange, err = restored.LRange(&api.LRangeRequest{Key: "queue", Start: 0, Stop: -1})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("b")}, lrange.Values)
+	smembers, err = restored.SMembers(&api.SMembersRequest{Key: "tags"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"db", "go"}, smembers.Members)
+
+	// the keys are removed along with their last item
+	srem, err := data.SRem(&api.SRemRequest{Key: "tags", Members: []string{"go", "db", "rust"}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), srem.Removed)
+	_, err = data.LPop(&api.LPopRequest{Key: "queue"})
+	require.NoError(t, err)
+	for _, key := range []string{"tags", "queue"} {
+		_, err = data.TTL(&api.TTLRequest{Key: key})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	}
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrNotInteger = status.Error(codes.InvalidArgument, "the value is not a 64 bit integer")
+	ErrOverflow   = status.Error(codes.OutOfRange, "the operation overflows a 64 bit integer")
+)
+
+// DecrToIncr returns the increment equivalent to req.
+func DecrToIncr(req *api.DecrRequest) (*api.IncrRequest, error) {
+	if req.Delta == math.MinInt64 {
+		return nil, ErrOverflow
+	}
+	return &api.IncrRequest{
+		Key:      req.Key,
+		Delta:    -req.Delta,
+		Initial:  req.Initial,
+		Unsigned: req.Unsigned,
+	}, nil
+}
+
+func (db *DB) Incr(req *api.IncrRequest) (*api.IncrResponse, error) {
+	if err := db.opts.Validate(req.Key, nil); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.incr(req, db.next())
+}
+
+func (db *DB) Decr(req *api.DecrRequest) (*api.DecrResponse, error) {
+	incrReq, err := DecrToIncr(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.Incr(incrReq)
+	if err != nil {
+		return nil, err
+	}
+	return &api.DecrResponse{Value: res.Value, Version: res.Version}, nil
+}
+
+// incr adds the delta to the counter, the deadline and the flags of the key
+// are kept. The caller must hold the lock.
+func (db *DB) incr(req *api.IncrRequest, o op) (*api.IncrResponse, error) {
+	var value int64
+	counter := &entry{key: req.Key}
+	if e, ok := db.live(req.Key, o.now); ok {
+		if e.typ != api.Type_STRING {
+			return nil, ErrWrongType
+		}
+		var err error
+		if value, err = add(e.value, req.Delta, req.Unsigned); err != nil {
+			return nil, err
+		}
+		counter.expireAt = e.expireAt
+		counter.flags = e.flags
+	} else if req.Initial != nil {
+		value = *req.Initial
+	} else {
+		return nil, ErrKeyNotFound
+	}
+
+	if req.Unsigned {
+		counter.value = []byte(strconv.FormatUint(uint64(value), 10))
+	} else {
+		counter.value = []byte(strconv.FormatInt(value, 10))
+	}
+	counter.version = o.index
+	db.put(counter)
+	db.applied(o)
+
+	return &api.IncrResponse{Value: value, Version: o.index}, nil
+}
+
+// add adds delta to the integer stored in value. The unsigned integers
+// wrap around on the increments and stop at zero on the decrements, their
+// bits are returned.
+func add(value []byte, delta int64, unsigned bool) (int64, error) {
+	if unsigned {
+		current, err := strconv.ParseUint(string(value), 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		if delta >= 0 {
+			return int64(current + uint64(delta)), nil
+		}
+		// the magnitude of math.MinInt64 is still right once converted
+		if d := uint64(-delta); d < current {
+			return int64(current - d), nil
+		}
+		return 0, nil
+	}
+
+	current, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) ||
+		(delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	return current + delta, nil
+}
@@ -0,0 +1,66 @@
+package db_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDbCounter(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	_, err := data.Incr(&api.IncrRequest{Key: "hits", Delta: 1})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// the initial value is stored as is
+	res, err := data.Incr(&api.IncrRequest{Key: "hits", Delta: 1, Initial: proto.Int64(10)})
+	require.NoError(t, err)
+	require.Equal(t, int64(10), res.Value)
+
+	res, err = data.Incr(&api.IncrRequest{Key: "hits", Delta: 5, Initial: proto.Int64(10)})
+	require.NoError(t, err)
+	require.Equal(t, int64(15), res.Value)
+
+	dec, err := data.Decr(&api.DecrRequest{Key: "hits", Delta: 20})
+	require.NoError(t, err)
+	require.Equal(t, int64(-5), dec.Value)
+	require.Greater(t, dec.Version, res.Version)
+
+	// the counters are plain values
+	get, err := data.Get(&api.GetRequest{Key: "hits"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("-5"), get.Value)
+
+	_, err = data.Set(&api.SetRequest{Key: "max", Value: []byte("9223372036854775807")})
+	require.NoError(t, err)
+	_, err = data.Incr(&api.IncrRequest{Key: "max", Delta: 1})
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+	_, err = data.Decr(&api.DecrRequest{Key: "hits", Delta: math.MinInt64})
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+
+	_, err = data.Set(&api.SetRequest{Key: "name", Value: []byte("john")})
+	require.NoError(t, err)
+	_, err = data.Incr(&api.IncrRequest{Key: "name", Delta: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the unsigned counters wrap around and stop at zero, the flags are
+	// kept
+	_, err = data.Set(&api.SetRequest{Key: "cas", Value: []byte("18446744073709551615"), Flags: 7})
+	require.NoError(t, err)
+	res, err = data.Incr(&api.IncrRequest{Key: "cas", Delta: 2, Unsigned: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res.Value)
+	dec, err = data.Decr(&api.DecrRequest{Key: "cas", Delta: 5, Unsigned: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), dec.Value)
+	get, err = data.Get(&api.GetRequest{Key: "cas"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("0"), get.Value)
+	require.Equal(t, uint32(7), get.Flags)
+}
@@ -2,12 +2,16 @@ package db
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/dunielm02/memdist/api/v1"
+	"github.com/google/btree"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
@@ -16,57 +20,659 @@ import (
 var enc = binary.BigEndian
 
 const (
-	KeyValueSize = 4
+	// LengthPrefixSize is the width in bytes of the length written before
+	// every record of a snapshot.
+	LengthPrefixSize = 4
+
+	DefaultMaxKeySize   = 1 << 10
+	DefaultMaxValueSize = 1 << 20
 )
 
+// Options limits the size of the keys and values accepted by the database,
+// zero values fall back to the defaults.
+type Options struct {
+	MaxKeySize   int
+	MaxValueSize int
+	// WatchHistory is the number of events kept for the watches that start
+	// at a past revision.
+	WatchHistory int
+	// MaxBatchSize is the maximum number of items of a batch.
+	MaxBatchSize int
+	// OnPolicies is called with every stored policy and role assignment
+	// each time they change, including when a snapshot is restored. It must
+	// not call the database.
+	OnPolicies func([]*api.Policy, []*api.RoleAssignment)
+}
+
+// WithDefaults fills the zero values with the default limits.
+func (o Options) WithDefaults() Options {
+	if o.MaxKeySize == 0 {
+		o.MaxKeySize = DefaultMaxKeySize
+	}
+	if o.MaxValueSize == 0 {
+		o.MaxValueSize = DefaultMaxValueSize
+	}
+	if o.WatchHistory == 0 {
+		o.WatchHistory = DefaultWatchHistory
+	}
+	if o.MaxBatchSize == 0 {
+		o.MaxBatchSize = DefaultMaxBatchSize
+	}
+	return o
+}
+
+// Validate returns an InvalidArgument error when the key or the value
+// exceed the limits.
+func (o Options) Validate(key string, value []byte) error {
+	o = o.WithDefaults()
+	if len(key) > o.MaxKeySize {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("the size of the Key is bigger than: %d", o.MaxKeySize))
+	}
+	if len(value) > o.MaxValueSize {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("the size of the Value is bigger than: %d", o.MaxValueSize))
+	}
+	return nil
+}
+
+type entry struct {
+	key   string
+	typ   api.Type
+	value []byte
+	flags uint32
+	// the collections are modified in place by their writes, they are only
+	// read while holding the lock
+	hash map[string][]byte
+	list *list
+	set  map[string]struct{}
+	// expireAt is the deadline in unix milliseconds, zero when the entry
+	// never expires.
+	expireAt int64
+	// version is the index of the last write to the entry.
+	version uint64
+}
+
+// expired reports whether the entry is past its deadline at now, given in
+// unix milliseconds.
+func (e *entry) expired(now int64) bool {
+	return e.expireAt != 0 && e.expireAt <= now
+}
+
+// record returns the record sent to the clients, it leaves the
+// collections out so it can be built without holding the lock.
+func (e *entry) record() *api.Record {
+	return &api.Record{
+		Key:      e.key,
+		Value:    e.value,
+		ExpireAt: e.expireAt,
+		Version:  e.version,
+		Type:     e.typ,
+		Flags:    e.flags,
+	}
+}
+
+// snapshotRecord returns the record written to the snapshots, the caller
+// must hold the lock.
+func (e *entry) snapshotRecord() *api.Record {
+	record := e.record()
+	switch e.typ {
+	case api.Type_HASH:
+		record.Hash = e.hash
+	case api.Type_LIST:
+		record.List = e.list.values
+	case api.Type_SET:
+		for member := range e.set {
+			record.Set = append(record.Set, member)
+		}
+	}
+	return record
+}
+
+// entryOf is the inverse of snapshotRecord.
+func entryOf(record *api.Record) *entry {
+	e := newCollection(record.Key, record.Type)
+	e.value = record.Value
+	e.flags = record.Flags
+	e.expireAt = record.ExpireAt
+	e.version = record.Version
+	switch record.Type {
+	case api.Type_HASH:
+		for field, value := range record.Hash {
+			e.hash[field] = value
+		}
+	case api.Type_LIST:
+		e.list.values = record.List
+	case api.Type_SET:
+		for _, member := range record.Set {
+			e.set[member] = struct{}{}
+		}
+	}
+	return e
+}
+
+// byKey orders the entries of the tree.
+func byKey(a, b *entry) bool {
+	return a.key < b.key
+}
+
+// btreeDegree is the degree of the tree that holds the entries.
+const btreeDegree = 32
+
+// op places a write in the history of the database.
+type op struct {
+	// index is the raft index of the write, it becomes the version of the
+	// keys it touches.
+	index uint64
+	// now is the clock of the leader that proposed the write in unix
+	// milliseconds.
+	now int64
+}
+
 type DB struct {
-	data sync.Map
+	opts Options
+	mu   sync.RWMutex
+	// data holds the entries ordered by key. The entries are never modified
+	// once they are in the tree, a write replaces them.
+	data *btree.BTreeG[*entry]
+	// index is the last index applied to the database.
+	index uint64
+	hub   *watchHub
 }
 
-func NewDB() *DB {
+func NewDB(opts Options) *DB {
+	opts = opts.WithDefaults()
 	return &DB{
-		data: sync.Map{},
+		opts: opts,
+		data: btree.NewG(btreeDegree, byKey),
+		hub:  newWatchHub(opts.WatchHistory),
 	}
 }
 
-func (db *DB) Set(req *api.SetRequest) error {
-	if len(req.Key) >= (1 << KeyValueSize) {
-		return status.Error(codes.InvalidArgument, fmt.Sprintf("the size of the Key is bigger than: %d", 1<<KeyValueSize))
+// now returns the local clock in unix milliseconds. The reads and the
+// writes of a standalone DB use it, the writes of a DistributedDB use the
+// clock of the leader that proposed them instead.
+func now() int64 {
+	return time.Now().UnixMilli()
+}
+
+// next returns the op of a write that doesn't come from the raft log, the
+// caller must hold the lock.
+func (db *DB) next() op {
+	return op{index: db.index + 1, now: now()}
+}
+
+// applied records the index of the last write, the caller must hold the
+// lock.
+func (db *DB) applied(o op) {
+	db.index = max(db.index, o.index)
+}
+
+// put replaces the entry of its key and publishes the change, the caller
+// must hold the lock.
+func (db *DB) put(e *entry) {
+	db.data.ReplaceOrInsert(e)
+	db.hub.publish(&api.Event{
+		Type:     api.Event_PUT,
+		Record:   e.record(),
+		Revision: e.version,
+	})
+}
+
+// remove deletes the entry of key and publishes the change, the caller
+// must hold the lock.
+func (db *DB) remove(key string, o op) {
+	db.data.Delete(&entry{key: key})
+	db.hub.publish(&api.Event{
+		Type:     api.Event_DELETE,
+		Record:   &api.Record{Key: key},
+		Revision: o.index,
+	})
+}
+
+func (db *DB) Set(req *api.SetRequest) (*api.SetResponse, error) {
+	if err := db.opts.Validate(req.Key, req.Value); err != nil {
+		return nil, err
 	}
-	if len(req.Value) >= (1 << KeyValueSize) {
-		return status.Error(codes.InvalidArgument, fmt.Sprintf("the size of the Value is bigger than: %d", 1<<KeyValueSize))
+	if req.Ttl < 0 {
+		return nil, status.Error(codes.InvalidArgument, "the Ttl can't be negative")
 	}
-	db.data.Store(req.Key, req.Value)
 
-	return nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.set(req, db.next())
 }
 
-type KeyNotFound error
+// set saves the value without checking the limits, the entries that come
+// from the raft log were already validated by the leader. The caller must
+// hold the lock.
+func (db *DB) set(req *api.SetRequest, o op) (*api.SetResponse, error) {
+	current, ok := db.live(req.Key, o.now)
+	if err := checkPrecondition(req.Precondition, current, ok); err != nil {
+		return nil, err
+	}
+
+	e := &entry{key: req.Key, value: req.Value, flags: req.Flags, version: o.index}
+	if req.Ttl > 0 {
+		e.expireAt = o.now + req.Ttl
+	}
+	db.put(e)
+	db.applied(o)
+
+	return &api.SetResponse{Version: e.version}, nil
+}
+
+var ErrKeyNotFound = status.Error(codes.NotFound, "key not found")
 
 func (db *DB) Get(req *api.GetRequest) (*api.GetResponse, error) {
-	v, ok := db.data.Load(req.Key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 
+	e, ok := db.live(req.Key, now())
 	if !ok {
-		return &api.GetResponse{}, KeyNotFound(fmt.Errorf("key not found"))
+		return &api.GetResponse{}, ErrKeyNotFound
+	}
+	if e.typ != api.Type_STRING {
+		return nil, ErrWrongType
+	}
+
+	return &api.GetResponse{Value: e.value, Version: e.version, Flags: e.flags}, nil
+}
+
+// live returns the entry stored under key unless it expired at now, the
+// caller must hold the lock.
+func (db *DB) live(key string, now int64) (*entry, bool) {
+	e, ok := db.data.Get(&entry{key: key})
+	if !ok || e.expired(now) {
+		return nil, false
+	}
+	return e, true
+}
+
+func (db *DB) Delete(req *api.DeleteRequest) (*api.DeleteResponse, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.delete(req, db.next())
+}
+
+// delete removes the key, the caller must hold the lock.
+func (db *DB) delete(req *api.DeleteRequest, o op) (*api.DeleteResponse, error) {
+	current, ok := db.live(req.Key, o.now)
+	if err := checkPrecondition(req.Precondition, current, ok); err != nil {
+		return nil, err
+	}
+	if ok {
+		db.remove(req.Key, o)
 	}
+	db.applied(o)
 
-	return &api.GetResponse{Value: v.(string)}, nil
+	return &api.DeleteResponse{Index: o.index}, nil
 }
 
-func (db *DB) Delete(req *api.DeleteRequest) error {
-	db.data.Delete(req.Key)
+// checkPrecondition returns a FailedPrecondition error, with the current
+// version of the key as a detail, when cond doesn't hold.
+func checkPrecondition(cond *api.Precondition, current *entry, exists bool) error {
+	if cond == nil {
+		return nil
+	}
+	var version uint64
+	if exists {
+		version = current.version
+	}
+
+	var msg string
+	switch {
+	case cond.IfAbsent && exists:
+		msg = "the key already exists"
+	case cond.IfPresent && !exists:
+		msg = "the key doesn't exist"
+	case cond.IfVersion != 0 && cond.IfVersion != version:
+		msg = fmt.Sprintf("the key is at version %d, not %d", version, cond.IfVersion)
+	default:
+		return nil
+	}
+
+	st, err := status.New(codes.FailedPrecondition, msg).WithDetails(
+		&api.ConditionFailure{CurrentVersion: version},
+	)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, msg)
+	}
+	return st.Err()
+}
+
+func (db *DB) Expire(req *api.ExpireRequest) (*api.ExpireResponse, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.expire(req, db.next())
+}
+
+// expire sets the deadline of the key, the caller must hold the lock.
+func (db *DB) expire(req *api.ExpireRequest, o op) (*api.ExpireResponse, error) {
+	e, ok := db.live(req.Key, o.now)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	expired := *e
+	expired.expireAt = o.now + max(req.Ttl, 0)
+	expired.version = o.index
+	db.put(&expired)
+	db.applied(o)
+
+	return &api.ExpireResponse{Version: expired.version}, nil
+}
+
+func (db *DB) Persist(req *api.PersistRequest) (*api.PersistResponse, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.persist(req, db.next())
+}
+
+// persist removes the deadline of the key, the caller must hold the lock.
+func (db *DB) persist(req *api.PersistRequest, o op) (*api.PersistResponse, error) {
+	e, ok := db.live(req.Key, o.now)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	persisted := *e
+	persisted.expireAt = 0
+	persisted.version = o.index
+	db.put(&persisted)
+	db.applied(o)
+
+	return &api.PersistResponse{Version: persisted.version}, nil
+}
+
+func (db *DB) Txn(req *api.TxnRequest) (*api.TxnResponse, error) {
+	if err := db.opts.ValidateTxn(req); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.txn(req, db.next())
+}
+
+// ValidateTxn checks the limits of every write of the transaction, once a
+// transaction passes it none of its ops can fail halfway through.
+func (o Options) ValidateTxn(req *api.TxnRequest) error {
+	for _, ops := range [][]*api.Op{req.Success, req.Failure} {
+		for _, op := range ops {
+			if err := o.validateOp(op); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+func (o Options) validateOp(op *api.Op) error {
+	switch r := op.GetRequest().(type) {
+	case *api.Op_Set:
+		if err := o.Validate(r.Set.Key, r.Set.Value); err != nil {
+			return err
+		}
+		if r.Set.Ttl < 0 {
+			return status.Error(codes.InvalidArgument, "the Ttl can't be negative")
+		}
+		if r.Set.Precondition != nil {
+			return status.Error(codes.InvalidArgument, "the ops of a transaction can't have a Precondition")
+		}
+	case *api.Op_Delete:
+		if r.Delete.Precondition != nil {
+			return status.Error(codes.InvalidArgument, "the ops of a transaction can't have a Precondition")
+		}
+	case *api.Op_Get:
+	default:
+		return status.Error(codes.InvalidArgument, "empty op in the transaction")
+	}
 	return nil
 }
 
+// txn evaluates the compares and runs the matching ops, the caller must
+// hold the lock.
+func (db *DB) txn(req *api.TxnRequest, o op) (*api.TxnResponse, error) {
+	succeeded := true
+	for _, c := range req.Compares {
+		if !db.compare(c, o.now) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := req.Failure
+	if succeeded {
+		ops = req.Success
+	}
+
+	res := &api.TxnResponse{Succeeded: succeeded, Index: o.index}
+	for _, op := range ops {
+		var result *api.OpResult
+		switch r := op.GetRequest().(type) {
+		case *api.Op_Set:
+			setRes, err := db.set(r.Set, o)
+			if err != nil {
+				return nil, err
+			}
+			result = &api.OpResult{Response: &api.OpResult_Set{Set: setRes}}
+		case *api.Op_Delete:
+			delRes, err := db.delete(r.Delete, o)
+			if err != nil {
+				return nil, err
+			}
+			result = &api.OpResult{Response: &api.OpResult_Delete{Delete: delRes}}
+		case *api.Op_Get:
+			getRes := &api.GetResponse{}
+			if e, ok := db.live(r.Get.Key, o.now); ok {
+				getRes.Value = e.value
+				getRes.Version = e.version
+				getRes.Flags = e.flags
+			}
+			result = &api.OpResult{Response: &api.OpResult_Get{Get: getRes}}
+		}
+		res.Results = append(res.Results, result)
+	}
+	db.applied(o)
+
+	return res, nil
+}
+
+// compare evaluates c at now, the caller must hold the lock.
+func (db *DB) compare(c *api.Compare, now int64) bool {
+	e, ok := db.live(c.Key, now)
+
+	var result int
+	switch c.Target {
+	case api.Compare_VERSION:
+		var version uint64
+		if ok {
+			version = e.version
+		}
+		result = cmp.Compare(version, c.Version)
+	case api.Compare_VALUE:
+		if !ok || e.typ != api.Type_STRING {
+			return false
+		}
+		result = bytes.Compare(e.value, c.Value)
+	default:
+		return false
+	}
+
+	switch c.Result {
+	case api.Compare_EQUAL:
+		return result == 0
+	case api.Compare_NOT_EQUAL:
+		return result != 0
+	case api.Compare_GREATER:
+		return result > 0
+	case api.Compare_LESS:
+		return result < 0
+	}
+	return false
+}
+
+func (db *DB) TTL(req *api.TTLRequest) (*api.TTLResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := now()
+	e, ok := db.live(req.Key, now)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if e.expireAt == 0 {
+		return &api.TTLResponse{Ttl: -1}, nil
+	}
+
+	return &api.TTLResponse{Ttl: e.expireAt - now}, nil
+}
+
+// SkipRecord is returned by the callback of Scan to leave a record out of
+// the results, the skipped records don't count against the Limit.
+var SkipRecord = errors.New("skip this record")
+
+// Scan calls fn with the live records of the range of req, in order. It
+// returns the continuation token when the Limit stopped the scan before the
+// end of the range. The scan sees the database as it was when it started,
+// and fn runs without holding the lock.
+func (db *DB) Scan(req *api.ScanRequest, fn func(*api.Record) error) ([]byte, error) {
+	start, end := scanRange(req)
+
+	// cloning the tree is cheap, the clone and the original share the
+	// nodes until one of them is modified
+	db.mu.Lock()
+	data := db.data.Clone()
+	db.mu.Unlock()
+
+	now := now()
+	var (
+		last  string
+		count uint32
+		token []byte
+		err   error
+	)
+	iter := func(e *entry) bool {
+		if e.key < start || (end != "" && e.key >= end) {
+			// the reverse scans start at End, which is excluded
+			return !req.Reverse || e.key >= start
+		}
+		if e.expired(now) {
+			return true
+		}
+		if req.Limit != 0 && count == req.Limit {
+			token = []byte(last)
+			return false
+		}
+		ferr := fn(e.record())
+		if ferr == SkipRecord {
+			return true
+		}
+		if ferr != nil {
+			err = ferr
+			return false
+		}
+		last = e.key
+		count++
+		return true
+	}
+
+	switch {
+	case req.Reverse && end == "":
+		data.Descend(iter)
+	case req.Reverse:
+		data.DescendLessOrEqual(&entry{key: end}, iter)
+	case end == "":
+		data.AscendGreaterOrEqual(&entry{key: start}, iter)
+	default:
+		data.AscendRange(&entry{key: start}, &entry{key: end}, iter)
+	}
+
+	return token, err
+}
+
+// scanRange returns the bounds of the keys visited by req, narrowed by its
+// prefix and its continuation token. An empty end means there is no bound.
+func scanRange(req *api.ScanRequest) (start, end string) {
+	start, end = req.Start, req.End
+	if req.Prefix != "" {
+		start = max(start, req.Prefix)
+		if e := prefixEnd(req.Prefix); e != "" && (end == "" || e < end) {
+			end = e
+		}
+	}
+	if req.ContinuationToken != nil {
+		token := string(req.ContinuationToken)
+		if req.Reverse {
+			if end == "" || token < end {
+				end = token
+			}
+		} else {
+			// the smallest key after the token
+			start = max(start, token+"\x00")
+		}
+	}
+	return start, end
+}
+
+// prefixEnd returns the first key after every key that starts with prefix,
+// or an empty string when there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// expired returns up to limit keys that expired at now.
+func (db *DB) expired(now int64, limit int) []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var keys []string
+	db.data.Ascend(func(e *entry) bool {
+		if e.expired(now) {
+			keys = append(keys, e.key)
+		}
+		return len(keys) < limit
+	})
+
+	return keys
+}
+
+// reap removes the keys of the request that expired at now, the keys that
+// were written again since the leader listed them are kept. The caller must
+// hold the lock.
+func (db *DB) reap(req *api.ReapRequest, o op) {
+	for _, k := range req.Keys {
+		if e, ok := db.data.Get(&entry{key: k}); ok && e.expired(o.now) {
+			db.remove(k, o)
+		}
+	}
+	db.applied(o)
+}
+
+// SnapshotHeader starts every snapshot written by Read, the last byte is
+// the version of the format. Snapshots taken before the header existed
+// start directly with the length of the first record, which can't collide
+// with the header since no record is anywhere near 1.2GB.
+var SnapshotHeader = []byte{'M', 'D', 'S', snapshotVersion}
+
+// snapshotVersion 2 added the collections to the records, the snapshots of
+// version 1 only hold strings and are still restored.
+const snapshotVersion = 2
+
+// Read returns a snapshot of the database: the header followed by every
+// record encoded as a protobuf and prefixed with its length.
 func (db *DB) Read() io.Reader {
 	var ret = bytes.NewBuffer([]byte{})
-	db.data.Range(func(key, value any) bool {
-		record := &api.Record{
-			Key:   key.(string),
-			Value: value.(string),
-		}
-		encoded, _ := proto.Marshal(record)
+	ret.Write(SnapshotHeader)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	db.data.Ascend(func(e *entry) bool {
+		encoded, _ := proto.Marshal(e.snapshotRecord())
 		binary.Write(ret, enc, uint32(len(encoded)))
 		ret.Write(encoded)
 		return true
@@ -75,8 +681,95 @@ func (db *DB) Read() io.Reader {
 	return ret
 }
 
+// Restore replaces the content of the database with a snapshot produced by
+// Read. It also accepts the snapshots taken before values became bytes:
+// they have no header and their values were encoded as protobuf strings,
+// which share the wire format of bytes.
+func (db *DB) Restore(r io.Reader) error {
+	db.mu.Lock()
+	db.reset()
+	db.mu.Unlock()
+
+	prefix := make([]byte, LengthPrefixSize)
+	_, err := io.ReadFull(r, prefix)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if bytes.Equal(prefix[:3], SnapshotHeader[:3]) {
+		if version := prefix[3]; version < 1 || version > snapshotVersion {
+			return fmt.Errorf("unsupported snapshot version: %d", version)
+		}
+	} else {
+		// legacy snapshot, the prefix is the length of the first record
+		if err := db.restoreRecord(r, prefix); err != nil {
+			return err
+		}
+	}
+
+	for {
+		_, err := io.ReadFull(r, prefix)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := db.restoreRecord(r, prefix); err != nil {
+			return err
+		}
+	}
+
+	// the history of the writes included in the snapshot is gone
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	db.hub.reset(db.index)
+	db.notifyPolicies(now())
+
+	return nil
+}
+
+// Watch returns a watcher of the keys of req. The events are published as
+// the writes are applied, the expired keys produce a DELETE once they are
+// removed.
+func (db *DB) Watch(req *api.WatchRequest) (*Watcher, error) {
+	return db.hub.watch(req)
+}
+
+func (db *DB) restoreRecord(r io.Reader, prefix []byte) error {
+	size := enc.Uint32(prefix)
+	data := make([]byte, int(size))
+	_, err := io.ReadFull(r, data)
+	if err != nil {
+		return err
+	}
+
+	var record = &api.Record{}
+	if err := proto.Unmarshal(data, record); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.data.ReplaceOrInsert(entryOf(record))
+	db.index = max(db.index, record.Version)
+
+	return nil
+}
+
 func (db *DB) Reset() error {
-	db.data = sync.Map{}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.reset()
+	db.notifyPolicies(now())
 
 	return nil
 }
+
+// reset empties the database, the caller must hold the lock.
+func (db *DB) reset() {
+	db.data = btree.NewG(btreeDegree, byKey)
+	db.index = 0
+	db.hub.reset(0)
+}
@@ -1,48 +1,60 @@
 package db_test
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dunielm02/memdist/api/v1"
 	"github.com/dunielm02/memdist/internal/db"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
 var enc = binary.BigEndian
 
 func TestDb(t *testing.T) {
-	data := db.NewDB()
+	data := db.NewDB(db.Options{})
 
-	testCases := map[string]string{
-		"foo":  "bar",
-		"john": "doe",
+	testCases := map[string][]byte{
+		"foo":    []byte("bar"),
+		"john":   []byte("doe"),
+		"binary": {0xff, 0xfe, 0x00, 0x80},
 	}
 
 	for k, v := range testCases {
-		data.Set(&api.SetRequest{
+		_, err := data.Set(&api.SetRequest{
 			Key:   k,
 			Value: v,
 		})
+		require.NoError(t, err)
 	}
 
 	for k, v := range testCases {
 		res, err := data.Get(&api.GetRequest{Key: k})
 		require.NoError(t, err)
-		require.Equal(t, res.Value, v)
+		require.Equal(t, v, res.Value)
 	}
 
 	read := data.Read()
+	header := make([]byte, len(db.SnapshotHeader))
+	_, err := io.ReadFull(read, header)
+	require.NoError(t, err)
+	require.Equal(t, db.SnapshotHeader, header)
 	for {
-		s := make([]byte, db.KeyValueSize)
+		s := make([]byte, db.LengthPrefixSize)
 		n, err := read.Read(s)
 		if err == io.EOF {
 			break
 		}
 		require.NoError(t, err)
-		require.Equal(t, n, db.KeyValueSize)
+		require.Equal(t, n, db.LengthPrefixSize)
 
 		size := enc.Uint32(s)
 		data := make([]byte, int(size))
@@ -56,7 +68,7 @@ func TestDb(t *testing.T) {
 		require.Equal(t, testCases[record.Key], record.Value)
 	}
 
-	err := data.Delete(&api.DeleteRequest{Key: "foo"})
+	_, err = data.Delete(&api.DeleteRequest{Key: "foo"})
 	require.NoError(t, err)
 
 	_, err = data.Get(&api.GetRequest{Key: "foo"})
@@ -68,3 +80,346 @@ func TestDb(t *testing.T) {
 	_, err = data.Get(&api.GetRequest{Key: "john"})
 	require.Error(t, err)
 }
+
+func TestDbLimits(t *testing.T) {
+	data := db.NewDB(db.Options{MaxKeySize: 8, MaxValueSize: 32})
+
+	// values are no longer capped by the width of the snapshot length prefix
+	_, err := data.Set(&api.SetRequest{
+		Key:   "foo",
+		Value: []byte(strings.Repeat("a", 32)),
+	})
+	require.NoError(t, err)
+
+	_, err = data.Set(&api.SetRequest{
+		Key:   strings.Repeat("k", 9),
+		Value: []byte("bar"),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = data.Set(&api.SetRequest{
+		Key:   "foo",
+		Value: []byte(strings.Repeat("a", 33)),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = db.Options{}.Validate(
+		strings.Repeat("k", db.DefaultMaxKeySize),
+		[]byte(strings.Repeat("v", db.DefaultMaxValueSize)),
+	)
+	require.NoError(t, err)
+}
+
+func TestDbRestore(t *testing.T) {
+	data := db.NewDB(db.Options{})
+	_, err := data.Set(&api.SetRequest{
+		Key:   "foo",
+		Value: []byte{0xff, 0x00},
+	})
+	require.NoError(t, err)
+
+	restored := db.NewDB(db.Options{})
+	require.NoError(t, restored.Restore(data.Read()))
+
+	res, err := restored.Get(&api.GetRequest{Key: "foo"})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xff, 0x00}, res.Value)
+
+	// snapshots taken while the values were strings have no header
+	var legacy bytes.Buffer
+	for _, kv := range [][2]string{{"john", "doe"}, {"jane", "roe"}} {
+		var record []byte
+		record = protowire.AppendTag(record, 1, protowire.BytesType)
+		record = protowire.AppendString(record, kv[0])
+		record = protowire.AppendTag(record, 2, protowire.BytesType)
+		record = protowire.AppendString(record, kv[1])
+		binary.Write(&legacy, enc, uint32(len(record)))
+		legacy.Write(record)
+	}
+
+	require.NoError(t, restored.Restore(&legacy))
+
+	_, err = restored.Get(&api.GetRequest{Key: "foo"})
+	require.Error(t, err)
+	for k, v := range map[string]string{"john": "doe", "jane": "roe"} {
+		res, err := restored.Get(&api.GetRequest{Key: k})
+		require.NoError(t, err)
+		require.Equal(t, []byte(v), res.Value)
+	}
+}
+
+func TestDbTTL(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	_, err := data.Set(&api.SetRequest{
+		Key:   "foo",
+		Value: []byte("bar"),
+		Ttl:   50,
+	})
+	require.NoError(t, err)
+	_, err = data.Set(&api.SetRequest{
+		Key:   "john",
+		Value: []byte("doe"),
+	})
+	require.NoError(t, err)
+
+	res, err := data.TTL(&api.TTLRequest{Key: "foo"})
+	require.NoError(t, err)
+	require.Greater(t, res.Ttl, int64(0))
+	require.LessOrEqual(t, res.Ttl, int64(50))
+
+	res, err = data.TTL(&api.TTLRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), res.Ttl)
+
+	// the snapshot keeps the deadlines
+	restored := db.NewDB(db.Options{})
+	require.NoError(t, restored.Restore(data.Read()))
+	res, err = restored.TTL(&api.TTLRequest{Key: "foo"})
+	require.NoError(t, err)
+	require.Greater(t, res.Ttl, int64(0))
+
+	time.Sleep(60 * time.Millisecond)
+
+	// expired keys are invisible even if nobody removed them
+	for _, d := range []*db.DB{data, restored} {
+		_, err = d.Get(&api.GetRequest{Key: "foo"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		_, err = d.TTL(&api.TTLRequest{Key: "foo"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	}
+	_, err = data.Expire(&api.ExpireRequest{Key: "foo", Ttl: 1000})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	expire, err := data.Expire(&api.ExpireRequest{Key: "john", Ttl: 1000})
+	require.NoError(t, err)
+	res, err = data.TTL(&api.TTLRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Greater(t, res.Ttl, int64(0))
+	get, err := data.Get(&api.GetRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Equal(t, expire.Version, get.Version)
+
+	persist, err := data.Persist(&api.PersistRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Greater(t, persist.Version, expire.Version)
+	res, err = data.TTL(&api.TTLRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), res.Ttl)
+
+	_, err = data.Expire(&api.ExpireRequest{Key: "john", Ttl: 0})
+	require.NoError(t, err)
+	_, err = data.Get(&api.GetRequest{Key: "john"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = data.Set(&api.SetRequest{Key: "foo", Value: []byte("bar"), Ttl: -1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDbPreconditions(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	res, err := data.Set(&api.SetRequest{
+		Key:          "foo",
+		Value:        []byte("bar"),
+		Precondition: &api.Precondition{IfAbsent: true},
+	})
+	require.NoError(t, err)
+	version := res.Version
+	require.NotZero(t, version)
+
+	_, err = data.Set(&api.SetRequest{
+		Key:          "foo",
+		Value:        []byte("baz"),
+		Precondition: &api.Precondition{IfAbsent: true},
+	})
+	requireConditionFailure(t, err, version)
+
+	_, err = data.Set(&api.SetRequest{
+		Key:          "foo",
+		Value:        []byte("baz"),
+		Precondition: &api.Precondition{IfVersion: version + 1},
+	})
+	requireConditionFailure(t, err, version)
+
+	res, err = data.Set(&api.SetRequest{
+		Key:          "foo",
+		Value:        []byte("baz"),
+		Precondition: &api.Precondition{IfVersion: version},
+	})
+	require.NoError(t, err)
+	require.Greater(t, res.Version, version)
+
+	get, err := data.Get(&api.GetRequest{Key: "foo"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("baz"), get.Value)
+	require.Equal(t, res.Version, get.Version)
+
+	_, err = data.Delete(&api.DeleteRequest{
+		Key:          "foo",
+		Precondition: &api.Precondition{IfVersion: version},
+	})
+	requireConditionFailure(t, err, res.Version)
+
+	del, err := data.Delete(&api.DeleteRequest{
+		Key:          "foo",
+		Precondition: &api.Precondition{IfVersion: res.Version},
+	})
+	require.NoError(t, err)
+	require.Greater(t, del.Index, res.Version)
+
+	_, err = data.Set(&api.SetRequest{
+		Key:          "foo",
+		Value:        []byte("bar"),
+		Precondition: &api.Precondition{IfPresent: true},
+	})
+	requireConditionFailure(t, err, 0)
+}
+
+func requireConditionFailure(t *testing.T, err error, version uint64) {
+	t.Helper()
+
+	st := status.Convert(err)
+	require.Equal(t, codes.FailedPrecondition, st.Code())
+	require.Len(t, st.Details(), 1)
+	failure, ok := st.Details()[0].(*api.ConditionFailure)
+	require.True(t, ok)
+	require.Equal(t, version, failure.CurrentVersion)
+}
+
+func TestDbTxn(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	set, err := data.Set(&api.SetRequest{Key: "balance", Value: []byte("10")})
+	require.NoError(t, err)
+
+	txn := &api.TxnRequest{
+		Compares: []*api.Compare{{
+			Key:     "balance",
+			Target:  api.Compare_VERSION,
+			Result:  api.Compare_EQUAL,
+			Version: set.Version,
+		}, {
+			Key:    "lock",
+			Target: api.Compare_VERSION,
+			Result: api.Compare_EQUAL,
+		}},
+		Success: []*api.Op{
+			{Request: &api.Op_Set{Set: &api.SetRequest{Key: "balance", Value: []byte("5")}}},
+			{Request: &api.Op_Set{Set: &api.SetRequest{Key: "spent", Value: []byte("5")}}},
+			{Request: &api.Op_Get{Get: &api.GetRequest{Key: "balance"}}},
+		},
+		Failure: []*api.Op{
+			{Request: &api.Op_Get{Get: &api.GetRequest{Key: "balance"}}},
+			{Request: &api.Op_Get{Get: &api.GetRequest{Key: "missing"}}},
+		},
+	}
+
+	res, err := data.Txn(txn)
+	require.NoError(t, err)
+	require.True(t, res.Succeeded)
+	require.Len(t, res.Results, 3)
+	version := res.Results[0].GetSet().Version
+	require.Equal(t, version, res.Results[1].GetSet().Version)
+	require.Equal(t, []byte("5"), res.Results[2].GetGet().Value)
+	require.Equal(t, version, res.Results[2].GetGet().Version)
+
+	// the version of balance changed, so the failure ops run this time
+	res, err = data.Txn(txn)
+	require.NoError(t, err)
+	require.False(t, res.Succeeded)
+	require.Len(t, res.Results, 2)
+	require.Equal(t, []byte("5"), res.Results[0].GetGet().Value)
+	require.Zero(t, res.Results[1].GetGet().Version)
+
+	res, err = data.Txn(&api.TxnRequest{
+		Compares: []*api.Compare{{
+			Key:    "balance",
+			Target: api.Compare_VALUE,
+			Result: api.Compare_GREATER,
+			Value:  []byte("4"),
+		}},
+		Success: []*api.Op{
+			{Request: &api.Op_Delete{Delete: &api.DeleteRequest{Key: "spent"}}},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, res.Succeeded)
+	_, err = data.Get(&api.GetRequest{Key: "spent"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = data.Txn(&api.TxnRequest{
+		Success: []*api.Op{{Request: &api.Op_Delete{Delete: &api.DeleteRequest{
+			Key:          "balance",
+			Precondition: &api.Precondition{IfPresent: true},
+		}}}},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDbScan(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	for _, k := range []string{"a", "b/1", "b/2", "b/3", "c", "d"} {
+		_, err := data.Set(&api.SetRequest{Key: k, Value: []byte(k)})
+		require.NoError(t, err)
+	}
+	_, err := data.Set(&api.SetRequest{Key: "b/0", Value: []byte("gone"), Ttl: 1})
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	scan := func(req *api.ScanRequest) ([]string, []byte) {
+		var keys []string
+		token, err := data.Scan(req, func(r *api.Record) error {
+			require.Equal(t, []byte(r.Key), r.Value)
+			keys = append(keys, r.Key)
+			return nil
+		})
+		require.NoError(t, err)
+		return keys, token
+	}
+
+	keys, token := scan(&api.ScanRequest{})
+	require.Equal(t, []string{"a", "b/1", "b/2", "b/3", "c", "d"}, keys)
+	require.Nil(t, token)
+
+	keys, _ = scan(&api.ScanRequest{Start: "b", End: "c"})
+	require.Equal(t, []string{"b/1", "b/2", "b/3"}, keys)
+
+	keys, _ = scan(&api.ScanRequest{Prefix: "b/", Reverse: true})
+	require.Equal(t, []string{"b/3", "b/2", "b/1"}, keys)
+
+	keys, _ = scan(&api.ScanRequest{End: "c", Reverse: true})
+	require.Equal(t, []string{"b/3", "b/2", "b/1", "a"}, keys)
+
+	// paginate through the prefix in both directions
+	for reverse, want := range map[bool][]string{
+		false: {"b/1", "b/2", "b/3"},
+		true:  {"b/3", "b/2", "b/1"},
+	} {
+		var got []string
+		req := &api.ScanRequest{Prefix: "b/", Limit: 2, Reverse: reverse}
+		for {
+			keys, token := scan(req)
+			got = append(got, keys...)
+			if token == nil {
+				break
+			}
+			req.ContinuationToken = token
+		}
+		require.Equal(t, want, got)
+	}
+
+	// the skipped records don't count against the limit
+	var listed []string
+	token, err = data.Scan(&api.ScanRequest{Limit: 2}, func(r *api.Record) error {
+		if strings.HasPrefix(r.Key, "b/") {
+			return db.SkipRecord
+		}
+		listed = append(listed, r.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, listed)
+	require.Equal(t, []byte("c"), token)
+}
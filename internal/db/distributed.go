@@ -3,51 +3,108 @@ package db
 import (
 	"bytes"
 	"crypto/tls"
+	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/dunielm02/memdist/api/v1"
 	"github.com/hashicorp/raft"
 	boltdb "github.com/hashicorp/raft-boltdb"
+	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
 
 const (
-	SetRequestType    byte = 0
-	DeleteRequestType byte = 1
+	SetRequestType     byte = 0
+	DeleteRequestType  byte = 1
+	ExpireRequestType  byte = 2
+	PersistRequestType byte = 3
+	ReapRequestType    byte = 4
+	TxnRequestType     byte = 5
+	// the batches use a single entry for all their items
+	MultiSetRequestType    byte = 6
+	MultiDeleteRequestType byte = 7
+	// the decrements are written as increments
+	IncrRequestType byte = 8
+	// the writes of the collections
+	HSetRequestType  byte = 9
+	HDelRequestType  byte = 10
+	LPushRequestType byte = 11
+	LPopRequestType  byte = 12
+	SAddRequestType  byte = 13
+	SRemRequestType  byte = 14
+	// the writes of the access policies
+	AddPolicyRequestType    byte = 15
+	RemovePolicyRequestType byte = 16
+	AddRoleRequestType      byte = 17
+	RemoveRoleRequestType   byte = 18
+	AddAPIKeyRequestType    byte = 19
+	RevokeAPIKeyRequestType byte = 20
+)
+
+const (
+	defaultReapInterval = time.Second
+	// reapBatchSize bounds the number of keys removed by a single entry.
+	reapBatchSize = 1000
+	// raftRPCTimeout bounds the wait for the first byte of an accepted
+	// connection.
+	raftRPCTimeout = 10 * time.Second
 )
 
 type Config struct {
 	raft.Config
 	StreamLayer *StreamLayer
 	Bootstrap   bool
+	DB          Options
+	// ReapInterval is how often the leader looks for expired keys.
+	ReapInterval time.Duration
 }
 
 type DistributedDB struct {
 	Config
-	raft *raft.Raft
-	db   *DB
+	raft        *raft.Raft
+	db          *DB
+	logStore    *boltdb.BoltStore
+	stableStore *boltdb.BoltStore
+	shutdown    chan struct{}
 }
 
-func NewDistributedDB(baseDir string, cfg Config) (*DistributedDB, error) {
+func NewDistributedDB(baseDir string, cfg Config) (_ *DistributedDB, err error) {
+	if cfg.ReapInterval == 0 {
+		cfg.ReapInterval = defaultReapInterval
+	}
 	distDB := &DistributedDB{
-		db: NewDB(),
+		Config:   cfg,
+		db:       NewDB(cfg.DB),
+		shutdown: make(chan struct{}),
 	}
-	raftConfig := raft.DefaultConfig()
 	fsm := &fsm{
 		db: distDB.db,
 	}
 
-	ldb, err := boltdb.NewBoltStore(filepath.Join(baseDir, "logs.db"))
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var transport *raft.NetworkTransport
+	// the stores and the transport opened before a failure are closed
+	defer func() {
+		if err != nil {
+			distDB.abort(transport)
+		}
+	}()
+
+	distDB.logStore, err = boltdb.NewBoltStore(filepath.Join(baseDir, "logs.db"))
 	if err != nil {
 		return nil, err
 	}
-	sdb, err := boltdb.NewBoltStore(filepath.Join(baseDir, "store.db"))
+	distDB.stableStore, err = boltdb.NewBoltStore(filepath.Join(baseDir, "store.db"))
 	if err != nil {
 		return nil, err
 	}
@@ -64,23 +121,87 @@ func NewDistributedDB(baseDir string, cfg Config) (*DistributedDB, error) {
 
 	maxPool := 5
 	timeout := 10 * time.Second
-	transport := raft.NewNetworkTransport(
+	transport = raft.NewNetworkTransport(
 		cfg.StreamLayer,
 		maxPool,
 		timeout,
 		os.Stderr,
 	)
 
-	distDB.raft, err = raft.NewRaft(raftConfig, fsm, ldb, sdb, snapshotStore, transport)
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = cfg.LocalID
+	if cfg.HeartbeatTimeout != 0 {
+		raftConfig.HeartbeatTimeout = cfg.HeartbeatTimeout
+	}
+	if cfg.ElectionTimeout != 0 {
+		raftConfig.ElectionTimeout = cfg.ElectionTimeout
+	}
+	if cfg.LeaderLeaseTimeout != 0 {
+		raftConfig.LeaderLeaseTimeout = cfg.LeaderLeaseTimeout
+	}
+	if cfg.CommitTimeout != 0 {
+		raftConfig.CommitTimeout = cfg.CommitTimeout
+	}
+
+	distDB.raft, err = raft.NewRaft(
+		raftConfig,
+		fsm,
+		distDB.logStore,
+		distDB.stableStore,
+		snapshotStore,
+		transport,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	hasState, err := raft.HasExistingState(
+		distDB.logStore,
+		distDB.stableStore,
+		snapshotStore,
+	)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Bootstrap && !hasState {
+		config := raft.Configuration{
+			Servers: []raft.Server{{
+				ID:      raftConfig.LocalID,
+				Address: transport.LocalAddr(),
+			}},
+		}
+		err = distDB.raft.BootstrapCluster(config).Error()
+		if err != nil {
+			return nil, err
+		}
+	}
+	go distDB.reap()
 
-	return nil, nil
+	return distDB, nil
 }
 
 func (d *DistributedDB) Join(name string, addrs string) error {
-	future := d.raft.AddVoter(raft.ServerID(name), raft.ServerAddress(addrs), 0, 0)
+	serverID := raft.ServerID(name)
+	serverAddr := raft.ServerAddress(addrs)
+
+	configFuture := d.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == serverID || srv.Address == serverAddr {
+			if srv.ID == serverID && srv.Address == serverAddr {
+				// the server has already joined
+				return nil
+			}
+			// remove the stale server before adding it again
+			if err := d.raft.RemoveServer(srv.ID, 0, 0).Error(); err != nil {
+				return err
+			}
+		}
+	}
+
+	future := d.raft.AddVoter(serverID, serverAddr, 0, 0)
 	if err := future.Error(); err != nil {
 		return err
 	}
@@ -93,24 +214,464 @@ func (d *DistributedDB) Leave(name string) error {
 	return removeFuture.Error()
 }
 
+// IsLeader reports whether this node is the raft leader.
+func (d *DistributedDB) IsLeader() bool {
+	return d.raft.State() == raft.Leader
+}
+
+// LeaderAddr returns the address of the current raft leader, it is also the
+// address its gRPC server listens on.
+func (d *DistributedDB) LeaderAddr() (string, error) {
+	addr, _ := d.raft.LeaderWithID()
+	if addr == "" {
+		return "", status.Error(codes.Unavailable, "there is no leader")
+	}
+	return string(addr), nil
+}
+
+// GetServers returns the members of the cluster, their addresses are the
+// ones raft uses which are also the addresses of their gRPC servers.
+func (d *DistributedDB) GetServers() ([]*api.Server, error) {
+	future := d.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	_, leaderID := d.raft.LeaderWithID()
+	var servers []*api.Server
+	for _, srv := range future.Configuration().Servers {
+		servers = append(servers, &api.Server{
+			Id:       string(srv.ID),
+			RpcAddr:  string(srv.Address),
+			IsLeader: srv.ID == leaderID,
+		})
+	}
+	return servers, nil
+}
+
+// WaitForLeader blocks until the cluster has elected a leader or the
+// timeout expires.
+func (d *DistributedDB) WaitForLeader(timeout time.Duration) error {
+	timeoutc := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timeoutc:
+			return fmt.Errorf("timed out waiting for a leader")
+		case <-ticker.C:
+			if addr, _ := d.raft.LeaderWithID(); addr != "" {
+				return nil
+			}
+		}
+	}
+}
+
+// abort releases what NewDistributedDB opened before failing, raft closes
+// the transport on shutdown once it was created.
+func (d *DistributedDB) abort(transport *raft.NetworkTransport) {
+	if d.raft != nil {
+		_ = d.raft.Shutdown().Error()
+	} else if transport != nil {
+		_ = transport.Close()
+	}
+	if d.logStore != nil {
+		_ = d.logStore.Close()
+	}
+	if d.stableStore != nil {
+		_ = d.stableStore.Close()
+	}
+}
+
+func (d *DistributedDB) Close() error {
+	close(d.shutdown)
+	f := d.raft.Shutdown()
+	if err := f.Error(); err != nil {
+		return err
+	}
+	if err := d.logStore.Close(); err != nil {
+		return err
+	}
+	return d.stableStore.Close()
+}
+
+// ErrNotLeader carries an api.NotLeader detail, so the clients can tell it
+// from the failed preconditions of the writes and retry on the leader.
+var ErrNotLeader = notLeader(codes.FailedPrecondition, "the requested consistency can only be served by the leader")
+
+// notLeader returns an error with an api.NotLeader detail.
+func notLeader(code codes.Code, msg string) error {
+	st, err := status.New(code, msg).WithDetails(&api.NotLeader{})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
 func (d *DistributedDB) Get(req *api.GetRequest) (*api.GetResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
 	return d.db.Get(req)
 }
 
-func (d *DistributedDB) Set(req *api.SetRequest) error {
-	_, err := d.apply(SetRequestType, req)
-	if err != nil {
-		return err
+// consistentRead blocks until this node can serve a read with the given
+// consistency, or returns ErrNotLeader if it never will.
+func (d *DistributedDB) consistentRead(consistency api.Consistency) error {
+	switch consistency {
+	case api.Consistency_LEADER:
+		// raft steps the leader down once its lease expires, so a node
+		// that still sees itself as the leader is trusted to be up to date
+		if !d.IsLeader() {
+			return ErrNotLeader
+		}
+	case api.Consistency_LINEARIZABLE:
+		if !d.IsLeader() {
+			return ErrNotLeader
+		}
+		if err := d.raft.VerifyLeader().Error(); err != nil {
+			return ErrNotLeader
+		}
+		// the barrier returns once every entry committed before it has
+		// been applied to the fsm
+		if err := d.raft.Barrier(10 * time.Second).Error(); err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
 	}
 	return nil
 }
 
-func (d *DistributedDB) Delete(req *api.DeleteRequest) error {
-	_, err := d.apply(DeleteRequestType, req)
+func (d *DistributedDB) Set(req *api.SetRequest) (*api.SetResponse, error) {
+	if err := d.db.opts.Validate(req.Key, req.Value); err != nil {
+		return nil, err
+	}
+	if req.Ttl < 0 {
+		return nil, status.Error(codes.InvalidArgument, "the Ttl can't be negative")
+	}
+	res, err := d.apply(SetRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.SetResponse), nil
+}
+
+func (d *DistributedDB) Delete(req *api.DeleteRequest) (*api.DeleteResponse, error) {
+	res, err := d.apply(DeleteRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.DeleteResponse), nil
+}
+
+func (d *DistributedDB) Expire(req *api.ExpireRequest) (*api.ExpireResponse, error) {
+	res, err := d.apply(ExpireRequestType, req)
 	if err != nil {
+		return nil, err
+	}
+	return res.(*api.ExpireResponse), nil
+}
+
+func (d *DistributedDB) Persist(req *api.PersistRequest) (*api.PersistResponse, error) {
+	res, err := d.apply(PersistRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.PersistResponse), nil
+}
+
+func (d *DistributedDB) Txn(req *api.TxnRequest) (*api.TxnResponse, error) {
+	if err := d.db.opts.ValidateTxn(req); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(TxnRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.TxnResponse), nil
+}
+
+func (d *DistributedDB) MultiGet(req *api.MultiGetRequest) (*api.MultiGetResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.MultiGet(req)
+}
+
+// MultiSet validates the items on the leader, only the valid ones are
+// written to the log.
+func (d *DistributedDB) MultiSet(req *api.MultiSetRequest) (*api.MultiSetResponse, error) {
+	valid, res, pending, err := d.db.opts.splitMultiSet(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(valid.Items) == 0 {
+		return res, nil
+	}
+	applied, err := d.apply(MultiSetRequestType, valid)
+	if err != nil {
+		return nil, err
+	}
+	res.Results = Merge(res.Results, pending, applied.(*api.MultiSetResponse).Results)
+
+	return res, nil
+}
+
+func (d *DistributedDB) MultiDelete(req *api.MultiDeleteRequest) (*api.MultiDeleteResponse, error) {
+	if err := d.db.opts.ValidateBatch(len(req.Items)); err != nil {
+		return nil, err
+	}
+	if len(req.Items) == 0 {
+		return &api.MultiDeleteResponse{}, nil
+	}
+	res, err := d.apply(MultiDeleteRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.MultiDeleteResponse), nil
+}
+
+func (d *DistributedDB) Incr(req *api.IncrRequest) (*api.IncrResponse, error) {
+	if err := d.db.opts.Validate(req.Key, nil); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(IncrRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.IncrResponse), nil
+}
+
+func (d *DistributedDB) Decr(req *api.DecrRequest) (*api.DecrResponse, error) {
+	incrReq, err := DecrToIncr(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := d.Incr(incrReq)
+	if err != nil {
+		return nil, err
+	}
+	return &api.DecrResponse{Value: res.Value, Version: res.Version}, nil
+}
+
+func (d *DistributedDB) HSet(req *api.HSetRequest) (*api.HSetResponse, error) {
+	if err := d.db.opts.ValidateHSet(req); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(HSetRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.HSetResponse), nil
+}
+
+func (d *DistributedDB) HGet(req *api.HGetRequest) (*api.HGetResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.HGet(req)
+}
+
+func (d *DistributedDB) HDel(req *api.HDelRequest) (*api.HDelResponse, error) {
+	if len(req.Fields) == 0 {
+		return nil, errEmptyOperation
+	}
+	res, err := d.apply(HDelRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.HDelResponse), nil
+}
+
+func (d *DistributedDB) HGetAll(req *api.HGetAllRequest) (*api.HGetAllResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.HGetAll(req)
+}
+
+func (d *DistributedDB) LPush(req *api.LPushRequest) (*api.LPushResponse, error) {
+	if err := d.db.opts.ValidateLPush(req); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(LPushRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.LPushResponse), nil
+}
+
+func (d *DistributedDB) LPop(req *api.LPopRequest) (*api.LPopResponse, error) {
+	res, err := d.apply(LPopRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.LPopResponse), nil
+}
+
+func (d *DistributedDB) LRange(req *api.LRangeRequest) (*api.LRangeResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.LRange(req)
+}
+
+func (d *DistributedDB) SAdd(req *api.SAddRequest) (*api.SAddResponse, error) {
+	if err := d.db.opts.ValidateMembers(req.Key, req.Members); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(SAddRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.SAddResponse), nil
+}
+
+func (d *DistributedDB) SRem(req *api.SRemRequest) (*api.SRemResponse, error) {
+	if len(req.Members) == 0 {
+		return nil, errEmptyOperation
+	}
+	res, err := d.apply(SRemRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.SRemResponse), nil
+}
+
+func (d *DistributedDB) SMembers(req *api.SMembersRequest) (*api.SMembersResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.SMembers(req)
+}
+
+func (d *DistributedDB) AddPolicy(req *api.AddPolicyRequest) (*api.AddPolicyResponse, error) {
+	if err := d.db.opts.ValidatePolicy(req.Policy); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(AddPolicyRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.AddPolicyResponse), nil
+}
+
+func (d *DistributedDB) RemovePolicy(req *api.RemovePolicyRequest) (*api.RemovePolicyResponse, error) {
+	if err := d.db.opts.ValidatePolicy(req.Policy); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(RemovePolicyRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.RemovePolicyResponse), nil
+}
+
+func (d *DistributedDB) ListPolicies(req *api.ListPoliciesRequest) (*api.ListPoliciesResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.ListPolicies(req)
+}
+
+func (d *DistributedDB) AddRole(req *api.AddRoleRequest) (*api.AddRoleResponse, error) {
+	if err := d.db.opts.ValidateRole(req.Role); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(AddRoleRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.AddRoleResponse), nil
+}
+
+func (d *DistributedDB) RemoveRole(req *api.RemoveRoleRequest) (*api.RemoveRoleResponse, error) {
+	if err := d.db.opts.ValidateRole(req.Role); err != nil {
+		return nil, err
+	}
+	res, err := d.apply(RemoveRoleRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.RemoveRoleResponse), nil
+}
+
+func (d *DistributedDB) ListRoles(req *api.ListRolesRequest) (*api.ListRolesResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.ListRoles(req)
+}
+
+func (d *DistributedDB) AddAPIKey(req *api.AddAPIKeyRequest) error {
+	if err := d.db.opts.ValidateAPIKey(req); err != nil {
 		return err
 	}
-	return nil
+	_, err := d.apply(AddAPIKeyRequestType, req)
+	return err
+}
+
+func (d *DistributedDB) RevokeAPIKey(req *api.RevokeAPIKeyRequest) (*api.RevokeAPIKeyResponse, error) {
+	res, err := d.apply(RevokeAPIKeyRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.RevokeAPIKeyResponse), nil
+}
+
+func (d *DistributedDB) ListAPIKeys(req *api.ListAPIKeysRequest) (*api.ListAPIKeysResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.ListAPIKeys(req)
+}
+
+// GetAPIKey reads the local state, a key may be seen by a follower a bit
+// after it was created.
+func (d *DistributedDB) GetAPIKey(id string) (*api.APIKey, error) {
+	return d.db.GetAPIKey(id)
+}
+
+func (d *DistributedDB) TTL(req *api.TTLRequest) (*api.TTLResponse, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.TTL(req)
+}
+
+func (d *DistributedDB) Scan(req *api.ScanRequest, fn func(*api.Record) error) ([]byte, error) {
+	if err := d.consistentRead(req.Consistency); err != nil {
+		return nil, err
+	}
+	return d.db.Scan(req, fn)
+}
+
+// Watch follows the writes applied by this node, which may lag behind the
+// leader.
+func (d *DistributedDB) Watch(req *api.WatchRequest) (*Watcher, error) {
+	return d.db.Watch(req)
+}
+
+// reap runs on every node but only the leader proposes the removal of the
+// expired keys, so the replicas delete them at the same point of the log.
+func (d *DistributedDB) reap() {
+	ticker := time.NewTicker(d.ReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.shutdown:
+			return
+		case <-ticker.C:
+			if !d.IsLeader() {
+				continue
+			}
+			keys := d.db.expired(now(), reapBatchSize)
+			if len(keys) == 0 {
+				continue
+			}
+			if _, err := d.apply(ReapRequestType, &api.ReapRequest{Keys: keys}); err != nil {
+				zap.L().Debug("failed to reap expired keys", zap.Error(err))
+			}
+		}
+	}
 }
 
 func (d *DistributedDB) apply(requestType byte, req proto.Message) (interface{}, error) {
@@ -128,9 +689,20 @@ func (d *DistributedDB) apply(requestType byte, req proto.Message) (interface{},
 		return nil, err
 	}
 
-	future := d.raft.Apply(buf.Bytes(), 10*time.Second)
-	if future.Error() != nil {
-		return nil, future.Error()
+	// the clock of the leader travels with the entry so every replica
+	// evaluates the deadlines against the same time
+	clock := make([]byte, 8)
+	enc.PutUint64(clock, uint64(now()))
+
+	future := d.raft.ApplyLog(raft.Log{
+		Data:       buf.Bytes(),
+		Extensions: clock,
+	}, 10*time.Second)
+	if err := future.Error(); err != nil {
+		if err == raft.ErrNotLeader {
+			return nil, notLeader(codes.Unavailable, err.Error())
+		}
+		return nil, err
 	}
 	res := future.Response()
 	if err, ok := res.(error); ok {
@@ -145,79 +717,351 @@ type fsm struct {
 	db *DB
 }
 
+// clock returns the time, in unix milliseconds, of the leader that proposed
+// the entry. Entries written before the clock was attached return zero,
+// none of them carries a deadline.
+func clock(log *raft.Log) int64 {
+	if len(log.Extensions) != 8 {
+		return 0
+	}
+	return int64(enc.Uint64(log.Extensions))
+}
+
 func (f *fsm) Apply(log *raft.Log) interface{} {
 	reqType := log.Data[0]
+	o := op{index: log.Index, now: clock(log)}
+
+	f.db.mu.Lock()
+	defer f.db.mu.Unlock()
 	switch reqType {
 	case SetRequestType:
-		return f.applySetRequest(log.Data[1:])
+		return f.applySetRequest(log.Data[1:], o)
 	case DeleteRequestType:
-		return f.applyDeleteRequest(log.Data[1:])
+		return f.applyDeleteRequest(log.Data[1:], o)
+	case ExpireRequestType:
+		return f.applyExpireRequest(log.Data[1:], o)
+	case PersistRequestType:
+		return f.applyPersistRequest(log.Data[1:], o)
+	case ReapRequestType:
+		return f.applyReapRequest(log.Data[1:], o)
+	case TxnRequestType:
+		return f.applyTxnRequest(log.Data[1:], o)
+	case MultiSetRequestType:
+		return f.applyMultiSetRequest(log.Data[1:], o)
+	case MultiDeleteRequestType:
+		return f.applyMultiDeleteRequest(log.Data[1:], o)
+	case IncrRequestType:
+		return f.applyIncrRequest(log.Data[1:], o)
+	case HSetRequestType:
+		return f.applyHSetRequest(log.Data[1:], o)
+	case HDelRequestType:
+		return f.applyHDelRequest(log.Data[1:], o)
+	case LPushRequestType:
+		return f.applyLPushRequest(log.Data[1:], o)
+	case LPopRequestType:
+		return f.applyLPopRequest(log.Data[1:], o)
+	case SAddRequestType:
+		return f.applySAddRequest(log.Data[1:], o)
+	case SRemRequestType:
+		return f.applySRemRequest(log.Data[1:], o)
+	case AddPolicyRequestType:
+		return f.applyAddPolicyRequest(log.Data[1:], o)
+	case RemovePolicyRequestType:
+		return f.applyRemovePolicyRequest(log.Data[1:], o)
+	case AddRoleRequestType:
+		return f.applyAddRoleRequest(log.Data[1:], o)
+	case RemoveRoleRequestType:
+		return f.applyRemoveRoleRequest(log.Data[1:], o)
+	case AddAPIKeyRequestType:
+		return f.applyAddAPIKeyRequest(log.Data[1:], o)
+	case RevokeAPIKeyRequestType:
+		return f.applyRevokeAPIKeyRequest(log.Data[1:], o)
 	}
 	return status.Error(codes.Internal, "Something went wrong applying the request")
 }
 
-func (f *fsm) applySetRequest(req []byte) error {
+// applySetRequest also decodes the entries written while values were
+// strings, protobuf encodes strings and bytes the same way.
+func (f *fsm) applySetRequest(req []byte, o op) interface{} {
 	setReq := &api.SetRequest{}
 	err := proto.Unmarshal(req, setReq)
 	if err != nil {
 		return err
 	}
-	err = f.db.Set(setReq)
+	res, err := f.db.set(setReq, o)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return res
 }
 
-func (f *fsm) applyDeleteRequest(req []byte) error {
+func (f *fsm) applyDeleteRequest(req []byte, o op) interface{} {
 	delReq := &api.DeleteRequest{}
 	err := proto.Unmarshal(req, delReq)
 	if err != nil {
 		return err
 	}
-	err = f.db.Delete(delReq)
 
-	return err
+	res, err := f.db.delete(delReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
 }
 
-func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
-	return &snapshot{
-		reader: f.db.Read(),
-	}, nil
+func (f *fsm) applyExpireRequest(req []byte, o op) interface{} {
+	expireReq := &api.ExpireRequest{}
+	err := proto.Unmarshal(req, expireReq)
+	if err != nil {
+		return err
+	}
+
+	res, err := f.db.expire(expireReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
 }
 
-func (f *fsm) Restore(snapshot io.ReadCloser) error {
-	f.db.Reset()
-	for {
-		s := make([]byte, KeyValueSize)
-		_, err := snapshot.Read(s)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
+func (f *fsm) applyPersistRequest(req []byte, o op) interface{} {
+	persistReq := &api.PersistRequest{}
+	err := proto.Unmarshal(req, persistReq)
+	if err != nil {
+		return err
+	}
 
-		size := enc.Uint32(s)
-		data := make([]byte, int(size))
-		_, err = snapshot.Read(data)
-		if err != nil {
-			return err
-		}
+	res, err := f.db.persist(persistReq, o)
+	if err != nil {
+		return err
+	}
 
-		var record = &api.Record{}
-		proto.Unmarshal(data, record)
+	return res
+}
 
-		err = f.db.Set(&api.SetRequest{
-			Key:   record.Key,
-			Value: record.Value,
-		})
-		if err != nil {
-			return err
-		}
+func (f *fsm) applyReapRequest(req []byte, o op) error {
+	reapReq := &api.ReapRequest{}
+	err := proto.Unmarshal(req, reapReq)
+	if err != nil {
+		return err
 	}
+	f.db.reap(reapReq, o)
 
 	return nil
 }
 
+func (f *fsm) applyTxnRequest(req []byte, o op) interface{} {
+	txnReq := &api.TxnRequest{}
+	err := proto.Unmarshal(req, txnReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.txn(txnReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyMultiSetRequest(req []byte, o op) interface{} {
+	multiReq := &api.MultiSetRequest{}
+	err := proto.Unmarshal(req, multiReq)
+	if err != nil {
+		return err
+	}
+
+	return f.db.multiSet(multiReq, o)
+}
+
+func (f *fsm) applyMultiDeleteRequest(req []byte, o op) interface{} {
+	multiReq := &api.MultiDeleteRequest{}
+	err := proto.Unmarshal(req, multiReq)
+	if err != nil {
+		return err
+	}
+
+	return f.db.multiDelete(multiReq, o)
+}
+
+func (f *fsm) applyIncrRequest(req []byte, o op) interface{} {
+	incrReq := &api.IncrRequest{}
+	err := proto.Unmarshal(req, incrReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.incr(incrReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyHSetRequest(req []byte, o op) interface{} {
+	hsetReq := &api.HSetRequest{}
+	err := proto.Unmarshal(req, hsetReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.hset(hsetReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyHDelRequest(req []byte, o op) interface{} {
+	hdelReq := &api.HDelRequest{}
+	err := proto.Unmarshal(req, hdelReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.hdel(hdelReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyLPushRequest(req []byte, o op) interface{} {
+	lpushReq := &api.LPushRequest{}
+	err := proto.Unmarshal(req, lpushReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.lpush(lpushReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyLPopRequest(req []byte, o op) interface{} {
+	lpopReq := &api.LPopRequest{}
+	err := proto.Unmarshal(req, lpopReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.lpop(lpopReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applySAddRequest(req []byte, o op) interface{} {
+	saddReq := &api.SAddRequest{}
+	err := proto.Unmarshal(req, saddReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.sadd(saddReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applySRemRequest(req []byte, o op) interface{} {
+	sremReq := &api.SRemRequest{}
+	err := proto.Unmarshal(req, sremReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.srem(sremReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyAddPolicyRequest(req []byte, o op) interface{} {
+	addReq := &api.AddPolicyRequest{}
+	err := proto.Unmarshal(req, addReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.addPolicy(addReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyRemovePolicyRequest(req []byte, o op) interface{} {
+	removeReq := &api.RemovePolicyRequest{}
+	err := proto.Unmarshal(req, removeReq)
+	if err != nil {
+		return err
+	}
+
+	return f.db.removePolicy(removeReq, o)
+}
+
+func (f *fsm) applyAddRoleRequest(req []byte, o op) interface{} {
+	addReq := &api.AddRoleRequest{}
+	err := proto.Unmarshal(req, addReq)
+	if err != nil {
+		return err
+	}
+	res, err := f.db.addRole(addReq, o)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (f *fsm) applyRemoveRoleRequest(req []byte, o op) interface{} {
+	removeReq := &api.RemoveRoleRequest{}
+	err := proto.Unmarshal(req, removeReq)
+	if err != nil {
+		return err
+	}
+
+	return f.db.removeRole(removeReq, o)
+}
+
+func (f *fsm) applyAddAPIKeyRequest(req []byte, o op) error {
+	addReq := &api.AddAPIKeyRequest{}
+	err := proto.Unmarshal(req, addReq)
+	if err != nil {
+		return err
+	}
+
+	return f.db.addAPIKey(addReq, o)
+}
+
+func (f *fsm) applyRevokeAPIKeyRequest(req []byte, o op) interface{} {
+	revokeReq := &api.RevokeAPIKeyRequest{}
+	err := proto.Unmarshal(req, revokeReq)
+	if err != nil {
+		return err
+	}
+
+	return f.db.revokeAPIKey(revokeReq, o)
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &snapshot{
+		reader: f.db.Read(),
+	}, nil
+}
+
+func (f *fsm) Restore(snapshot io.ReadCloser) error {
+	return f.db.Restore(snapshot)
+}
+
 var _ raft.FSMSnapshot = &snapshot{}
 
 type snapshot struct {
@@ -236,10 +1080,22 @@ func (s *snapshot) Release() {}
 
 var _ raft.StreamLayer = (*StreamLayer)(nil)
 
+// RaftRPC is the first byte written on every raft connection, it lets a
+// single listener tell raft traffic apart from gRPC traffic.
+const RaftRPC = 1
+
 type StreamLayer struct {
 	ln              net.Listener
 	serverTLSConfig *tls.Config
 	peerTLSConfig   *tls.Config
+
+	// the connections identified as raft traffic and the errors of ln, fed
+	// by the goroutine the first Accept starts
+	start     sync.Once
+	conns     chan net.Conn
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func NewStreamLayer(ln net.Listener, serverTLSConfig *tls.Config, peerTLSConfig *tls.Config) *StreamLayer {
@@ -247,6 +1103,9 @@ func NewStreamLayer(ln net.Listener, serverTLSConfig *tls.Config, peerTLSConfig
 		ln:              ln,
 		serverTLSConfig: serverTLSConfig,
 		peerTLSConfig:   peerTLSConfig,
+		conns:           make(chan net.Conn),
+		errs:            make(chan error),
+		closed:          make(chan struct{}),
 	}
 }
 
@@ -256,23 +1115,99 @@ func (s *StreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (n
 		return nil, err
 	}
 
-	tlsConn := tls.Client(conn, s.peerTLSConfig)
+	// identify the connection as raft traffic before the TLS handshake
+	_, err = conn.Write([]byte{RaftRPC})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.peerTLSConfig == nil {
+		return conn, nil
+	}
+
+	tlsConfig := s.peerTLSConfig
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(string(address))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
 
 	return tlsConn, nil
 }
 
+// Accept returns the next connection that starts with RaftRPC. The others,
+// and the ones that don't send a byte within raftRPCTimeout, are closed and
+// skipped, raft stops accepting once Accept fails.
 func (s *StreamLayer) Accept() (net.Conn, error) {
-	conn, err := s.ln.Accept()
-	if err != nil {
+	s.start.Do(func() { go s.accept() })
+	select {
+	case conn := <-s.conns:
+		if s.serverTLSConfig == nil {
+			return conn, nil
+		}
+		return tls.Server(conn, s.serverTLSConfig), nil
+	case err := <-s.errs:
 		return nil, err
+	case <-s.closed:
+		return nil, net.ErrClosed
 	}
+}
 
-	tlsConn := tls.Server(conn, s.serverTLSConfig)
+// accept reads the first byte of each connection of ln in its own
+// goroutine, a peer slow to send it doesn't hold up the others.
+func (s *StreamLayer) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			select {
+			case s.errs <- err:
+				continue
+			case <-s.closed:
+				return
+			}
+		}
+		go s.identify(conn)
+	}
+}
 
-	return tlsConn, nil
+// identify hands conn to Accept when it starts with RaftRPC and closes it
+// otherwise.
+func (s *StreamLayer) identify(conn net.Conn) {
+	if err := readRaftRPC(conn); err != nil {
+		zap.L().Debug("rejected a raft connection", zap.Stringer("addr", conn.RemoteAddr()), zap.Error(err))
+		conn.Close()
+		return
+	}
+	select {
+	case s.conns <- conn:
+	case <-s.closed:
+		conn.Close()
+	}
+}
+
+// readRaftRPC reads the first byte of conn, it must be RaftRPC.
+func readRaftRPC(conn net.Conn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(raftRPCTimeout)); err != nil {
+		return err
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return err
+	}
+	if b[0] != RaftRPC {
+		return fmt.Errorf("not a raft rpc")
+	}
+	return conn.SetReadDeadline(time.Time{})
 }
 
 func (s *StreamLayer) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
 	return s.ln.Close()
 }
 
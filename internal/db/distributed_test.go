@@ -0,0 +1,386 @@
+package db_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDistributedDBConsistency(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	_, err := leader.Set(&api.SetRequest{Key: "foo", Value: []byte("bar")})
+	require.NoError(t, err)
+
+	for _, consistency := range []api.Consistency{
+		api.Consistency_STALE,
+		api.Consistency_LEADER,
+		api.Consistency_LINEARIZABLE,
+	} {
+		res, err := leader.Get(&api.GetRequest{Key: "foo", Consistency: consistency})
+		require.NoError(t, err)
+		require.Equal(t, []byte("bar"), res.Value)
+	}
+
+	// a node that is not part of a cluster can only serve stale reads
+	follower := newDistributedDB(t, "follower", false)
+
+	_, err = follower.Get(&api.GetRequest{Key: "foo"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	for _, consistency := range []api.Consistency{
+		api.Consistency_LEADER,
+		api.Consistency_LINEARIZABLE,
+	} {
+		_, err := follower.Get(&api.GetRequest{Key: "foo", Consistency: consistency})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.IsType(t, &api.NotLeader{}, status.Convert(err).Details()[0])
+	}
+
+	servers, err := leader.GetServers()
+	require.NoError(t, err)
+	require.Len(t, servers, 1)
+	require.Equal(t, "leader", servers[0].Id)
+	require.True(t, servers[0].IsLeader)
+}
+
+func TestDistributedDBVersions(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	first, err := leader.Set(&api.SetRequest{Key: "foo", Value: []byte("bar")})
+	require.NoError(t, err)
+	second, err := leader.Set(&api.SetRequest{Key: "foo", Value: []byte("baz")})
+	require.NoError(t, err)
+	// the versions are consecutive raft indexes
+	require.Equal(t, first.Version+1, second.Version)
+
+	_, err = leader.Set(&api.SetRequest{
+		Key:          "foo",
+		Value:        []byte("qux"),
+		Precondition: &api.Precondition{IfVersion: first.Version},
+	})
+	st := status.Convert(err)
+	require.Equal(t, codes.FailedPrecondition, st.Code())
+	require.Equal(t, second.Version, st.Details()[0].(*api.ConditionFailure).CurrentVersion)
+
+	del, err := leader.Delete(&api.DeleteRequest{
+		Key:          "foo",
+		Precondition: &api.Precondition{IfVersion: second.Version},
+	})
+	require.NoError(t, err)
+	// the index of the raft entry comes back like the versions of the sets
+	require.Greater(t, del.Index, second.Version)
+}
+
+func TestDistributedDBTxn(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	txn := &api.TxnRequest{
+		Compares: []*api.Compare{{
+			Key:    "foo",
+			Target: api.Compare_VERSION,
+			Result: api.Compare_EQUAL,
+		}},
+		Success: []*api.Op{
+			{Request: &api.Op_Set{Set: &api.SetRequest{Key: "foo", Value: []byte("bar")}}},
+			{Request: &api.Op_Set{Set: &api.SetRequest{Key: "john", Value: []byte("doe")}}},
+		},
+		Failure: []*api.Op{
+			{Request: &api.Op_Get{Get: &api.GetRequest{Key: "foo"}}},
+		},
+	}
+
+	res, err := leader.Txn(txn)
+	require.NoError(t, err)
+	require.True(t, res.Succeeded)
+
+	res, err = leader.Txn(txn)
+	require.NoError(t, err)
+	require.False(t, res.Succeeded)
+	require.Equal(t, []byte("bar"), res.Results[0].GetGet().Value)
+
+	// both writes share the raft index of the transaction
+	foo, err := leader.Get(&api.GetRequest{Key: "foo"})
+	require.NoError(t, err)
+	john, err := leader.Get(&api.GetRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Equal(t, foo.Version, john.Version)
+}
+
+func TestDistributedDBExpiration(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	_, err := leader.Set(&api.SetRequest{
+		Key:   "foo",
+		Value: []byte("bar"),
+		Ttl:   50,
+	})
+	require.NoError(t, err)
+	_, err = leader.Set(&api.SetRequest{
+		Key:   "john",
+		Value: []byte("doe"),
+	})
+	require.NoError(t, err)
+
+	res, err := leader.TTL(&api.TTLRequest{Key: "foo"})
+	require.NoError(t, err)
+	require.Greater(t, res.Ttl, int64(0))
+
+	_, err = leader.Expire(&api.ExpireRequest{Key: "john", Ttl: 60_000})
+	require.NoError(t, err)
+	_, err = leader.Persist(&api.PersistRequest{Key: "john"})
+	require.NoError(t, err)
+	res, err = leader.TTL(&api.TTLRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), res.Ttl)
+
+	// the leader proposes the removal of the expired key
+	require.Eventually(t, func() bool {
+		return leader.StoredKeys() == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	_, err = leader.Get(&api.GetRequest{Key: "foo"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = leader.Persist(&api.PersistRequest{Key: "foo"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestDistributedDBWatch(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	w, err := leader.Watch(&api.WatchRequest{Key: "foo"})
+	require.NoError(t, err)
+	defer w.Close()
+
+	set, err := leader.Set(&api.SetRequest{Key: "foo", Value: []byte("bar"), Ttl: 20})
+	require.NoError(t, err)
+
+	event := receive(t, w)
+	require.Equal(t, api.Event_PUT, event.Type)
+	require.Equal(t, set.Version, event.Revision)
+
+	// the removal of the expired key is replicated as a DELETE
+	event = receive(t, w)
+	require.Equal(t, api.Event_DELETE, event.Type)
+	require.Greater(t, event.Revision, set.Version)
+}
+
+func TestDistributedDBBatch(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	set, err := leader.MultiSet(&api.MultiSetRequest{Items: []*api.SetRequest{
+		{Key: "foo", Value: []byte("bar")},
+		{Key: "john", Value: []byte("doe"), Ttl: -1},
+		{Key: "jane", Value: []byte("roe")},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(codes.InvalidArgument), set.Results[1].Error.Code)
+	// the valid items share a single raft entry
+	require.Equal(t, set.Results[0].Version, set.Results[2].Version)
+
+	del, err := leader.MultiDelete(&api.MultiDeleteRequest{Items: []*api.DeleteRequest{
+		{Key: "foo"},
+		{Key: "jane"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, del.Results, 2)
+
+	get, err := leader.MultiGet(&api.MultiGetRequest{
+		Keys:        []string{"foo", "jane"},
+		Consistency: api.Consistency_LINEARIZABLE,
+	})
+	require.NoError(t, err)
+	for _, result := range get.Results {
+		require.Equal(t, uint32(codes.NotFound), result.Error.Code)
+	}
+}
+
+func TestDistributedDBCounter(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	res, err := leader.Incr(&api.IncrRequest{Key: "seq", Delta: 1, Initial: proto.Int64(1)})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res.Value)
+
+	res, err = leader.Incr(&api.IncrRequest{Key: "seq", Delta: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), res.Value)
+
+	dec, err := leader.Decr(&api.DecrRequest{Key: "seq", Delta: 2})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), dec.Value)
+	require.Equal(t, res.Version+1, dec.Version)
+}
+
+func TestDistributedDBCollections(t *testing.T) {
+	leader := newDistributedDB(t, "leader", true)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	hset, err := leader.HSet(&api.HSetRequest{Key: "user", Fields: map[string][]byte{"name": []byte("john")}})
+	require.NoError(t, err)
+	hget, err := leader.HGet(&api.HGetRequest{Key: "user", Field: "name", Consistency: api.Consistency_LINEARIZABLE})
+	require.NoError(t, err)
+	require.Equal(t, []byte("john"), hget.Value)
+
+	lpush, err := leader.LPush(&api.LPushRequest{Key: "queue", Values: [][]byte{[]byte("a"), []byte("b")}, End: api.ListEnd_TAIL})
+	require.NoError(t, err)
+	require.Greater(t, lpush.Version, hset.Version)
+	lpop, err := leader.LPop(&api.LPopRequest{Key: "queue"})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a")}, lpop.Values)
+
+	_, err = leader.SAdd(&api.SAddRequest{Key: "user", Members: []string{"john"}})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestDistributedDBPolicies(t *testing.T) {
+	var mu sync.Mutex
+	var enforced []*api.Policy
+	leader := newDistributedDBWithOptions(t, "leader", true, db.Options{
+		OnPolicies: func(policies []*api.Policy, _ []*api.RoleAssignment) {
+			mu.Lock()
+			defer mu.Unlock()
+			enforced = policies
+		},
+	})
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	policy := &api.Policy{Subject: "alice", Object: "billing/*", Action: "get"}
+	add, err := leader.AddPolicy(&api.AddPolicyRequest{Policy: policy})
+	require.NoError(t, err)
+	require.True(t, add.Added)
+
+	// the hook runs as the entry is applied, before the call returns
+	mu.Lock()
+	require.Len(t, enforced, 1)
+	require.Equal(t, "alice", enforced[0].Subject)
+	mu.Unlock()
+
+	list, err := leader.ListPolicies(&api.ListPoliciesRequest{Consistency: api.Consistency_LINEARIZABLE})
+	require.NoError(t, err)
+	require.Len(t, list.Policies, 1)
+
+	remove, err := leader.RemovePolicy(&api.RemovePolicyRequest{Policy: policy})
+	require.NoError(t, err)
+	require.True(t, remove.Removed)
+	mu.Lock()
+	require.Empty(t, enforced)
+	mu.Unlock()
+
+	_, err = leader.AddPolicy(&api.AddPolicyRequest{Policy: &api.Policy{Subject: "alice"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the API keys go through raft the same way
+	key := &api.APIKey{Id: "k1", Hash: []byte("hash"), Subject: "alice"}
+	require.NoError(t, leader.AddAPIKey(&api.AddAPIKeyRequest{Key: key}))
+	got, err := leader.GetAPIKey("k1")
+	require.NoError(t, err)
+	require.Equal(t, "alice", got.Subject)
+	revoke, err := leader.RevokeAPIKey(&api.RevokeAPIKeyRequest{Id: "k1"})
+	require.NoError(t, err)
+	require.True(t, revoke.Revoked)
+	_, err = leader.GetAPIKey("k1")
+	require.ErrorIs(t, err, db.ErrAPIKeyNotFound)
+}
+
+func TestStreamLayer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	layer := db.NewStreamLayer(ln, nil, nil)
+	defer layer.Close()
+
+	// a peer that doesn't send its first byte doesn't hold up the others
+	slow, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer slow.Close()
+
+	// a connection that isn't raft traffic is closed and skipped
+	other, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.Write([]byte("GET / HTTP/1.1\r\n"))
+	require.NoError(t, err)
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, err := layer.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+		close(accepted)
+	}()
+	// closed with unread data, the peer may see a reset instead of EOF
+	require.NoError(t, other.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = other.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.False(t, os.IsTimeout(err))
+
+	conn, err := layer.Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	var server net.Conn
+	select {
+	case conn, ok := <-accepted:
+		require.True(t, ok)
+		server = conn
+	case <-time.After(time.Second):
+		t.Fatal("the raft connection wasn't accepted")
+	}
+	defer server.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	b := make([]byte, 4)
+	_, err = io.ReadFull(server, b)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(b))
+}
+
+func newDistributedDB(t *testing.T, name string, bootstrap bool) *db.DistributedDB {
+	t.Helper()
+
+	return newDistributedDBWithOptions(t, name, bootstrap, db.Options{})
+}
+
+func newDistributedDBWithOptions(t *testing.T, name string, bootstrap bool, opts db.Options) *db.DistributedDB {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := db.Config{
+		StreamLayer: db.NewStreamLayer(ln, nil, nil),
+		Bootstrap:   bootstrap,
+		DB:          opts,
+	}
+	cfg.LocalID = raft.ServerID(name)
+	cfg.HeartbeatTimeout = 50 * time.Millisecond
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+	cfg.CommitTimeout = 5 * time.Millisecond
+	cfg.ReapInterval = 10 * time.Millisecond
+
+	distDB, err := db.NewDistributedDB(t.TempDir(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { distDB.Close() })
+
+	return distDB
+}
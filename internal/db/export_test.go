@@ -0,0 +1,9 @@
+package db
+
+// StoredKeys returns the number of keys held by the fsm, including the
+// expired keys that weren't reaped yet.
+func (d *DistributedDB) StoredKeys() int {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+	return d.db.data.Len()
+}
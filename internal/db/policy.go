@@ -0,0 +1,235 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ReservedPrefix starts the keys that memdist keeps for itself, they
+	// are replicated with the data but the clients can't reach them.
+	ReservedPrefix = "_memdist/"
+	// policyPrefix, rolePrefix and apiKeyPrefix start the keys of the
+	// access policies, of the role assignments and of the API keys.
+	policyPrefix = ReservedPrefix + "policies/"
+	rolePrefix   = ReservedPrefix + "roles/"
+	apiKeyPrefix = ReservedPrefix + "apikeys/"
+)
+
+// Reserved reports whether key belongs to the reserved keyspace.
+func Reserved(key string) bool {
+	return strings.HasPrefix(key, ReservedPrefix)
+}
+
+// ruleKey joins the fields of a rule under prefix, the fields can't hold a
+// NUL so two rules never share a key. The empty trailing fields are left
+// out, the policies stored before they had a Domain keep their key.
+func ruleKey(prefix string, fields ...string) string {
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return prefix + strings.Join(fields, "\x00")
+}
+
+func policyKey(p *api.Policy) string {
+	return ruleKey(policyPrefix, p.Subject, p.Object, p.Action, p.Domain)
+}
+
+func roleKey(r *api.RoleAssignment) string {
+	return ruleKey(rolePrefix, r.Subject, r.Role, r.Domain)
+}
+
+// ValidatePolicy returns an InvalidArgument error when a field of the
+// policy is missing or holds a NUL, or when its key exceeds the limit.
+func (o Options) ValidatePolicy(p *api.Policy) error {
+	if p == nil || p.Subject == "" || p.Object == "" || p.Action == "" {
+		return status.Error(codes.InvalidArgument, "the Policy needs a Subject, an Object and an Action")
+	}
+	return o.validateRule(policyKey(p), p.Subject, p.Object, p.Action, p.Domain)
+}
+
+// ValidateRole is ValidatePolicy for the role assignments.
+func (o Options) ValidateRole(r *api.RoleAssignment) error {
+	if r == nil || r.Subject == "" || r.Role == "" {
+		return status.Error(codes.InvalidArgument, "the RoleAssignment needs a Subject and a Role")
+	}
+	return o.validateRule(roleKey(r), r.Subject, r.Role, r.Domain)
+}
+
+func (o Options) validateRule(key string, fields ...string) error {
+	for _, field := range fields {
+		if strings.ContainsRune(field, 0) {
+			return status.Error(codes.InvalidArgument, "the fields of the rules can't hold a NUL")
+		}
+	}
+	return o.Validate(key, nil)
+}
+
+func (db *DB) AddPolicy(req *api.AddPolicyRequest) (*api.AddPolicyResponse, error) {
+	if err := db.opts.ValidatePolicy(req.Policy); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.addPolicy(req, db.next())
+}
+
+// addPolicy stores the policy, the caller must hold the lock.
+func (db *DB) addPolicy(req *api.AddPolicyRequest, o op) (*api.AddPolicyResponse, error) {
+	added, err := db.addRule(&entry{key: policyKey(req.Policy), version: o.index}, req.Policy, o)
+	if err != nil {
+		return nil, err
+	}
+	return &api.AddPolicyResponse{Added: added}, nil
+}
+
+func (db *DB) RemovePolicy(req *api.RemovePolicyRequest) (*api.RemovePolicyResponse, error) {
+	if err := db.opts.ValidatePolicy(req.Policy); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.removePolicy(req, db.next()), nil
+}
+
+// removePolicy deletes the policy, the caller must hold the lock.
+func (db *DB) removePolicy(req *api.RemovePolicyRequest, o op) *api.RemovePolicyResponse {
+	return &api.RemovePolicyResponse{Removed: db.removeRule(policyKey(req.Policy), o)}
+}
+
+// ListPolicies returns the stored policies ordered by subject, object,
+// action and domain.
+func (db *DB) ListPolicies(req *api.ListPoliciesRequest) (*api.ListPoliciesResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return &api.ListPoliciesResponse{Policies: db.policies(now())}, nil
+}
+
+func (db *DB) AddRole(req *api.AddRoleRequest) (*api.AddRoleResponse, error) {
+	if err := db.opts.ValidateRole(req.Role); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.addRole(req, db.next())
+}
+
+// addRole stores the role assignment, the caller must hold the lock.
+func (db *DB) addRole(req *api.AddRoleRequest, o op) (*api.AddRoleResponse, error) {
+	added, err := db.addRule(&entry{key: roleKey(req.Role), version: o.index}, req.Role, o)
+	if err != nil {
+		return nil, err
+	}
+	return &api.AddRoleResponse{Added: added}, nil
+}
+
+func (db *DB) RemoveRole(req *api.RemoveRoleRequest) (*api.RemoveRoleResponse, error) {
+	if err := db.opts.ValidateRole(req.Role); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.removeRole(req, db.next()), nil
+}
+
+// removeRole deletes the role assignment, the caller must hold the lock.
+func (db *DB) removeRole(req *api.RemoveRoleRequest, o op) *api.RemoveRoleResponse {
+	return &api.RemoveRoleResponse{Removed: db.removeRule(roleKey(req.Role), o)}
+}
+
+// ListRoles returns the stored role assignments ordered by subject, role
+// and domain.
+func (db *DB) ListRoles(req *api.ListRolesRequest) (*api.ListRolesResponse, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return &api.ListRolesResponse{Roles: db.roles(now())}, nil
+}
+
+// addRule stores rule as the value of e unless its key is taken, and
+// hands the policies to OnPolicies when it was added. The caller must hold
+// the lock.
+func (db *DB) addRule(e *entry, rule proto.Message, o op) (bool, error) {
+	defer db.applied(o)
+	if _, ok := db.live(e.key, o.now); ok {
+		return false, nil
+	}
+
+	var err error
+	if e.value, err = proto.Marshal(rule); err != nil {
+		return false, err
+	}
+	db.put(e)
+	if !strings.HasPrefix(e.key, apiKeyPrefix) {
+		db.notifyPolicies(o.now)
+	}
+
+	return true, nil
+}
+
+// removeRule deletes the rule stored under key, and hands the policies to
+// OnPolicies when it existed. The caller must hold the lock.
+func (db *DB) removeRule(key string, o op) bool {
+	defer db.applied(o)
+	if _, ok := db.live(key, o.now); !ok {
+		return false
+	}
+
+	db.remove(key, o)
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		db.notifyPolicies(o.now)
+	}
+
+	return true
+}
+
+// policies decodes the stored policies, the caller must hold the lock.
+func (db *DB) policies(now int64) []*api.Policy {
+	return rules(db, policyPrefix, now, func() *api.Policy { return &api.Policy{} })
+}
+
+// roles decodes the stored role assignments, the caller must hold the
+// lock.
+func (db *DB) roles(now int64) []*api.RoleAssignment {
+	return rules(db, rolePrefix, now, func() *api.RoleAssignment { return &api.RoleAssignment{} })
+}
+
+// apiKeys decodes the live API keys, the caller must hold the lock.
+func (db *DB) apiKeys(now int64) []*api.APIKey {
+	return rules(db, apiKeyPrefix, now, func() *api.APIKey { return &api.APIKey{} })
+}
+
+// rules decodes the rules under prefix that are live at now, the writes
+// applied from the raft log pass the clock of the leader so every node
+// sees the same rules.
+func rules[T proto.Message](db *DB, prefix string, now int64, newRule func() T) []T {
+	var rules []T
+	db.data.AscendRange(&entry{key: prefix}, &entry{key: prefixEnd(prefix)}, func(e *entry) bool {
+		if e.expired(now) {
+			return true
+		}
+		rule := newRule()
+		// the values were written by addRule
+		if err := proto.Unmarshal(e.value, rule); err == nil {
+			rules = append(rules, rule)
+		}
+		return true
+	})
+	return rules
+}
+
+// notifyPolicies hands the rules live at now to OnPolicies. It runs while
+// holding the lock, so the calls follow the order of the writes. The caller
+// must hold the lock.
+func (db *DB) notifyPolicies(now int64) {
+	if db.opts.OnPolicies != nil {
+		db.opts.OnPolicies(db.policies(now), db.roles(now))
+	}
+}
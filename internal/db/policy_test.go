@@ -0,0 +1,181 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDbPolicies(t *testing.T) {
+	var notified [][]*api.Policy
+	data := db.NewDB(db.Options{
+		OnPolicies: func(policies []*api.Policy, _ []*api.RoleAssignment) {
+			notified = append(notified, policies)
+		},
+	})
+
+	alice := &api.Policy{Subject: "alice", Object: "billing/*", Action: "get"}
+	bob := &api.Policy{Subject: "bob", Object: "*", Action: "set"}
+
+	add, err := data.AddPolicy(&api.AddPolicyRequest{Policy: bob})
+	require.NoError(t, err)
+	require.True(t, add.Added)
+	add, err = data.AddPolicy(&api.AddPolicyRequest{Policy: alice})
+	require.NoError(t, err)
+	require.True(t, add.Added)
+
+	// adding a policy twice changes nothing
+	add, err = data.AddPolicy(&api.AddPolicyRequest{Policy: alice})
+	require.NoError(t, err)
+	require.False(t, add.Added)
+	require.Len(t, notified, 2)
+
+	list, err := data.ListPolicies(&api.ListPoliciesRequest{})
+	require.NoError(t, err)
+	requirePolicies(t, []*api.Policy{alice, bob}, list.Policies)
+	requirePolicies(t, []*api.Policy{alice, bob}, notified[1])
+
+	for _, p := range []*api.Policy{
+		nil,
+		{Subject: "alice", Object: "billing/*"},
+		{Subject: "alice\x00", Object: "billing/*", Action: "get"},
+	} {
+		_, err = data.AddPolicy(&api.AddPolicyRequest{Policy: p})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	// the policies are stored under the reserved keys, so they travel with
+	// the snapshots
+	var keys []string
+	_, err = data.Scan(&api.ScanRequest{}, func(r *api.Record) error {
+		keys = append(keys, r.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	for _, key := range keys {
+		require.True(t, db.Reserved(key))
+	}
+
+	restored := db.NewDB(db.Options{
+		OnPolicies: func(policies []*api.Policy, _ []*api.RoleAssignment) {
+			notified = append(notified, policies)
+		},
+	})
+	require.NoError(t, restored.Restore(data.Read()))
+	requirePolicies(t, []*api.Policy{alice, bob}, notified[len(notified)-1])
+
+	remove, err := data.RemovePolicy(&api.RemovePolicyRequest{Policy: bob})
+	require.NoError(t, err)
+	require.True(t, remove.Removed)
+	remove, err = data.RemovePolicy(&api.RemovePolicyRequest{Policy: bob})
+	require.NoError(t, err)
+	require.False(t, remove.Removed)
+	requirePolicies(t, []*api.Policy{alice}, notified[len(notified)-1])
+}
+
+func TestDbRoles(t *testing.T) {
+	var roles []*api.RoleAssignment
+	data := db.NewDB(db.Options{
+		OnPolicies: func(_ []*api.Policy, r []*api.RoleAssignment) {
+			roles = r
+		},
+	})
+
+	everywhere := &api.RoleAssignment{Subject: "alice", Role: "readers"}
+	tenantA := &api.RoleAssignment{Subject: "alice", Role: "readers", Domain: "tenant-a"}
+	for _, role := range []*api.RoleAssignment{everywhere, tenantA} {
+		add, err := data.AddRole(&api.AddRoleRequest{Role: role})
+		require.NoError(t, err)
+		require.True(t, add.Added)
+	}
+	require.Len(t, roles, 2)
+
+	list, err := data.ListRoles(&api.ListRolesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Roles, 2)
+	require.True(t, proto.Equal(everywhere, list.Roles[0]))
+	require.True(t, proto.Equal(tenantA, list.Roles[1]))
+
+	// the domain tells the policies apart too
+	for _, domain := range []string{"", "tenant-a"} {
+		add, err := data.AddPolicy(&api.AddPolicyRequest{
+			Policy: &api.Policy{Subject: "readers", Object: "*", Action: "get", Domain: domain},
+		})
+		require.NoError(t, err)
+		require.True(t, add.Added)
+	}
+
+	remove, err := data.RemoveRole(&api.RemoveRoleRequest{Role: tenantA})
+	require.NoError(t, err)
+	require.True(t, remove.Removed)
+	require.Len(t, roles, 1)
+
+	_, err = data.AddRole(&api.AddRoleRequest{Role: &api.RoleAssignment{Subject: "alice"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDbAPIKeys(t *testing.T) {
+	notified := 0
+	data := db.NewDB(db.Options{
+		OnPolicies: func([]*api.Policy, []*api.RoleAssignment) { notified++ },
+	})
+
+	key := &api.APIKey{Id: "k1", Hash: []byte("hash"), Subject: "alice", Roles: []string{"readers"}}
+	require.NoError(t, data.AddAPIKey(&api.AddAPIKeyRequest{Key: key}))
+	err := data.AddAPIKey(&api.AddAPIKeyRequest{Key: key})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	// the keys don't change the policies
+	require.Zero(t, notified)
+
+	got, err := data.GetAPIKey("k1")
+	require.NoError(t, err)
+	require.True(t, proto.Equal(key, got))
+	_, err = data.GetAPIKey("k2")
+	require.ErrorIs(t, err, db.ErrAPIKeyNotFound)
+
+	// the keys with a ttl expire like the other keys
+	expiring := &api.APIKey{Id: "k2", Hash: []byte("hash"), Subject: "bob"}
+	require.NoError(t, data.AddAPIKey(&api.AddAPIKeyRequest{Key: expiring, Ttl: 60_000}))
+	got, err = data.GetAPIKey("k2")
+	require.NoError(t, err)
+	require.Greater(t, got.ExpireAt, int64(0))
+
+	list, err := data.ListAPIKeys(&api.ListAPIKeysRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Keys, 2)
+	for _, k := range list.Keys {
+		require.Empty(t, k.Hash)
+	}
+
+	revoke, err := data.RevokeAPIKey(&api.RevokeAPIKeyRequest{Id: "k1"})
+	require.NoError(t, err)
+	require.True(t, revoke.Revoked)
+	revoke, err = data.RevokeAPIKey(&api.RevokeAPIKeyRequest{Id: "k1"})
+	require.NoError(t, err)
+	require.False(t, revoke.Revoked)
+	_, err = data.GetAPIKey("k1")
+	require.ErrorIs(t, err, db.ErrAPIKeyNotFound)
+
+	for _, req := range []*api.AddAPIKeyRequest{
+		{},
+		{Key: &api.APIKey{Id: "k3", Subject: "carol"}},
+		{Key: &api.APIKey{Id: "k3", Hash: []byte("hash"), Subject: "carol"}, Ttl: -1},
+	} {
+		require.Equal(t, codes.InvalidArgument, status.Code(data.AddAPIKey(req)))
+	}
+}
+
+func requirePolicies(t *testing.T, expected, actual []*api.Policy) {
+	t.Helper()
+
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		require.True(t, proto.Equal(expected[i], actual[i]), "%v != %v", expected[i], actual[i])
+	}
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultWatchHistory is the number of events kept to serve the
+	// watches that start at a past revision.
+	DefaultWatchHistory = 1 << 12
+
+	// watchBuffer is the number of events a watcher can fall behind before
+	// it is cancelled.
+	watchBuffer = 256
+)
+
+// Watcher receives the events of the keys it watches. When it falls too far
+// behind, or the database is restored from a snapshot, its channel is
+// closed and Err reports why.
+type Watcher struct {
+	key    string
+	prefix bool
+	events chan *api.Event
+	hub    *watchHub
+	// err and last are guarded by the lock of the hub.
+	err error
+	// last is the revision of the last event sent to the channel.
+	last uint64
+}
+
+// Events returns the channel of events, it is closed when the watcher is
+// cancelled or closed.
+func (w *Watcher) Events() <-chan *api.Event {
+	return w.events
+}
+
+// Err returns the reason the watcher was cancelled, nil if it wasn't.
+func (w *Watcher) Err() error {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	return w.err
+}
+
+// Close stops the delivery of events.
+func (w *Watcher) Close() {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	if _, ok := w.hub.watchers[w]; ok {
+		delete(w.hub.watchers, w)
+		close(w.events)
+	}
+}
+
+func (w *Watcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// watchHub keeps the latest events in a ring and hands the new ones to the
+// watchers. It never blocks the writes: a watcher that can't keep up is
+// cancelled.
+type watchHub struct {
+	mu       sync.Mutex
+	history  []*api.Event
+	next     int
+	count    int
+	watchers map[*Watcher]struct{}
+	// compacted is the newest revision with events missing from the
+	// history.
+	compacted uint64
+}
+
+func newWatchHub(size int) *watchHub {
+	return &watchHub{
+		history:  make([]*api.Event, size),
+		watchers: make(map[*Watcher]struct{}),
+	}
+}
+
+// publish records the event and sends it to the watchers of its key, the
+// caller must hold the lock of the database so the events keep the order
+// of the log.
+func (h *watchHub) publish(event *api.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == len(h.history) {
+		h.compacted = h.history[h.next].Revision
+	} else {
+		h.count++
+	}
+	h.history[h.next] = event
+	h.next = (h.next + 1) % len(h.history)
+
+	for w := range h.watchers {
+		if !w.matches(event.Record.Key) {
+			continue
+		}
+		select {
+		case w.events <- event:
+			w.last = event.Revision
+		default:
+			h.cancel(w, status.Error(
+				codes.ResourceExhausted,
+				fmt.Sprintf("the watcher fell behind, watch again from revision %d", w.last+1),
+			))
+		}
+	}
+}
+
+// watch registers a watcher and queues the retained events from start on,
+// it fails when some of them were already dropped.
+func (h *watchHub) watch(req *api.WatchRequest) (*Watcher, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w := &Watcher{
+		key:    req.Key,
+		prefix: req.Prefix,
+		hub:    h,
+	}
+
+	var replay []*api.Event
+	if req.StartRevision != 0 {
+		if req.StartRevision <= h.compacted {
+			return nil, status.Error(codes.OutOfRange, fmt.Sprintf(
+				"revision %d was compacted, the oldest revision available is %d",
+				req.StartRevision, h.compacted+1,
+			))
+		}
+		first := h.next - h.count + len(h.history)
+		for i := 0; i < h.count; i++ {
+			event := h.history[(first+i)%len(h.history)]
+			if event.Revision >= req.StartRevision && w.matches(event.Record.Key) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	w.events = make(chan *api.Event, len(replay)+watchBuffer)
+	for _, event := range replay {
+		w.events <- event
+		w.last = event.Revision
+	}
+	h.watchers[w] = struct{}{}
+
+	return w, nil
+}
+
+// reset drops the history and cancels every watcher, the events they
+// missed are not in the snapshot that replaced the database. The revisions
+// up to index can't be watched anymore.
+func (h *watchHub) reset(index uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for w := range h.watchers {
+		h.cancel(w, status.Error(
+			codes.Aborted,
+			"the database was restored from a snapshot, watch it again",
+		))
+	}
+	clear(h.history)
+	h.next, h.count = 0, 0
+	h.compacted = index
+}
+
+// cancel closes the channel of the watcher, the caller must hold the lock.
+func (h *watchHub) cancel(w *Watcher, err error) {
+	w.err = err
+	delete(h.watchers, w)
+	close(w.events)
+}
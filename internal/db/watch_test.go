@@ -0,0 +1,119 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWatch(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	key, err := data.Watch(&api.WatchRequest{Key: "foo"})
+	require.NoError(t, err)
+	defer key.Close()
+	prefix, err := data.Watch(&api.WatchRequest{Key: "user/", Prefix: true})
+	require.NoError(t, err)
+	defer prefix.Close()
+
+	set, err := data.Set(&api.SetRequest{Key: "foo", Value: []byte("bar")})
+	require.NoError(t, err)
+	_, err = data.Set(&api.SetRequest{Key: "user/1", Value: []byte("john")})
+	require.NoError(t, err)
+	_, err = data.Delete(&api.DeleteRequest{Key: "foo"})
+	require.NoError(t, err)
+	// deleting a missing key changes nothing
+	_, err = data.Delete(&api.DeleteRequest{Key: "foo"})
+	require.NoError(t, err)
+
+	event := receive(t, key)
+	require.Equal(t, api.Event_PUT, event.Type)
+	require.Equal(t, []byte("bar"), event.Record.Value)
+	require.Equal(t, set.Version, event.Revision)
+	event = receive(t, key)
+	require.Equal(t, api.Event_DELETE, event.Type)
+	require.Equal(t, set.Version+2, event.Revision)
+
+	event = receive(t, prefix)
+	require.Equal(t, "user/1", event.Record.Key)
+
+	select {
+	case event := <-key.Events():
+		t.Fatalf("unexpected event: %v", event)
+	default:
+	}
+
+	// a watch can start at a past revision
+	replay, err := data.Watch(&api.WatchRequest{Key: "foo", StartRevision: set.Version + 1})
+	require.NoError(t, err)
+	defer replay.Close()
+	event = receive(t, replay)
+	require.Equal(t, api.Event_DELETE, event.Type)
+}
+
+func TestWatchHistory(t *testing.T) {
+	data := db.NewDB(db.Options{WatchHistory: 2})
+
+	for i := 0; i < 3; i++ {
+		_, err := data.Set(&api.SetRequest{Key: "foo", Value: []byte("bar")})
+		require.NoError(t, err)
+	}
+
+	// only the last two revisions are retained
+	_, err := data.Watch(&api.WatchRequest{Key: "foo", StartRevision: 1})
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+
+	w, err := data.Watch(&api.WatchRequest{Key: "foo", StartRevision: 2})
+	require.NoError(t, err)
+	defer w.Close()
+	require.Equal(t, uint64(2), receive(t, w).Revision)
+	require.Equal(t, uint64(3), receive(t, w).Revision)
+
+	// restoring a snapshot cancels the watchers and drops the history
+	require.NoError(t, data.Restore(data.Read()))
+	_, ok := <-w.Events()
+	require.False(t, ok)
+	require.Equal(t, codes.Aborted, status.Code(w.Err()))
+
+	_, err = data.Watch(&api.WatchRequest{Key: "foo", StartRevision: 3})
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+}
+
+func TestWatchSlowWatcher(t *testing.T) {
+	data := db.NewDB(db.Options{})
+
+	w, err := data.Watch(&api.WatchRequest{Key: "foo"})
+	require.NoError(t, err)
+	defer w.Close()
+
+	// nobody reads the events, the writes must not block
+	for i := 0; i < 1000; i++ {
+		_, err := data.Set(&api.SetRequest{Key: "foo", Value: []byte("bar")})
+		require.NoError(t, err)
+	}
+
+	var received int
+	for range w.Events() {
+		received++
+	}
+	require.Less(t, received, 1000)
+	require.Equal(t, codes.ResourceExhausted, status.Code(w.Err()))
+}
+
+func receive(t *testing.T, w *db.Watcher) *api.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-w.Events():
+		require.True(t, ok, w.Err())
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package discovery
 import (
 	"net"
 
+	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
 	"go.uber.org/zap"
 )
@@ -118,15 +119,21 @@ func (m *Membership) Leave() error {
 	return err
 }
 
+// Shutdown stops the serf agent without notifying the other members, it
+// should be called after Leave.
+func (m *Membership) Shutdown() error {
+	return m.serf.Shutdown()
+}
+
 func (m *Membership) isLocal(member serf.Member) bool {
 	return m.serf.LocalMember().Name == member.Name
 }
 
 func (m *Membership) logError(err error, msg string, member serf.Member) {
 	log := m.logger.Error
-	// if err == raft.ErrNotLeader {
-	// 	log = m.logger.Debug
-	// }
+	if err == raft.ErrNotLeader {
+		log = m.logger.Debug
+	}
 	log(
 		msg,
 		zap.Error(err),
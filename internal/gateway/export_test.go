@@ -0,0 +1,4 @@
+package gateway
+
+// CodeName exposes codeName to the tests.
+var CodeName = codeName
@@ -0,0 +1,397 @@
+// Package gateway serves the database over HTTP with JSON bodies, for the
+// clients that can't use gRPC.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/dunielm02/memdist/internal/server"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	getAction    = "get"
+	setAction    = "set"
+	deleteAction = "delete"
+)
+
+type Config struct {
+	// Data serves the requests.
+	Data       server.KeyValueDb
+	Authorizer server.Authorizer
+	// Forwarder is optional, when it is set the writes received by a
+	// follower are sent to the leader on behalf of the subject of the
+	// request. Without it the followers reject them.
+	Forwarder *server.Forwarder
+	// Limits are checked before the requests reach Data, zero values use
+	// the database defaults.
+	Limits db.Options
+	// Authenticator returns the subject of the requests that carry
+	// credentials, nil authenticates the client certificates only. The
+	// requests without credentials are anonymous.
+	Authenticator auth.Authenticator
+	// Audit is optional, it logs the decisions of the authorizer. Unlike
+	// the ones of the gRPC server, the records have no raft index.
+	Audit *audit.Logger
+}
+
+type gateway struct {
+	Config
+}
+
+// New returns the handler of the gateway. The subject of a request is given
+// by Authenticator from its verified client certificate or from its
+// Authorization: Bearer header.
+//
+//	GET    /v1/keys/{key}   the value of key, raw with Accept: application/octet-stream
+//	PUT    /v1/keys/{key}   stores the body as the value of key
+//	DELETE /v1/keys/{key}   removes key
+//	GET    /v1/scan         the records of a range, as server-sent events
+//	GET    /v1/watch/{key}  the changes of key, or of a prefix, as server-sent events
+func New(cfg Config) http.Handler {
+	cfg.Limits = cfg.Limits.WithDefaults()
+	if cfg.Authenticator == nil {
+		cfg.Authenticator = auth.MTLS{}
+	}
+	g := &gateway{Config: cfg}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/keys/{key...}", g.get)
+	mux.HandleFunc("PUT /v1/keys/{key...}", g.set)
+	mux.HandleFunc("DELETE /v1/keys/{key...}", g.delete)
+	mux.HandleFunc("GET /v1/scan", g.scan)
+	mux.HandleFunc("GET /v1/watch/{key...}", g.watch)
+
+	return g.authenticate(mux)
+}
+
+// record is the JSON form of a record, the values are encoded in base64.
+type record struct {
+	Key      string `json:"key"`
+	Value    []byte `json:"value"`
+	Version  uint64 `json:"version,omitempty"`
+	ExpireAt int64  `json:"expire_at,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+func recordOf(r *api.Record) record {
+	return record{
+		Key:      r.Key,
+		Value:    r.Value,
+		Version:  r.Version,
+		ExpireAt: r.ExpireAt,
+		Type:     strings.ToLower(r.Type.String()),
+	}
+}
+
+func (g *gateway) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if err := g.authorize(r, key, getAction); err != nil {
+		writeError(w, err)
+		return
+	}
+	consistency, err := parseConsistency(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res, err := g.Data.Get(&api.GetRequest{Key: key, Consistency: consistency})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("X-Memdist-Version", strconv.FormatUint(res.Version, 10))
+	if r.Header.Get("Accept") == "application/octet-stream" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(res.Value)
+		return
+	}
+	writeJSON(w, http.StatusOK, record{Key: key, Value: res.Value, Version: res.Version})
+}
+
+// set stores the raw body of the request. The query sets the time to live
+// (ttl, a duration or a number of milliseconds) and the preconditions
+// (if_version, if_absent and if_present).
+func (g *gateway) set(w http.ResponseWriter, r *http.Request) {
+	req := &api.SetRequest{Key: r.PathValue("key")}
+	if err := g.authorize(r, req.Key, setAction); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// one byte more than the limit is enough to report it
+	value, err := io.ReadAll(io.LimitReader(r.Body, int64(g.Limits.MaxValueSize)+1))
+	if err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	req.Value = value
+	if err := g.Limits.Validate(req.Key, req.Value); err != nil {
+		writeError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	if ttl := query.Get("ttl"); ttl != "" {
+		if req.Ttl, err = parseTTL(ttl); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if req.Precondition, err = parsePrecondition(query); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res, err := g.data(r).Set(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Version uint64 `json:"version"`
+	}{res.Version})
+}
+
+// delete accepts the same preconditions as set.
+func (g *gateway) delete(w http.ResponseWriter, r *http.Request) {
+	req := &api.DeleteRequest{Key: r.PathValue("key")}
+	if err := g.authorize(r, req.Key, deleteAction); err != nil {
+		writeError(w, err)
+		return
+	}
+	var err error
+	if req.Precondition, err = parsePrecondition(r.URL.Query()); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := g.data(r).Delete(req); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// data returns the database that serves the requests of the caller.
+func (g *gateway) data(r *http.Request) server.KeyValueDb {
+	return g.Forwarder.Data(g.Data, subject(r))
+}
+
+// authorize checks whether the caller may perform act on key, the key is the
+// object of the policies.
+func (g *gateway) authorize(r *http.Request, key string, act string) error {
+	err := g.Authorizer.Authorize(subject(r), key, act)
+	g.audit(r, key, act, err)
+	return err
+}
+
+// audit records a decision of authorize.
+func (g *gateway) audit(r *http.Request, key, act string, err error) {
+	if g.Audit == nil {
+		return
+	}
+	sub := subject(r)
+	record := audit.Record{
+		Subject:  sub.Name,
+		Roles:    sub.Roles,
+		Tenant:   sub.Tenant,
+		Action:   act,
+		Key:      key,
+		Decision: audit.Allow,
+		Peer:     r.RemoteAddr,
+		Method:   r.Method + " " + r.URL.Path,
+	}
+	if err != nil {
+		record.Decision = audit.Deny
+		record.Error = status.Convert(err).Message()
+	}
+	g.Audit.Log(record)
+}
+
+// filter checks whether the caller may read an event of a watch, the events
+// aren't audited one by one.
+func (g *gateway) filter(r *http.Request, key string) error {
+	return g.Authorizer.Authorize(subject(r), key, getAction)
+}
+
+const (
+	// tenantHeader picks the tenant of a request, like the gRPC metadata.
+	tenantHeader = "Memdist-Tenant"
+	bearerScheme = "bearer "
+)
+
+type subjectKey struct{}
+
+// authenticate finds the subject once per request, the streams authorize
+// each of their records with it.
+func (g *gateway) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		creds := credentials(r)
+		sub, err := g.Authenticator.Authenticate(r.Context(), creds)
+		if err == auth.ErrNoCredentials {
+			sub, err = auth.Subject{Tenant: creds.Tenant}, nil
+		}
+		if err != nil {
+			g.Audit.Log(audit.Record{
+				Decision: audit.Deny,
+				Peer:     r.RemoteAddr,
+				Method:   r.Method + " " + r.URL.Path,
+				Error:    status.Convert(err).Message(),
+			})
+			writeError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), subjectKey{}, sub)))
+	})
+}
+
+// credentials returns the chains of the client certificate, they are only
+// verified when the server requires the certificates, and the bearer token.
+func credentials(r *http.Request) auth.Credentials {
+	creds := auth.Credentials{Tenant: r.Header.Get(tenantHeader)}
+	if r.TLS != nil {
+		creds.Chains = r.TLS.VerifiedChains
+	}
+	value := r.Header.Get("Authorization")
+	if len(value) > len(bearerScheme) && strings.EqualFold(value[:len(bearerScheme)], bearerScheme) {
+		creds.Token = value[len(bearerScheme):]
+	}
+	return creds
+}
+
+func subject(r *http.Request) auth.Subject {
+	sub, _ := r.Context().Value(subjectKey{}).(auth.Subject)
+	return sub
+}
+
+func parseConsistency(r *http.Request) (api.Consistency, error) {
+	value := r.URL.Query().Get("consistency")
+	if value == "" {
+		return api.Consistency_STALE, nil
+	}
+	consistency, ok := api.Consistency_value[strings.ToUpper(value)]
+	if !ok {
+		return 0, status.Errorf(codes.InvalidArgument, "unknown consistency: %s", value)
+	}
+	return api.Consistency(consistency), nil
+}
+
+// parseTTL accepts a duration or a number of milliseconds.
+func parseTTL(ttl string) (int64, error) {
+	if ms, err := strconv.ParseInt(ttl, 10, 64); err == nil {
+		if ms < 0 {
+			return 0, status.Error(codes.InvalidArgument, "the ttl can't be negative")
+		}
+		return ms, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d < 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid ttl: %s", ttl)
+	}
+	return d.Milliseconds(), nil
+}
+
+func parsePrecondition(query url.Values) (*api.Precondition, error) {
+	var cond api.Precondition
+	var err error
+	if v := query.Get("if_version"); v != "" {
+		if cond.IfVersion, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid if_version: %s", v)
+		}
+	}
+	for name, field := range map[string]*bool{"if_absent": &cond.IfAbsent, "if_present": &cond.IfPresent} {
+		if v := query.Get(name); v != "" {
+			if *field, err = strconv.ParseBool(v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s", name, v)
+			}
+		}
+	}
+	if cond.IfVersion == 0 && !cond.IfAbsent && !cond.IfPresent {
+		return nil, nil
+	}
+	return &cond, nil
+}
+
+// errorBody is the body of the failed requests, code is the name of the
+// gRPC status code, such as NOT_FOUND.
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		zap.L().Error("gateway request failed", zap.Error(err))
+		st = status.New(codes.Internal, err.Error())
+	}
+	writeJSON(w, httpStatus(st.Code()), errorBody{
+		Code:    codeName(st.Code()),
+		Message: st.Message(),
+	})
+}
+
+// codeName returns the name of the code as written in the gRPC
+// specification, NotFound becomes NOT_FOUND and Canceled CANCELLED.
+func codeName(c codes.Code) string {
+	if name, ok := code.Code_name[int32(c)]; ok {
+		return name
+	}
+	return strings.ToUpper(c.String())
+}
+
+// httpStatus maps the gRPC codes to the HTTP status codes like grpc-gateway
+// does, except for the failed preconditions which are mostly caused by the
+// if_* parameters.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	// the client is gone when the body can't be written
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,281 @@
+package gateway_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/dunielm02/memdist/internal/gateway"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGateway(t *testing.T) {
+	url, root, nobody := setup(t)
+
+	res := do(t, root, http.MethodPut, url+"/v1/keys/users/1?ttl=1m", "john")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var set struct{ Version uint64 }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&set))
+	require.NotZero(t, set.Version)
+
+	res = do(t, root, http.MethodGet, url+"/v1/keys/users/1", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var record struct {
+		Key     string
+		Value   []byte
+		Version uint64
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&record))
+	require.Equal(t, "users/1", record.Key)
+	require.Equal(t, []byte("john"), record.Value)
+	require.Equal(t, set.Version, record.Version)
+
+	req, err := http.NewRequest(http.MethodGet, url+"/v1/keys/users/1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/octet-stream")
+	res, err = root.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, "john", string(body))
+
+	// the errors carry the gRPC code
+	res = do(t, root, http.MethodPut, url+"/v1/keys/users/1?if_absent=true", "jane")
+	requireError(t, res, http.StatusPreconditionFailed, "FAILED_PRECONDITION")
+	res = do(t, root, http.MethodGet, url+"/v1/keys/users/2", "")
+	requireError(t, res, http.StatusNotFound, "NOT_FOUND")
+	res = do(t, root, http.MethodPut, url+"/v1/keys/users/2?ttl=soon", "jane")
+	requireError(t, res, http.StatusBadRequest, "INVALID_ARGUMENT")
+	res = do(t, nobody, http.MethodGet, url+"/v1/keys/users/1", "")
+	requireError(t, res, http.StatusForbidden, "PERMISSION_DENIED")
+
+	// the policies grant nobody a prefix
+	res = do(t, nobody, http.MethodPut, url+"/v1/keys/public/nobody/1", "mine")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	res = do(t, nobody, http.MethodPut, url+"/v1/keys/public/1", "theirs")
+	requireError(t, res, http.StatusForbidden, "PERMISSION_DENIED")
+
+	res = do(t, root, http.MethodDelete, url+"/v1/keys/users/1", "")
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	res = do(t, root, http.MethodGet, url+"/v1/keys/users/1", "")
+	requireError(t, res, http.StatusNotFound, "NOT_FOUND")
+}
+
+func TestGatewayScan(t *testing.T) {
+	url, root, nobody := setup(t)
+
+	for _, key := range []string{"users/1", "users/2", "users/3", "zone"} {
+		res := do(t, root, http.MethodPut, url+"/v1/keys/"+key, key)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	res := do(t, root, http.MethodGet, url+"/v1/scan?prefix=users/&limit=2", "")
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	events := readEvents(t, bufio.NewReader(res.Body), 3)
+	require.Equal(t, "record", events[0].name)
+	require.Contains(t, events[0].data, `"key":"users/1"`)
+	require.Contains(t, events[1].data, `"key":"users/2"`)
+	require.Equal(t, "end", events[2].name)
+	var end struct{ Token string }
+	require.NoError(t, json.Unmarshal([]byte(events[2].data), &end))
+	require.NotEmpty(t, end.Token)
+
+	res = do(t, root, http.MethodGet, url+"/v1/scan?prefix=users/&token="+end.Token, "")
+	events = readEvents(t, bufio.NewReader(res.Body), 2)
+	require.Contains(t, events[0].data, `"key":"users/3"`)
+	require.Equal(t, `{}`, events[1].data)
+
+	// the denied records are left out
+	res = do(t, root, http.MethodPut, url+"/v1/keys/public/news", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	res = do(t, nobody, http.MethodGet, url+"/v1/scan", "")
+	events = readEvents(t, bufio.NewReader(res.Body), 2)
+	require.Contains(t, events[0].data, `"key":"public/news"`)
+	require.Equal(t, "end", events[1].name)
+}
+
+func TestGatewayWatch(t *testing.T) {
+	url, root, nobody := setup(t)
+
+	res := do(t, root, http.MethodGet, url+"/v1/watch/users/?prefix=true", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	defer res.Body.Close()
+	r := bufio.NewReader(res.Body)
+
+	do(t, root, http.MethodPut, url+"/v1/keys/users/1", "john")
+	do(t, root, http.MethodPut, url+"/v1/keys/zone", "eu")
+	do(t, root, http.MethodDelete, url+"/v1/keys/users/1", "")
+
+	events := readEvents(t, r, 2)
+	require.Equal(t, "put", events[0].name)
+	require.Contains(t, events[0].data, `"key":"users/1"`)
+	require.Equal(t, "delete", events[1].name)
+	require.NotEqual(t, events[0].id, events[1].id)
+
+	res = do(t, nobody, http.MethodGet, url+"/v1/watch/users/?prefix=true", "")
+	requireError(t, res, http.StatusForbidden, "PERMISSION_DENIED")
+}
+
+func TestGatewayBearer(t *testing.T) {
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var records []audit.Record
+	srv := httptest.NewServer(gateway.New(gateway.Config{
+		Data:       db.NewDB(db.Options{}),
+		Authorizer: authorizer,
+		Authenticator: auth.AuthenticatorFunc(func(ctx context.Context, creds auth.Credentials) (auth.Subject, error) {
+			if creds.Token == "" {
+				return auth.Subject{}, auth.ErrNoCredentials
+			}
+			if creds.Token != "root-token" {
+				return auth.Subject{}, status.Error(codes.Unauthenticated, "invalid token")
+			}
+			return auth.Subject{Name: "root", Tenant: creds.Tenant}, nil
+		}),
+		Audit: audit.New(audit.Config{Sink: audit.SinkFunc(func(r audit.Record) error {
+			mu.Lock()
+			defer mu.Unlock()
+			records = append(records, r)
+			return nil
+		})}),
+	}))
+	t.Cleanup(srv.Close)
+
+	bearer := func(method, token string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+"/v1/keys/users/1", strings.NewReader("john"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := bearer(http.MethodPut, "root-token")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	res = bearer(http.MethodGet, "other-token")
+	requireError(t, res, http.StatusUnauthorized, "UNAUTHENTICATED")
+
+	// the requests without credentials stay anonymous
+	res = do(t, srv.Client(), http.MethodGet, srv.URL+"/v1/keys/users/1", "")
+	requireError(t, res, http.StatusForbidden, "PERMISSION_DENIED")
+
+	// each record read by a scan is audited
+	res = do(t, srv.Client(), http.MethodGet, srv.URL+"/v1/scan", "")
+	events := readEvents(t, bufio.NewReader(res.Body), 1)
+	require.Equal(t, "end", events[0].name)
+	mu.Lock()
+	defer mu.Unlock()
+	r := records[len(records)-1]
+	require.Equal(t, "users/1", r.Key)
+	require.Equal(t, audit.Deny, r.Decision)
+	require.Equal(t, "GET /v1/scan", r.Method)
+}
+
+func TestCodeName(t *testing.T) {
+	require.Equal(t, "NOT_FOUND", gateway.CodeName(codes.NotFound))
+	require.Equal(t, "CANCELLED", gateway.CodeName(codes.Canceled))
+	require.Equal(t, "UNAUTHENTICATED", gateway.CodeName(codes.Unauthenticated))
+}
+
+// setup starts a gateway and returns its URL, a client authenticated as
+// root and one authenticated as nobody.
+
+func setup(t *testing.T) (string, *http.Client, *http.Client) {
+	t.Helper()
+
+	serverTLSConfig, err := config.GetTlsConfig(config.TLSConfig{
+		CAFile:   config.CAFile,
+		KeyFile:  config.ServerKeyFile,
+		CertFile: config.ServerCertFile,
+		Server:   true,
+	})
+	require.NoError(t, err)
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(gateway.New(gateway.Config{
+		Data:       db.NewDB(db.Options{}),
+		Authorizer: authorizer,
+	}))
+	srv.TLS = serverTLSConfig
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	newClient := func(cert, key string) *http.Client {
+		clientTLSConfig, err := config.GetTlsConfig(config.TLSConfig{
+			CertFile: cert,
+			KeyFile:  key,
+			CAFile:   config.CAFile,
+		})
+		require.NoError(t, err)
+		transport := &http.Transport{TLSClientConfig: clientTLSConfig}
+		t.Cleanup(transport.CloseIdleConnections)
+		return &http.Client{Transport: transport}
+	}
+
+	return srv.URL,
+		newClient(config.RootCertFile, config.RootKeyFile),
+		newClient(config.NobodyCertFile, config.NobodyKeyFile)
+}
+
+func do(t *testing.T, client *http.Client, method, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	return res
+}
+
+func requireError(t *testing.T, res *http.Response, code int, name string) {
+	t.Helper()
+	require.Equal(t, code, res.StatusCode)
+	var body struct{ Code, Message string }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	require.Equal(t, name, body.Code)
+	require.NotEmpty(t, body.Message)
+}
+
+type event struct {
+	id, name, data string
+}
+
+// readEvents reads n events, skipping the comments.
+func readEvents(t *testing.T, r *bufio.Reader, n int) []event {
+	t.Helper()
+	var events []event
+	var e event
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			e.id = value
+		case "event":
+			e.name = value
+		case "data":
+			e.data = value
+		case "":
+			if e.name != "" {
+				events = append(events, e)
+			}
+			e = event{}
+		}
+	}
+	return events
+}
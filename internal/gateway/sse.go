@@ -0,0 +1,220 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// keepAliveInterval is the time between the comments sent on an idle watch,
+// they keep the proxies from closing the stream.
+const keepAliveInterval = 15 * time.Second
+
+// events writes server-sent events, the headers are sent along with the
+// first one so the errors found before it get a regular response.
+type events struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func newEvents(w http.ResponseWriter) *events {
+	return &events{w: w, rc: http.NewResponseController(w)}
+}
+
+func (e *events) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	e.w.Header().Set("Content-Type", "text/event-stream")
+	e.w.Header().Set("Cache-Control", "no-cache")
+	e.w.WriteHeader(http.StatusOK)
+	return e.rc.Flush()
+}
+
+// send writes an event whose data is v encoded in JSON, id is left out when
+// empty.
+func (e *events) send(id, event string, v any) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(e.w, "id: %s\n", id)
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return e.rc.Flush()
+}
+
+// fail reports err as a response before the stream starts and as an error
+// event after.
+func (e *events) fail(err error) {
+	if !e.started {
+		writeError(e.w, err)
+		return
+	}
+	st := status.Convert(err)
+	_ = e.send("", "error", errorBody{Code: codeName(st.Code()), Message: st.Message()})
+}
+
+// scan sends a record event by record of the range and ends with an end
+// event, which holds the continuation token when the limit stopped the scan.
+// Each record is authorized and audited on its own.
+// The query holds the fields of api.ScanRequest: start, end, prefix, limit,
+// reverse, token and consistency.
+func (g *gateway) scan(w http.ResponseWriter, r *http.Request) {
+	e := newEvents(w)
+	req, err := parseScan(r)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	token, err := g.Data.Scan(req, func(rec *api.Record) error {
+		if err := g.authorize(r, rec.Key, getAction); err != nil {
+			if status.Code(err) == codes.PermissionDenied {
+				return db.SkipRecord
+			}
+			return err
+		}
+		return e.send("", "record", recordOf(rec))
+	})
+	if err != nil {
+		e.fail(err)
+		return
+	}
+
+	end := struct {
+		Token string `json:"token,omitempty"`
+	}{}
+	if token != nil {
+		end.Token = base64.RawURLEncoding.EncodeToString(token)
+	}
+	_ = e.send("", "end", end)
+}
+
+func parseScan(r *http.Request) (*api.ScanRequest, error) {
+	query := r.URL.Query()
+	req := &api.ScanRequest{
+		Start:  query.Get("start"),
+		End:    query.Get("end"),
+		Prefix: query.Get("prefix"),
+	}
+	var err error
+	if req.Consistency, err = parseConsistency(r); err != nil {
+		return nil, err
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid limit: %s", v)
+		}
+		req.Limit = uint32(limit)
+	}
+	if v := query.Get("reverse"); v != "" {
+		if req.Reverse, err = strconv.ParseBool(v); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid reverse: %s", v)
+		}
+	}
+	if v := query.Get("token"); v != "" {
+		if req.ContinuationToken, err = base64.RawURLEncoding.DecodeString(v); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid token: %s", v)
+		}
+	}
+	return req, nil
+}
+
+// watch sends an event by change of the watched keys, named after the type
+// of the change and identified by its revision. The query may set prefix
+// and start_revision, a reconnecting EventSource resumes after the revision
+// of its Last-Event-ID.
+func (g *gateway) watch(w http.ResponseWriter, r *http.Request) {
+	e := newEvents(w)
+	req, err := parseWatch(r)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	if err := g.authorize(r, req.Key, getAction); err != nil {
+		e.fail(err)
+		return
+	}
+
+	watcher, err := g.Data.Watch(req)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	defer watcher.Close()
+	// the headers tell the client that the watch is in place
+	if err := e.start(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := e.rc.Flush(); err != nil {
+				return
+			}
+		case event, ok := <-watcher.Events():
+			if !ok {
+				e.fail(watcher.Err())
+				return
+			}
+			if err := g.filter(r, event.Record.Key); err != nil {
+				continue
+			}
+			id := strconv.FormatUint(event.Revision, 10)
+			name := strings.ToLower(event.Type.String())
+			if err := e.send(id, name, recordOf(event.Record)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func parseWatch(r *http.Request) (*api.WatchRequest, error) {
+	query := r.URL.Query()
+	req := &api.WatchRequest{Key: r.PathValue("key")}
+	var err error
+	if v := query.Get("prefix"); v != "" {
+		if req.Prefix, err = strconv.ParseBool(v); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid prefix: %s", v)
+		}
+	}
+	if v := query.Get("start_revision"); v != "" {
+		if req.StartRevision, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid start_revision: %s", v)
+		}
+	}
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		last, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid Last-Event-ID: %s", v)
+		}
+		req.StartRevision = last + 1
+	}
+	return req, nil
+}
@@ -0,0 +1,293 @@
+package memcache
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// version is reported by the version command, the clients expect the
+// version of a memcached server.
+const version = "1.6.0"
+
+// maxRelativeExptime is the largest exptime taken as a number of seconds,
+// the larger ones are unix timestamps.
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+type command struct {
+	// storage commands are followed by a data block
+	storage bool
+	// act is checked against the policies for every key of the command
+	// before running it, the commands without one are open to every client.
+	act string
+	// keys is the number of arguments that are keys, -1 when they all are.
+	keys int
+	fn   func(c *conn, args []string, data []byte) error
+}
+
+var commands = map[string]command{
+	"get":       {false, getAction, -1, get(false)},
+	"gets":      {false, getAction, -1, get(true)},
+	"set":       {true, setAction, 1, store(nil)},
+	"add":       {true, setAction, 1, store(&api.Precondition{IfAbsent: true})},
+	"replace":   {true, setAction, 1, store(&api.Precondition{IfPresent: true})},
+	"cas":       {true, setAction, 1, cas},
+	"delete":    {false, deleteAction, 1, del},
+	"incr":      {false, setAction, 1, incr(false)},
+	"decr":      {false, setAction, 1, incr(true)},
+	"touch":     {false, setAction, 1, touch},
+	"version":   {false, "", 0, versionCmd},
+	"verbosity": {false, "", 0, verbosity},
+	"quit":      {false, "", 0, quit},
+}
+
+// get returns the get command, or the gets command when cas is true.
+func get(cas bool) func(c *conn, args []string, data []byte) error {
+	return func(c *conn, args []string, data []byte) error {
+		if len(args) == 0 {
+			return errFormat
+		}
+		if err := c.s.Limits.ValidateBatch(len(args)); err != nil {
+			return err
+		}
+		res, err := c.data.MultiGet(&api.MultiGetRequest{Keys: args})
+		if err != nil {
+			return err
+		}
+
+		// the missing keys, and the ones holding another type, are left
+		// out
+		for i, result := range res.Results {
+			if result.Error != nil {
+				continue
+			}
+			c.w.WriteString("VALUE " + args[i] + " " + strconv.FormatUint(uint64(result.Flags), 10) +
+				" " + strconv.Itoa(len(result.Value)))
+			if cas {
+				c.w.WriteString(" " + strconv.FormatUint(result.Version, 10))
+			}
+			c.w.WriteString("\r\n")
+			c.w.Write(result.Value)
+			c.w.WriteString("\r\n")
+		}
+		c.w.WriteString("END\r\n")
+		return nil
+	}
+}
+
+// storeRequest parses the arguments of the storage commands: key flags
+// exptime bytes.
+func (c *conn) storeRequest(args []string, data []byte) (*api.SetRequest, error) {
+	flags, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return nil, errFormat
+	}
+	ttl, err := parseExptime(args[2])
+	if err != nil {
+		return nil, err
+	}
+	req := &api.SetRequest{Key: args[0], Value: data, Flags: uint32(flags), Ttl: ttl}
+	if err := c.s.Limits.Validate(req.Key, req.Value); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// store returns the set command, or add and replace depending on cond.
+func store(cond *api.Precondition) func(c *conn, args []string, data []byte) error {
+	return func(c *conn, args []string, data []byte) error {
+		if len(args) != 4 {
+			return errFormat
+		}
+		req, err := c.storeRequest(args, data)
+		if err != nil {
+			return err
+		}
+		req.Precondition = cond
+
+		_, err = c.data.Set(req)
+		if cond != nil && status.Code(err) == codes.FailedPrecondition {
+			c.reply("NOT_STORED")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.reply("STORED")
+		return nil
+	}
+}
+
+// cas stores the value if the version of the key is still the cas unique
+// returned by gets: key flags exptime bytes unique.
+func cas(c *conn, args []string, data []byte) error {
+	if len(args) != 5 {
+		return errFormat
+	}
+	req, err := c.storeRequest(args, data)
+	if err != nil {
+		return err
+	}
+	unique, err := strconv.ParseUint(args[4], 10, 64)
+	if err != nil {
+		return errFormat
+	}
+	// a zero version would disable the check, no key has it
+	if unique == 0 {
+		unique = math.MaxUint64
+	}
+	req.Precondition = &api.Precondition{IfPresent: true, IfVersion: unique}
+
+	_, err = c.data.Set(req)
+	if status.Code(err) == codes.FailedPrecondition {
+		if currentVersion(err) == 0 {
+			c.reply("NOT_FOUND")
+		} else {
+			c.reply("EXISTS")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.reply("STORED")
+	return nil
+}
+
+// currentVersion returns the version of the key reported by a failed
+// precondition, zero when the key doesn't exist.
+func currentVersion(err error) uint64 {
+	for _, detail := range status.Convert(err).Details() {
+		if failure, ok := detail.(*api.ConditionFailure); ok {
+			return failure.CurrentVersion
+		}
+	}
+	return 0
+}
+
+// del accepts the legacy form with a zero time: delete key [0].
+func del(c *conn, args []string, data []byte) error {
+	if len(args) == 2 && args[1] == "0" {
+		args = args[:1]
+	}
+	if len(args) != 1 {
+		return errFormat
+	}
+
+	_, err := c.data.Delete(&api.DeleteRequest{
+		Key:          args[0],
+		Precondition: &api.Precondition{IfPresent: true},
+	})
+	if status.Code(err) == codes.FailedPrecondition {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.reply("DELETED")
+	return nil
+}
+
+// incr returns the incr command, or decr when decr is true. The values are
+// unsigned: the increments wrap around and the decrements stop at zero.
+func incr(decr bool) func(c *conn, args []string, data []byte) error {
+	return func(c *conn, args []string, data []byte) error {
+		if len(args) != 2 {
+			return errFormat
+		}
+		delta, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil || delta > math.MaxInt64 {
+			return clientError("invalid numeric delta argument")
+		}
+		req := &api.IncrRequest{Key: args[0], Delta: int64(delta), Unsigned: true}
+		if decr {
+			req.Delta = -req.Delta
+		}
+		if err := c.s.Limits.Validate(req.Key, nil); err != nil {
+			return err
+		}
+
+		res, err := c.data.Incr(req)
+		switch {
+		case status.Code(err) == codes.NotFound:
+			c.reply("NOT_FOUND")
+			return nil
+		case errors.Is(err, db.ErrNotInteger):
+			return clientError("cannot increment or decrement non-numeric value")
+		case err != nil:
+			return err
+		}
+		c.reply(strconv.FormatUint(uint64(res.Value), 10))
+		return nil
+	}
+}
+
+// touch replaces the exptime of a key: touch key exptime.
+func touch(c *conn, args []string, data []byte) error {
+	if len(args) != 2 {
+		return errFormat
+	}
+	ttl, err := parseExptime(args[1])
+	if err != nil {
+		return err
+	}
+
+	if ttl == 0 {
+		_, err = c.data.Persist(&api.PersistRequest{Key: args[0]})
+	} else {
+		_, err = c.data.Expire(&api.ExpireRequest{Key: args[0], Ttl: ttl})
+	}
+	if status.Code(err) == codes.NotFound {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.reply("TOUCHED")
+	return nil
+}
+
+func versionCmd(c *conn, args []string, data []byte) error {
+	c.reply("VERSION " + version)
+	return nil
+}
+
+func verbosity(c *conn, args []string, data []byte) error {
+	c.reply("OK")
+	return nil
+}
+
+func quit(c *conn, args []string, data []byte) error {
+	c.quit = true
+	return nil
+}
+
+// parseExptime converts an exptime to a time to live in milliseconds. Zero
+// never expires, up to 30 days it is a number of seconds and past that a
+// unix timestamp. The exptimes in the past expire the key right away.
+func parseExptime(arg string) (int64, error) {
+	exptime, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || exptime > math.MaxInt64/1000 {
+		return 0, errFormat
+	}
+	var ttl int64
+	switch {
+	case exptime == 0:
+		return 0, nil
+	case exptime <= maxRelativeExptime:
+		ttl = exptime * 1000
+	default:
+		ttl = exptime*1000 - time.Now().UnixMilli()
+	}
+	// a zero time to live keeps the key, the shortest one expires it as
+	// soon as possible
+	return max(ttl, 1), nil
+}
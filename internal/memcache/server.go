@@ -0,0 +1,323 @@
+// Package memcache serves the database over the memcached text protocol, so
+// the memcached clients can store their values in the cluster.
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/dunielm02/memdist/internal/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	getAction    = "get"
+	setAction    = "set"
+	deleteAction = "delete"
+
+	// maxLineSize bounds the command lines, the data blocks are bounded by
+	// the size limits.
+	maxLineSize = 64 << 10
+)
+
+// ErrServerClosed is returned by Serve once the server is closed.
+var ErrServerClosed = errors.New("memcache: server closed")
+
+type Config struct {
+	// Data serves the commands.
+	Data       server.KeyValueDb
+	Authorizer server.Authorizer
+	// Forwarder is optional, when it is set the writes received by a
+	// follower are sent to the leader on behalf of the subject of the
+	// connection. Without it the followers reject them.
+	Forwarder *server.Forwarder
+	// Limits are checked before the requests reach Data, zero values use
+	// the database defaults.
+	Limits db.Options
+	// Audit is optional, it logs the decisions of Authorizer with the
+	// address of the client.
+	Audit *audit.Logger
+}
+
+type Server struct {
+	Config
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+func New(cfg Config) *Server {
+	cfg.Limits = cfg.Limits.WithDefaults()
+	return &Server{
+		Config:    cfg,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts the connections of ln until the server is closed. The text
+// protocol has no authentication, the subject of a connection is the
+// common name of its client certificate when ln is wrapped by
+// tls.NewListener.
+func (s *Server) Serve(ln net.Listener) error {
+	if !track(s, s.listeners, ln) {
+		return ErrServerClosed
+	}
+	defer untrack(s, s.listeners, ln)
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !track(s, s.conns, c) {
+			c.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer untrack(s, s.conns, c)
+			s.handle(c)
+		}()
+	}
+}
+
+// Close stops the listeners and closes the open connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return nil
+}
+
+// track adds v to set unless the server is closed.
+func track[T comparable](s *Server, set map[T]struct{}, v T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	set[v] = struct{}{}
+	return true
+}
+
+func untrack[T comparable](s *Server, set map[T]struct{}, v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(set, v)
+}
+
+// conn holds the state of a client connection.
+type conn struct {
+	s       *Server
+	r       *bufio.Reader
+	w       *bufio.Writer
+	subject auth.Subject
+	// data serves the commands of subject
+	data server.KeyValueDb
+	// authorizer audits the decisions of the connection
+	authorizer server.Authorizer
+	quit       bool
+	// noreply is set by the commands that shouldn't reply
+	noreply bool
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+
+	cn := &conn{
+		s:          s,
+		r:          bufio.NewReaderSize(c, maxLineSize),
+		w:          bufio.NewWriter(c),
+		authorizer: s.Audit.Authorizer(s.Authorizer, "memcache", c.RemoteAddr().String()),
+	}
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		// the chains are only verified when the server requires the
+		// client certificates, the connections use the default tenant
+		if chains := tlsConn.ConnectionState().VerifiedChains; len(chains) > 0 {
+			cn.subject = auth.SubjectOf(chains[0][0], "")
+		}
+	}
+	cn.data = s.Forwarder.Data(s.Data, cn.subject)
+
+	for !cn.quit {
+		line, err := cn.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			cn.w.WriteString("CLIENT_ERROR line too long\r\n")
+			cn.w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		args := strings.Fields(string(bytes.TrimRight(line, "\r\n")))
+		if len(args) == 0 {
+			cn.w.WriteString("ERROR\r\n")
+		} else if err := cn.exec(args); err != nil {
+			// the data block couldn't be read
+			return
+		}
+		// the replies of a pipeline are sent together
+		if cn.r.Buffered() == 0 {
+			if err := cn.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	cn.w.Flush()
+}
+
+// exec runs a command, it only fails when the connection can't be used
+// anymore.
+func (c *conn) exec(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+	c.noreply = false
+	if n := len(args); n > 1 && args[n-1] == "noreply" {
+		c.noreply = true
+		args = args[:n-1]
+	}
+
+	// the data block is read first so the stream stays in sync when the
+	// command fails
+	var data []byte
+	if cmd.storage {
+		var err error
+		if data, err = c.readData(args[1:]); err != nil {
+			if errors.Is(err, errConn) {
+				return err
+			}
+			c.reply(replyError(err))
+			return nil
+		}
+	}
+
+	var err error
+	if cmd.act != "" {
+		err = c.authorizeCommand(cmd, args[1:])
+	}
+	if err == nil {
+		err = cmd.fn(c, args[1:], data)
+	}
+	if err != nil {
+		c.reply(replyError(err))
+	}
+	return nil
+}
+
+// readData reads the data block following a storage command, its size is
+// the fourth argument.
+func (c *conn) readData(args []string) ([]byte, error) {
+	if len(args) < 4 {
+		return nil, errFormat
+	}
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		return nil, errFormat
+	}
+	if size > c.s.Limits.MaxValueSize {
+		if _, err := io.CopyN(io.Discard, c.r, int64(size)+2); err != nil {
+			return nil, errConn
+		}
+		return nil, errTooLarge
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, errConn
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return nil, errChunk
+	}
+	return data[:size], nil
+}
+
+// reply writes a line unless the command was sent with noreply.
+func (c *conn) reply(line string) {
+	if c.noreply {
+		return
+	}
+	c.w.WriteString(line)
+	c.w.WriteString("\r\n")
+}
+
+// authorizeCommand checks whether the subject of the connection may perform
+// the action of cmd on each of its keys.
+func (c *conn) authorizeCommand(cmd command, args []string) error {
+	keys := args
+	if cmd.keys >= 0 && cmd.keys < len(args) {
+		keys = args[:cmd.keys]
+	}
+	for _, key := range keys {
+		if err := c.authorizer.Authorize(c.subject, key, cmd.act); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientError is replied as a CLIENT_ERROR.
+type clientError string
+
+func (e clientError) Error() string {
+	return string(e)
+}
+
+var (
+	errFormat = clientError("bad command line format")
+	errChunk  = clientError("bad data chunk")
+	// errTooLarge is a SERVER_ERROR, like in memcached
+	errTooLarge = status.Error(codes.ResourceExhausted, "object too large for cache")
+	// errConn stops the connection, the stream can't be parsed anymore
+	errConn = errors.New("broken connection")
+)
+
+// replyError converts err to the reply sent to the client, the errors
+// caused by the request are client errors.
+func replyError(err error) string {
+	var ce clientError
+	if errors.As(err, &ce) {
+		return "CLIENT_ERROR " + string(ce)
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		zap.L().Error("memcache command failed", zap.Error(err))
+		return "SERVER_ERROR " + err.Error()
+	}
+	switch st.Code() {
+	case codes.InvalidArgument, codes.OutOfRange, codes.PermissionDenied, codes.FailedPrecondition:
+		return "CLIENT_ERROR " + st.Message()
+	}
+	return "SERVER_ERROR " + st.Message()
+}
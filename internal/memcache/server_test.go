@@ -0,0 +1,163 @@
+package memcache_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/dunielm02/memdist/internal/memcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemcache(t *testing.T) {
+	root, nobody := setup(t)
+
+	require.Equal(t, "STORED", root.do(t, "set foo 42 0 3", "bar"))
+	require.Equal(t, "VALUE foo 42 3\r\nbar\r\nEND", root.do(t, "get foo missing"))
+	require.Equal(t, "END", root.do(t, "get missing"))
+
+	// add and replace map to the preconditions
+	require.Equal(t, "NOT_STORED", root.do(t, "add foo 0 0 3", "baz"))
+	require.Equal(t, "NOT_STORED", root.do(t, "replace missing 0 0 3", "baz"))
+	require.Equal(t, "STORED", root.do(t, "add bar 0 0 1", "1"))
+
+	// cas compares the unique returned by gets
+	gets := root.do(t, "gets foo")
+	fields := strings.Fields(strings.SplitN(gets, "\r\n", 2)[0])
+	require.Len(t, fields, 5)
+	unique := fields[4]
+	require.Equal(t, "STORED", root.do(t, "cas foo 7 0 3 "+unique, "baz"))
+	require.Equal(t, "EXISTS", root.do(t, "cas foo 7 0 3 "+unique, "qux"))
+	require.Equal(t, "NOT_FOUND", root.do(t, "cas missing 0 0 3 1", "qux"))
+	require.Equal(t, "VALUE foo 7 3\r\nbaz\r\nEND", root.do(t, "get foo"))
+
+	// the counters are unsigned
+	require.Equal(t, "11", root.do(t, "incr bar 10"))
+	require.Equal(t, "0", root.do(t, "decr bar 20"))
+	require.Equal(t, "NOT_FOUND", root.do(t, "incr missing 1"))
+	require.Equal(t, "CLIENT_ERROR cannot increment or decrement non-numeric value", root.do(t, "incr foo 1"))
+
+	require.Equal(t, "TOUCHED", root.do(t, "touch foo 100"))
+	require.Equal(t, "NOT_FOUND", root.do(t, "touch missing 100"))
+	require.Equal(t, "DELETED", root.do(t, "delete foo"))
+	require.Equal(t, "NOT_FOUND", root.do(t, "delete foo"))
+
+	// a past exptime expires the key right away
+	require.Equal(t, "STORED", root.do(t, "set gone 0 -1 1", "x"))
+	require.Eventually(t, func() bool {
+		return root.do(t, "get gone") == "END"
+	}, time.Second, 10*time.Millisecond)
+
+	// noreply skips the reply, the next command gets its own
+	root.send(t, "set quiet 0 0 1 noreply", "q")
+	require.Equal(t, "VALUE quiet 0 1\r\nq\r\nEND", root.do(t, "get quiet"))
+
+	require.Equal(t, "ERROR", root.do(t, "flush_all"))
+	// like memcached, the rest of a bad chunk is read as a command
+	require.Equal(t, "CLIENT_ERROR bad data chunk", root.do(t, "set foo 0 0 1", "toolong"))
+	line, err := root.r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ERROR\r\n", line)
+	require.True(t, strings.HasPrefix(root.do(t, "version"), "VERSION "))
+
+	require.True(t, strings.HasPrefix(nobody.do(t, "get quiet"), "CLIENT_ERROR"))
+	require.True(t, strings.HasPrefix(nobody.do(t, "set foo 0 0 3", "bar"), "CLIENT_ERROR"))
+	require.True(t, strings.HasPrefix(nobody.do(t, "version"), "VERSION "))
+
+	// every key is authorized, nobody writes public/nobody/* and reads
+	// public/*
+	require.Equal(t, "STORED", nobody.do(t, "set public/nobody/1 0 0 4", "mine"))
+	require.True(t, strings.HasPrefix(nobody.do(t, "set public/1 0 0 6", "theirs"), "CLIENT_ERROR"))
+	require.Equal(t, "VALUE public/nobody/1 0 4\r\nmine\r\nEND", nobody.do(t, "get public/nobody/1"))
+	require.True(t, strings.HasPrefix(nobody.do(t, "get public/nobody/1 quiet"), "CLIENT_ERROR"))
+}
+
+func TestMemcacheLimits(t *testing.T) {
+	root, _ := setup(t)
+
+	// the oversized value is skipped, the connection stays usable
+	value := strings.Repeat("x", db.DefaultMaxValueSize+1)
+	require.Equal(t, "SERVER_ERROR object too large for cache", root.do(t, "set big 0 0 "+strconv.Itoa(len(value)), value))
+	require.Equal(t, "END", root.do(t, "get big"))
+}
+
+func setup(t *testing.T) (*client, *client) {
+	t.Helper()
+
+	serverTLSConfig, err := config.GetTlsConfig(config.TLSConfig{
+		CAFile:   config.CAFile,
+		KeyFile:  config.ServerKeyFile,
+		CertFile: config.ServerCertFile,
+		Server:   true,
+	})
+	require.NoError(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+
+	srv := memcache.New(memcache.Config{
+		Data:       db.NewDB(db.Options{}),
+		Authorizer: authorizer,
+	})
+	go srv.Serve(tls.NewListener(ln, serverTLSConfig))
+	t.Cleanup(func() { srv.Close() })
+
+	newClient := func(cert, key string) *client {
+		clientTLSConfig, err := config.GetTlsConfig(config.TLSConfig{
+			CertFile: cert,
+			KeyFile:  key,
+			CAFile:   config.CAFile,
+		})
+		require.NoError(t, err)
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientTLSConfig)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return &client{conn: conn, r: bufio.NewReader(conn)}
+	}
+
+	return newClient(config.RootCertFile, config.RootKeyFile),
+		newClient(config.NobodyCertFile, config.NobodyKeyFile)
+}
+
+// client sends the commands and reads the replies as text.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// send writes a command line, followed by the data block if any.
+func (c *client) send(t *testing.T, line string, data ...string) {
+	t.Helper()
+	msg := line + "\r\n"
+	for _, d := range data {
+		msg += d + "\r\n"
+	}
+	_, err := c.conn.Write([]byte(msg))
+	require.NoError(t, err)
+}
+
+// do sends a command and returns its reply without the last line break,
+// the retrievals are read up to END.
+func (c *client) do(t *testing.T, line string, data ...string) string {
+	t.Helper()
+	c.send(t, line, data...)
+
+	var lines []string
+	for {
+		l, err := c.r.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSuffix(l, "\r\n"))
+		if !strings.HasPrefix(lines[0], "VALUE ") || lines[len(lines)-1] == "END" {
+			return strings.Join(lines, "\r\n")
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package resp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// version is the Redis version reported to the clients, some of them pick
+// the commands they send from it.
+const version = "7.0.0"
+
+type command struct {
+	// arity counts the name of the command, a negative arity is the
+	// minimum number of arguments.
+	arity int
+	// act is checked against the policies for every key of the command
+	// before running it, the commands without one are open to every client.
+	act  string
+	keys keySpec
+	fn   func(c *conn, args [][]byte) error
+}
+
+// keySpec tells which arguments are keys, like the key specifications of
+// Redis: every step arguments from first to last, a negative last counting
+// from the end. The arguments count the name of the command.
+type keySpec struct {
+	first, last, step int
+}
+
+var (
+	noKeys   = keySpec{}
+	oneKey   = keySpec{1, 1, 1}
+	allKeys  = keySpec{1, -1, 1}
+	keyPairs = keySpec{1, -1, 2}
+)
+
+func (k keySpec) keys(args [][]byte) [][]byte {
+	if k.step == 0 {
+		return nil
+	}
+	last := k.last
+	if last < 0 {
+		last += len(args)
+	}
+	var keys [][]byte
+	for i := k.first; i <= last && i < len(args); i += k.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+var commands = map[string]command{
+	"ping":    {-1, "", noKeys, ping},
+	"echo":    {2, "", noKeys, echo},
+	"hello":   {-1, "", noKeys, hello},
+	"auth":    {-2, "", noKeys, authCmd},
+	"select":  {2, "", noKeys, selectDB},
+	"client":  {-2, "", noKeys, client},
+	"command": {-1, "", noKeys, commandInfo},
+	"quit":    {1, "", noKeys, quit},
+	"info":    {-1, getAction, noKeys, info},
+
+	"get":     {2, getAction, oneKey, get},
+	"set":     {-3, setAction, oneKey, set},
+	"del":     {-2, deleteAction, allKeys, del},
+	"exists":  {-2, getAction, allKeys, exists},
+	"mget":    {-2, getAction, allKeys, mget},
+	"mset":    {-3, setAction, keyPairs, mset},
+	"expire":  {3, setAction, oneKey, expire(time.Second)},
+	"pexpire": {3, setAction, oneKey, expire(time.Millisecond)},
+	"persist": {2, setAction, oneKey, persist},
+	"ttl":     {2, getAction, oneKey, ttl(time.Second)},
+	"pttl":    {2, getAction, oneKey, ttl(time.Millisecond)},
+	"type":    {2, getAction, oneKey, typeOf},
+	// the keys the client can't read are left out of the scans
+	"keys": {2, "", noKeys, keys},
+	"scan": {-2, "", noKeys, scan},
+}
+
+func ping(c *conn, args [][]byte) error {
+	switch len(args) {
+	case 0:
+		c.w.simple("PONG")
+	case 1:
+		c.w.bulk(args[0])
+	default:
+		return errArgs("ping")
+	}
+	return nil
+}
+
+func echo(c *conn, args [][]byte) error {
+	c.w.bulk(args[0])
+	return nil
+}
+
+// hello switches the protocol version and optionally authenticates the
+// connection: HELLO [protover [AUTH username password] [SETNAME name]].
+func hello(c *conn, args [][]byte) error {
+	resp3 := c.w.resp3
+	if len(args) > 0 {
+		switch string(args[0]) {
+		case "2":
+			resp3 = false
+		case "3":
+			resp3 = true
+		default:
+			return redisError("NOPROTO unsupported protocol version")
+		}
+		args = args[1:]
+	}
+	for len(args) > 0 {
+		switch {
+		case strings.EqualFold(string(args[0]), "auth") && len(args) >= 3:
+			if err := c.login(string(args[1]), string(args[2])); err != nil {
+				return err
+			}
+			args = args[3:]
+		case strings.EqualFold(string(args[0]), "setname") && len(args) >= 2:
+			c.name = string(args[1])
+			args = args[2:]
+		default:
+			return errSyntax
+		}
+	}
+
+	c.w.resp3 = resp3
+	proto := int64(2)
+	if resp3 {
+		proto = 3
+	}
+	c.w.mapHeader(7)
+	c.w.bulkString("server")
+	c.w.bulkString("memdist")
+	c.w.bulkString("version")
+	c.w.bulkString(version)
+	c.w.bulkString("proto")
+	c.w.integer(proto)
+	c.w.bulkString("id")
+	c.w.integer(int64(c.id))
+	c.w.bulkString("mode")
+	c.w.bulkString("standalone")
+	c.w.bulkString("role")
+	c.w.bulkString("master")
+	c.w.bulkString("modules")
+	c.w.array(0)
+	return nil
+}
+
+// authCmd accepts both AUTH password and AUTH username password, the first
+// form authenticates the default user.
+func authCmd(c *conn, args [][]byte) error {
+	username, password := "default", string(args[0])
+	switch len(args) {
+	case 1:
+	case 2:
+		username, password = string(args[0]), string(args[1])
+	default:
+		return errArgs("auth")
+	}
+	if err := c.login(username, password); err != nil {
+		return err
+	}
+	c.w.simple("OK")
+	return nil
+}
+
+// login replaces the subject of the connection with the one of the
+// credentials.
+func (c *conn) login(username, password string) error {
+	if c.s.Authenticate == nil {
+		return redisError("ERR AUTH is not enabled, authenticate with a client certificate")
+	}
+	subject, err := c.s.Authenticate(username, password)
+	if err != nil {
+		return redisError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.subject = subject
+	return nil
+}
+
+// selectDB only accepts the database 0, there is a single keyspace.
+func selectDB(c *conn, args [][]byte) error {
+	if string(args[0]) != "0" {
+		return redisError("ERR DB index is out of range")
+	}
+	c.w.simple("OK")
+	return nil
+}
+
+func client(c *conn, args [][]byte) error {
+	switch strings.ToLower(string(args[0])) {
+	case "id":
+		c.w.integer(int64(c.id))
+	case "getname":
+		if c.name == "" {
+			c.w.null()
+		} else {
+			c.w.bulkString(c.name)
+		}
+	case "setname":
+		if len(args) != 2 {
+			return errArgs("client|setname")
+		}
+		c.name = string(args[1])
+		c.w.simple("OK")
+	case "setinfo":
+		// the libraries report their name and version, they aren't kept
+		c.w.simple("OK")
+	default:
+		return redisError("ERR unknown subcommand '" + string(args[0]) + "'")
+	}
+	return nil
+}
+
+// commandInfo replies with an empty list, the clients that inspect the
+// commands fall back to their defaults.
+func commandInfo(c *conn, args [][]byte) error {
+	c.w.array(0)
+	return nil
+}
+
+func quit(c *conn, args [][]byte) error {
+	c.quit = true
+	c.w.simple("OK")
+	return nil
+}
+
+func info(c *conn, args [][]byte) error {
+	c.s.mu.Lock()
+	clients := len(c.s.conns)
+	c.s.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	fmt.Fprintf(&b, "redis_version:%s\r\n", version)
+	b.WriteString("redis_mode:standalone\r\n")
+	b.WriteString("server_name:memdist\r\n")
+	b.WriteString("\r\n# Clients\r\n")
+	fmt.Fprintf(&b, "connected_clients:%d\r\n", clients)
+	c.w.bulkString(b.String())
+	return nil
+}
+
+func get(c *conn, args [][]byte) error {
+	res, err := c.data().Get(&api.GetRequest{Key: string(args[0])})
+	if status.Code(err) == codes.NotFound {
+		c.w.null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.w.bulk(res.Value)
+	return nil
+}
+
+// set supports SET key value [NX|XX] [EX seconds|PX milliseconds].
+func set(c *conn, args [][]byte) error {
+	req := &api.SetRequest{Key: string(args[0]), Value: args[1]}
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX", "XX":
+			if req.Precondition != nil {
+				return errSyntax
+			}
+			req.Precondition = &api.Precondition{IfAbsent: opt == "NX", IfPresent: opt == "XX"}
+		case "EX", "PX":
+			if req.Ttl != 0 || i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return errNotInteger
+			}
+			if n <= 0 || n > math.MaxInt64/1000 {
+				return redisError("ERR invalid expire time in 'set' command")
+			}
+			req.Ttl = n
+			if opt == "EX" {
+				req.Ttl = n * 1000
+			}
+		default:
+			return errSyntax
+		}
+	}
+	if err := c.s.Limits.Validate(req.Key, req.Value); err != nil {
+		return err
+	}
+
+	_, err := c.data().Set(req)
+	if req.Precondition != nil && status.Code(err) == codes.FailedPrecondition {
+		c.w.null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.w.simple("OK")
+	return nil
+}
+
+// del counts the keys it removes, the deletes only succeed on the keys
+// that exist.
+func del(c *conn, args [][]byte) error {
+	var n int64
+	for _, key := range args {
+		_, err := c.data().Delete(&api.DeleteRequest{
+			Key:          string(key),
+			Precondition: &api.Precondition{IfPresent: true},
+		})
+		if status.Code(err) == codes.FailedPrecondition {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	c.w.integer(n)
+	return nil
+}
+
+func exists(c *conn, args [][]byte) error {
+	var n int64
+	for _, key := range args {
+		_, err := c.data().TTL(&api.TTLRequest{Key: string(key)})
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	c.w.integer(n)
+	return nil
+}
+
+func mget(c *conn, args [][]byte) error {
+	req := &api.MultiGetRequest{}
+	for _, key := range args {
+		req.Keys = append(req.Keys, string(key))
+	}
+	if err := c.s.Limits.ValidateBatch(len(req.Keys)); err != nil {
+		return err
+	}
+	res, err := c.data().MultiGet(req)
+	if err != nil {
+		return err
+	}
+
+	c.w.array(len(res.Results))
+	for _, result := range res.Results {
+		// like Redis, the missing keys and the other types are nil
+		if result.Error != nil {
+			c.w.null()
+			continue
+		}
+		c.w.bulk(result.Value)
+	}
+	return nil
+}
+
+func mset(c *conn, args [][]byte) error {
+	if len(args)%2 != 0 {
+		return errArgs("mset")
+	}
+	req := &api.MultiSetRequest{}
+	for i := 0; i < len(args); i += 2 {
+		req.Items = append(req.Items, &api.SetRequest{Key: string(args[i]), Value: args[i+1]})
+	}
+	if err := c.s.Limits.ValidateBatch(len(req.Items)); err != nil {
+		return err
+	}
+	// MSET sets all the keys or none of them, the database would still write
+	// the valid items of a batch holding an invalid one
+	for _, item := range req.Items {
+		if err := c.s.Limits.Validate(item.Key, item.Value); err != nil {
+			return err
+		}
+	}
+	res, err := c.data().MultiSet(req)
+	if err != nil {
+		return err
+	}
+	for _, result := range res.Results {
+		if result.Error != nil {
+			return status.Error(codes.Code(result.Error.Code), result.Error.Message)
+		}
+	}
+	c.w.simple("OK")
+	return nil
+}
+
+// expire returns the EXPIRE command when unit is a second and PEXPIRE when
+// it is a millisecond.
+func expire(unit time.Duration) func(c *conn, args [][]byte) error {
+	return func(c *conn, args [][]byte) error {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return errNotInteger
+		}
+		_, err = c.data().Expire(&api.ExpireRequest{
+			Key: string(args[0]),
+			Ttl: n * int64(unit/time.Millisecond),
+		})
+		if status.Code(err) == codes.NotFound {
+			c.w.integer(0)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.w.integer(1)
+		return nil
+	}
+}
+
+func persist(c *conn, args [][]byte) error {
+	key := string(args[0])
+	res, err := c.data().TTL(&api.TTLRequest{Key: key})
+	if status.Code(err) == codes.NotFound || (err == nil && res.Ttl < 0) {
+		c.w.integer(0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := c.data().Persist(&api.PersistRequest{Key: key}); err != nil {
+		return err
+	}
+	c.w.integer(1)
+	return nil
+}
+
+// ttl returns the TTL command when unit is a second and PTTL when it is a
+// millisecond.
+func ttl(unit time.Duration) func(c *conn, args [][]byte) error {
+	return func(c *conn, args [][]byte) error {
+		res, err := c.data().TTL(&api.TTLRequest{Key: string(args[0])})
+		if status.Code(err) == codes.NotFound {
+			c.w.integer(-2)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if res.Ttl < 0 {
+			c.w.integer(-1)
+			return nil
+		}
+		ms := int64(unit / time.Millisecond)
+		c.w.integer((res.Ttl + ms/2) / ms)
+		return nil
+	}
+}
+
+func typeOf(c *conn, args [][]byte) error {
+	key := string(args[0])
+	// the scan is the only read returning the type of any key
+	typ := "none"
+	_, err := c.data().Scan(&api.ScanRequest{Start: key, End: key + "\x00"}, func(record *api.Record) error {
+		typ = typeName(record.Type)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.w.simple(typ)
+	return nil
+}
+
+func typeName(typ api.Type) string {
+	return strings.ToLower(typ.String())
+}
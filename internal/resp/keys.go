@@ -0,0 +1,231 @@
+package resp
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dunielm02/memdist/api/v1"
+)
+
+const (
+	// defaultScanCount is the number of keys returned by a SCAN without
+	// COUNT.
+	defaultScanCount = 10
+	// maxCursors bounds the number of SCAN cursors kept by the server, the
+	// oldest ones are forgotten first.
+	maxCursors = 1 << 12
+)
+
+func keys(c *conn, args [][]byte) error {
+	pattern := string(args[0])
+	var matches []string
+	_, err := c.data().Scan(&api.ScanRequest{Prefix: literalPrefix(pattern)}, func(record *api.Record) error {
+		if match(pattern, record.Key) && c.authorize(record.Key, getAction) == nil {
+			matches = append(matches, record.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.w.array(len(matches))
+	for _, key := range matches {
+		c.w.bulkString(key)
+	}
+	return nil
+}
+
+// scan supports SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]. Like
+// in Redis, COUNT bounds the keys visited, so a page can have fewer keys
+// than COUNT when MATCH or TYPE filters them.
+func scan(c *conn, args [][]byte) error {
+	req := &api.ScanRequest{Limit: defaultScanCount}
+	if string(args[0]) != "0" {
+		id, err := strconv.ParseUint(string(args[0]), 10, 64)
+		if err != nil {
+			return redisError("ERR invalid cursor")
+		}
+		token, ok := c.s.cursors.get(id)
+		if !ok {
+			return redisError("ERR invalid cursor")
+		}
+		req.ContinuationToken = token
+	}
+	pattern, typ := "*", ""
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errSyntax
+		}
+		value := string(args[i+1])
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = value
+		case "COUNT":
+			count, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || count == 0 {
+				return errNotInteger
+			}
+			req.Limit = uint32(count)
+		case "TYPE":
+			typ = strings.ToLower(value)
+		default:
+			return errSyntax
+		}
+	}
+	req.Prefix = literalPrefix(pattern)
+
+	var matches []string
+	token, err := c.data().Scan(req, func(record *api.Record) error {
+		if match(pattern, record.Key) && (typ == "" || typ == typeName(record.Type)) &&
+			c.authorize(record.Key, getAction) == nil {
+			matches = append(matches, record.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cursor := "0"
+	if token != nil {
+		cursor = strconv.FormatUint(c.s.cursors.add(token), 10)
+	}
+	c.w.array(2)
+	c.w.bulkString(cursor)
+	c.w.array(len(matches))
+	for _, key := range matches {
+		c.w.bulkString(key)
+	}
+	return nil
+}
+
+// cursors maps the numeric SCAN cursors expected by the clients to the
+// continuation tokens of the scans. They are shared by the connections
+// since the clients may continue a scan on another connection of their
+// pool.
+type cursors struct {
+	mu     sync.Mutex
+	last   uint64
+	tokens map[uint64][]byte
+	// order holds the cursors from the oldest to the newest
+	order []uint64
+}
+
+func (c *cursors) add(token []byte) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = make(map[uint64][]byte)
+	}
+	c.last++
+	c.tokens[c.last] = token
+	c.order = append(c.order, c.last)
+	if len(c.order) > maxCursors {
+		delete(c.tokens, c.order[0])
+		c.order = c.order[1:]
+	}
+	return c.last
+}
+
+func (c *cursors) get(id uint64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, ok := c.tokens[id]
+	return token, ok
+}
+
+// literalPrefix returns the part of the glob pattern before its first
+// special character, the scans are restricted to it.
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// match reports whether s matches the glob pattern the way Redis does: *
+// matches any sequence, ? any character, [...] a class of characters,
+// negated by ^, and \ escapes the next character.
+func match(pattern, s string) bool {
+	// on a mismatch the last * takes one more character of s and the rest
+	// of the pattern is tried again from there, the earlier stars never
+	// need to be revisited
+	star := false
+	var afterStar, rest string
+	for {
+		if len(pattern) == 0 {
+			if len(s) == 0 {
+				return true
+			}
+		} else {
+			switch pattern[0] {
+			case '*':
+				for len(pattern) > 0 && pattern[0] == '*' {
+					pattern = pattern[1:]
+				}
+				if len(pattern) == 0 {
+					return true
+				}
+				star, afterStar, rest = true, pattern, s
+				continue
+			case '?':
+				if len(s) > 0 {
+					pattern, s = pattern[1:], s[1:]
+					continue
+				}
+			case '[':
+				if len(s) > 0 {
+					if next, ok := matchClass(pattern[1:], s[0]); ok {
+						pattern, s = next, s[1:]
+						continue
+					}
+				}
+			default:
+				literal := pattern
+				if literal[0] == '\\' && len(literal) > 1 {
+					literal = literal[1:]
+				}
+				if len(s) > 0 && literal[0] == s[0] {
+					pattern, s = literal[1:], s[1:]
+					continue
+				}
+			}
+		}
+		if !star || len(rest) == 0 {
+			return false
+		}
+		rest = rest[1:]
+		pattern, s = afterStar, rest
+	}
+}
+
+// matchClass matches b against the class at the start of pattern, after
+// its opening bracket. It returns the pattern following the class.
+func matchClass(pattern string, b byte) (string, bool) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == b
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := min(pattern[0], pattern[2]), max(pattern[0], pattern[2])
+			matched = matched || (lo <= b && b <= hi)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == b
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// skip the closing bracket
+		pattern = pattern[1:]
+	}
+	return pattern, matched != negate
+}
@@ -0,0 +1,178 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/dunielm02/memdist/internal/db"
+)
+
+// preallocArgs bounds the arguments allocated up front for a command.
+const preallocArgs = 64
+
+// maxCommandSize is the size of the commands of the authenticated clients
+// unless the largest key and value take more, the default size of a gRPC
+// message.
+const maxCommandSize = 4 << 20
+
+// limits bound the commands read from a client.
+type limits struct {
+	// args is the number of arguments of a command, bulk the size of an
+	// argument and size the sum of the sizes of its arguments.
+	args, bulk, size int
+}
+
+// anonymous are the limits of the clients that haven't authenticated yet,
+// enough for AUTH and HELLO with a token, so they can't make the server
+// allocate much.
+var anonymous = limits{args: 16, bulk: 16 << 10, size: 64 << 10}
+
+// commandLimits returns the limits of the authenticated clients, enough for
+// the largest batch and the largest key and value of the database.
+func commandLimits(o db.Options) limits {
+	return limits{
+		// the name, the key and the pairs of a batch, like HSET
+		args: 2*o.MaxBatchSize + 2,
+		bulk: max(o.MaxKeySize, o.MaxValueSize),
+		size: max(o.MaxKeySize+o.MaxValueSize, maxCommandSize),
+	}
+}
+
+var errProtocol = errors.New("ERR Protocol error")
+
+// reader parses the commands sent by the clients: arrays of bulk strings,
+// or inline commands typed in a terminal.
+type reader struct {
+	r *bufio.Reader
+	// limits bound the next command
+	limits limits
+}
+
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > r.limits.args {
+		return nil, errProtocol
+	}
+	// the header isn't trusted with the allocation, the arguments that
+	// actually arrive grow the slice
+	args := make([][]byte, 0, min(max(n, 0), preallocArgs))
+	total := 0
+	for range n {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > r.limits.bulk {
+			return nil, errProtocol
+		}
+		// checked before the argument is allocated
+		total += size
+		if total > r.limits.size {
+			return nil, errProtocol
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r.r, arg); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, errProtocol
+		}
+		args = append(args, arg[:size])
+	}
+
+	return args, nil
+}
+
+// readLine returns a line without its terminator, the clients are expected
+// to end them with CRLF but a bare LF is accepted from the terminals.
+func (r *reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errProtocol
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+	return line, nil
+}
+
+// writer encodes the replies in the version of the protocol chosen by the
+// client, RESP2 unless it switched to RESP3 with HELLO.
+type writer struct {
+	w     *bufio.Writer
+	resp3 bool
+}
+
+func (w *writer) simple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) bulk(b []byte) {
+	w.header('$', len(b))
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) {
+	w.bulk([]byte(s))
+}
+
+func (w *writer) null() {
+	if w.resp3 {
+		w.w.WriteString("_\r\n")
+		return
+	}
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.header('*', n)
+}
+
+// mapHeader starts a map of n pairs, RESP2 sends them as a flat array.
+func (w *writer) mapHeader(n int) {
+	if w.resp3 {
+		w.header('%', n)
+		return
+	}
+	w.header('*', 2*n)
+}
+
+func (w *writer) header(prefix byte, n int) {
+	w.w.WriteByte(prefix)
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
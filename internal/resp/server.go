@@ -0,0 +1,293 @@
+// Package resp serves the database over the Redis protocol, RESP2 and RESP3,
+// so the Redis clients and tools can talk to a memdist node.
+package resp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/dunielm02/memdist/internal/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	getAction      = "get"
+	setAction      = "set"
+	deleteAction   = "delete"
+	objectWildCard = "*"
+)
+
+// ErrServerClosed is returned by Serve once the server is closed.
+var ErrServerClosed = errors.New("resp: server closed")
+
+type Config struct {
+	// Data serves the commands.
+	Data       server.KeyValueDb
+	Authorizer server.Authorizer
+	// Forwarder is optional, when it is set the writes received by a
+	// follower are sent to the leader on behalf of the subject of the
+	// connection. Without it the followers reject them.
+	Forwarder *server.Forwarder
+	// Limits are checked before the requests reach Data, zero values use
+	// the database defaults.
+	Limits db.Options
+	// Audit is optional, it logs the decisions of Authorizer with the
+	// address of the client.
+	Audit *audit.Logger
+	// Authenticate checks the credentials sent with AUTH and HELLO and
+	// returns the subject of the connection, which replaces the one of the
+	// client certificate. Without it the subject is the common name of the
+	// client certificate and AUTH is rejected.
+	Authenticate func(username, password string) (auth.Subject, error)
+}
+
+type Server struct {
+	Config
+
+	cursors  cursors
+	clientID atomic.Uint64
+	// limits bound the commands of the authenticated clients
+	limits limits
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+func New(cfg Config) *Server {
+	cfg.Limits = cfg.Limits.WithDefaults()
+	return &Server{
+		Config:    cfg,
+		limits:    commandLimits(cfg.Limits),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts the connections of ln until the server is closed. The
+// listener is expected to be wrapped by tls.NewListener when the clients
+// authenticate with certificates.
+func (s *Server) Serve(ln net.Listener) error {
+	if !track(s, s.listeners, ln) {
+		return ErrServerClosed
+	}
+	defer untrack(s, s.listeners, ln)
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !track(s, s.conns, c) {
+			c.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer untrack(s, s.conns, c)
+			s.handle(c)
+		}()
+	}
+}
+
+// Close stops the listeners and closes the open connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return nil
+}
+
+// track adds v to set unless the server is closed.
+func track[T comparable](s *Server, set map[T]struct{}, v T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	set[v] = struct{}{}
+	return true
+}
+
+func untrack[T comparable](s *Server, set map[T]struct{}, v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(set, v)
+}
+
+// conn holds the state of a client connection.
+type conn struct {
+	s       *Server
+	c       net.Conn
+	r       *reader
+	w       *writer
+	id      uint64
+	name    string
+	subject auth.Subject
+	// authorizer audits the decisions of the connection
+	authorizer server.Authorizer
+	quit       bool
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+
+	cn := &conn{
+		s:          s,
+		c:          c,
+		r:          &reader{r: bufio.NewReader(c)},
+		w:          &writer{w: bufio.NewWriter(c)},
+		id:         s.clientID.Add(1),
+		authorizer: s.Audit.Authorizer(s.Authorizer, "resp", c.RemoteAddr().String()),
+	}
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		// the chains are only verified when the server requires the
+		// client certificates, the connections use the default tenant
+		if chains := tlsConn.ConnectionState().VerifiedChains; len(chains) > 0 {
+			cn.subject = auth.SubjectOf(chains[0][0], "")
+		}
+	}
+
+	for !cn.quit {
+		cn.r.limits = cn.limits()
+		args, err := cn.r.readCommand()
+		if err != nil {
+			if err == errProtocol {
+				cn.w.error(err.Error())
+				cn.w.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		cn.exec(args)
+		// the replies of a pipeline are sent together
+		if cn.r.r.Buffered() == 0 {
+			if err := cn.w.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	cn.w.w.Flush()
+}
+
+func (c *conn) exec(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.error("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		c.w.error(errArgs(name).Error())
+		return
+	}
+	if cmd.act != "" {
+		if err := c.authorizeCommand(cmd, args); err != nil {
+			c.w.error(replyError(err))
+			return
+		}
+	}
+	if err := cmd.fn(c, args[1:]); err != nil {
+		c.w.error(replyError(err))
+	}
+}
+
+// limits returns the limits of the next command of the connection, the
+// clients authenticate before they send large commands.
+func (c *conn) limits() limits {
+	if c.subject.Name == "" {
+		return anonymous
+	}
+	return c.s.limits
+}
+
+// data returns the database that serves the commands of the connection.
+func (c *conn) data() server.KeyValueDb {
+	return c.s.Forwarder.Data(c.s.Data, c.subject)
+}
+
+// authorizeCommand checks whether the subject of the connection may perform
+// the action of cmd on each of its keys, the commands without keys act on
+// the whole keyspace.
+func (c *conn) authorizeCommand(cmd command, args [][]byte) error {
+	keys := cmd.keys.keys(args)
+	if len(keys) == 0 {
+		return c.authorize(objectWildCard, cmd.act)
+	}
+	for _, key := range keys {
+		if err := c.authorize(string(key), cmd.act); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorize checks whether the subject of the connection may perform act on
+// key.
+func (c *conn) authorize(key, act string) error {
+	return c.authorizer.Authorize(c.subject, key, act)
+}
+
+// redisError is an error replied as is.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+var (
+	errSyntax     = redisError("ERR syntax error")
+	errNotInteger = redisError("ERR value is not an integer or out of range")
+)
+
+func errArgs(name string) error {
+	return redisError("ERR wrong number of arguments for '" + name + "' command")
+}
+
+// replyError converts err to the reply sent to the client, the errors of
+// the database are prefixed with the code Redis uses for them.
+func replyError(err error) string {
+	var re redisError
+	if errors.As(err, &re) {
+		return string(re)
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		zap.L().Error("resp command failed", zap.Error(err))
+		return "ERR " + err.Error()
+	}
+	switch {
+	case st.Code() == codes.PermissionDenied:
+		return "NOPERM " + st.Message()
+	case st.Code() == codes.FailedPrecondition && strings.HasPrefix(st.Message(), "WRONGTYPE"):
+		return st.Message()
+	}
+	return "ERR " + st.Message()
+}
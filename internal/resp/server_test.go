@@ -0,0 +1,311 @@
+package resp_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/config"
+	"github.com/dunielm02/memdist/internal/db"
+	"github.com/dunielm02/memdist/internal/resp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESP(t *testing.T) {
+	root, nobody, data := setup(t)
+
+	require.Equal(t, "PONG", root.do(t, "PING"))
+	require.Equal(t, "OK", root.do(t, "SET", "foo", "bar"))
+	require.Equal(t, "bar", root.do(t, "GET", "foo"))
+	require.Nil(t, root.do(t, "GET", "missing"))
+
+	// NX and XX map to the preconditions
+	require.Nil(t, root.do(t, "SET", "foo", "baz", "NX"))
+	require.Nil(t, root.do(t, "SET", "missing", "baz", "XX"))
+	require.Equal(t, "OK", root.do(t, "SET", "foo", "baz", "XX", "EX", "100"))
+	require.Equal(t, int64(100), root.do(t, "TTL", "foo"))
+	require.Equal(t, int64(-2), root.do(t, "TTL", "missing"))
+
+	require.Equal(t, "OK", root.do(t, "MSET", "user:1", "john", "user:2", "jane", "zone", "eu"))
+	// an invalid pair fails the whole command
+	require.ErrorContains(t, root.do(t, "MSET", "user:3", "joe", strings.Repeat("k", 2<<10), "v").(error), "size of the Key")
+	require.Nil(t, root.do(t, "GET", "user:3"))
+	require.Equal(t, []any{"john", nil, "jane"}, root.do(t, "MGET", "user:1", "user:3", "user:2"))
+	require.Equal(t, int64(2), root.do(t, "EXISTS", "user:1", "user:3", "zone"))
+	require.Equal(t, int64(1), root.do(t, "EXPIRE", "zone", "10"))
+	require.Equal(t, int64(0), root.do(t, "EXPIRE", "missing", "10"))
+	require.Equal(t, []any{"user:1", "user:2"}, root.do(t, "KEYS", "user:[0-9]"))
+	require.Equal(t, []any{"user:1"}, root.do(t, "KEYS", "u*r*:*1"))
+
+	// a pattern of many stars is matched without backtracking over every split
+	long := "long:" + strings.Repeat("a", 64)
+	require.Equal(t, "OK", root.do(t, "SET", long, "v"))
+	require.Equal(t, []any{}, root.do(t, "KEYS", "long:"+strings.Repeat("*a", 32)+"b"))
+	require.Equal(t, []any{long}, root.do(t, "KEYS", "long:"+strings.Repeat("*a", 32)))
+	require.Equal(t, int64(1), root.do(t, "DEL", long))
+
+	// the cursors page through the keys in order
+	var scanned []any
+	cursor := "0"
+	for {
+		page := root.do(t, "SCAN", cursor, "MATCH", "*", "COUNT", "2").([]any)
+		scanned = append(scanned, page[1].([]any)...)
+		cursor = page[0].(string)
+		if cursor == "0" {
+			break
+		}
+	}
+	require.Equal(t, []any{"foo", "user:1", "user:2", "zone"}, scanned)
+
+	require.Equal(t, int64(2), root.do(t, "DEL", "user:1", "user:2", "missing"))
+	require.Equal(t, "string", root.do(t, "TYPE", "foo"))
+	require.Equal(t, "none", root.do(t, "TYPE", "user:1"))
+
+	// the key holds another type
+	_, err := data.SAdd(&api.SAddRequest{Key: "tags", Members: []string{"go"}})
+	require.NoError(t, err)
+	require.Equal(t, "set", root.do(t, "TYPE", "tags"))
+	require.ErrorContains(t, root.do(t, "GET", "tags").(error), "WRONGTYPE")
+
+	require.ErrorContains(t, nobody.do(t, "GET", "foo").(error), "NOPERM")
+	require.ErrorContains(t, root.do(t, "NOPE").(error), "unknown command")
+
+	// every key of a command is authorized, nobody writes public/nobody/*
+	// and reads public/*
+	require.Equal(t, "OK", nobody.do(t, "SET", "public/nobody/1", "mine"))
+	require.ErrorContains(t, nobody.do(t, "SET", "public/1", "theirs").(error), "NOPERM")
+	require.ErrorContains(t, nobody.do(t, "MSET", "public/nobody/2", "a", "foo", "b").(error), "NOPERM")
+	require.Equal(t, "mine", nobody.do(t, "GET", "public/nobody/1"))
+	require.ErrorContains(t, nobody.do(t, "MGET", "public/nobody/1", "foo").(error), "NOPERM")
+	require.Equal(t, []any{"public/nobody/1"}, nobody.do(t, "KEYS", "*"))
+	require.ErrorContains(t, root.do(t, "GET").(error), "wrong number of arguments")
+}
+
+func TestRESPHello(t *testing.T) {
+	_, nobody, _ := setup(t)
+
+	hello := nobody.do(t, "HELLO", "3").(map[string]any)
+	require.Equal(t, int64(3), hello["proto"])
+	require.ErrorContains(t, nobody.do(t, "GET", "foo").(error), "NOPERM")
+	// AUTH replaces the subject of the certificate
+	require.Equal(t, "OK", nobody.do(t, "AUTH", "admin", "secret"))
+	require.Nil(t, nobody.do(t, "GET", "foo"))
+	require.ErrorContains(t, nobody.do(t, "AUTH", "admin", "wrong").(error), "WRONGPASS")
+
+	require.Equal(t, "OK", nobody.do(t, "QUIT"))
+}
+
+func TestRESPAudit(t *testing.T) {
+	records := make(chan audit.Record, 1)
+	dial := serve(t, resp.Config{
+		Data: db.NewDB(db.Options{}),
+		Audit: audit.New(audit.Config{Sink: audit.SinkFunc(func(r audit.Record) error {
+			records <- r
+			return nil
+		})}),
+	})
+	c := dial()
+
+	// the client has no certificate, so no subject
+	require.ErrorContains(t, c.do(t, "GET", "foo").(error), "NOPERM")
+	r := <-records
+	require.Equal(t, audit.Deny, r.Decision)
+	require.Equal(t, "foo", r.Key)
+	require.Equal(t, "resp", r.Method)
+	require.Equal(t, c.conn.LocalAddr().String(), r.Peer)
+}
+
+func TestRESPLimits(t *testing.T) {
+	dial := serve(t, resp.Config{
+		Data: db.NewDB(db.Options{}),
+		Authenticate: func(username, password string) (auth.Subject, error) {
+			return auth.Subject{Name: "root"}, nil
+		},
+	})
+	value := strings.Repeat("a", 100<<10)
+
+	// the clients that haven't authenticated can't send large commands
+	for _, cmd := range []string{
+		"*1000\r\n",
+		"*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$102400\r\n",
+		"*6\r\n$4\r\nMSET\r\n" + strings.Repeat("$16384\r\n"+value[:16<<10]+"\r\n", 3) + "$16384\r\n",
+	} {
+		c := dial()
+		require.NoError(t, c.conn.SetDeadline(time.Now().Add(3*time.Second)))
+		_, err := c.conn.Write([]byte(cmd))
+		require.NoError(t, err)
+		reply, err := c.read()
+		require.NoError(t, err)
+		require.ErrorContains(t, reply.(error), "Protocol error")
+	}
+
+	c := dial()
+	require.Equal(t, "OK", c.do(t, "AUTH", "admin", "secret"))
+	require.Equal(t, "OK", c.do(t, "SET", "foo", value))
+	require.Equal(t, value, c.do(t, "GET", "foo"))
+}
+
+// serve starts a server without TLS for the tests of cfg, which is
+// completed with the policies of the tests, and returns a function that
+// connects a new client.
+func serve(t *testing.T, cfg resp.Config) func() *client {
+	t.Helper()
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+	cfg.Authorizer = authorizer
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := resp.New(cfg)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	return func() *client {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return &client{conn: conn, r: bufio.NewReader(conn)}
+	}
+}
+
+// setup starts a server and returns a client authenticated as root, one
+// authenticated as nobody and the database. AUTH accepts admin/secret as
+// root.
+func setup(t *testing.T) (*client, *client, *db.DB) {
+	t.Helper()
+
+	serverTLSConfig, err := config.GetTlsConfig(config.TLSConfig{
+		CAFile:   config.CAFile,
+		KeyFile:  config.ServerKeyFile,
+		CertFile: config.ServerCertFile,
+		Server:   true,
+	})
+	require.NoError(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+
+	data := db.NewDB(db.Options{})
+	srv := resp.New(resp.Config{
+		Data:       data,
+		Authorizer: authorizer,
+		Authenticate: func(username, password string) (auth.Subject, error) {
+			if username != "admin" || password != "secret" {
+				return auth.Subject{}, errors.New("invalid credentials")
+			}
+			return auth.Subject{Name: "root"}, nil
+		},
+	})
+	go srv.Serve(tls.NewListener(ln, serverTLSConfig))
+	t.Cleanup(func() { srv.Close() })
+
+	newClient := func(cert, key string) *client {
+		clientTLSConfig, err := config.GetTlsConfig(config.TLSConfig{
+			CertFile: cert,
+			KeyFile:  key,
+			CAFile:   config.CAFile,
+		})
+		require.NoError(t, err)
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientTLSConfig)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return &client{conn: conn, r: bufio.NewReader(conn)}
+	}
+
+	return newClient(config.RootCertFile, config.RootKeyFile),
+		newClient(config.NobodyCertFile, config.NobodyKeyFile),
+		data
+}
+
+// client speaks just enough RESP for the tests, the errors are returned as
+// replies.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) do(t *testing.T, args ...string) any {
+	t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write([]byte(b.String()))
+	require.NoError(t, err)
+
+	reply, err := c.read()
+	require.NoError(t, err)
+	return reply
+}
+
+func (c *client) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	kind, body := line[0], line[1:]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return errors.New(body), nil
+	case '_':
+		return nil, nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	}
+
+	n, err := strconv.Atoi(body)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case '$':
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case '%':
+		items := make(map[string]any, n)
+		for range n {
+			key, err := c.read()
+			if err != nil {
+				return nil, err
+			}
+			if items[key.(string)], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply: %q", line)
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PolicyStore keeps the access policies, the role assignments and the API
+// keys. The DistributedDB replicates them through raft and hands the
+// policies to the authorizer after each change.
+type PolicyStore interface {
+	AddPolicy(*api.AddPolicyRequest) (*api.AddPolicyResponse, error)
+	RemovePolicy(*api.RemovePolicyRequest) (*api.RemovePolicyResponse, error)
+	ListPolicies(*api.ListPoliciesRequest) (*api.ListPoliciesResponse, error)
+	AddRole(*api.AddRoleRequest) (*api.AddRoleResponse, error)
+	RemoveRole(*api.RemoveRoleRequest) (*api.RemoveRoleResponse, error)
+	ListRoles(*api.ListRolesRequest) (*api.ListRolesResponse, error)
+	AddAPIKey(*api.AddAPIKeyRequest) error
+	GetAPIKey(id string) (*api.APIKey, error)
+	RevokeAPIKey(*api.RevokeAPIKeyRequest) (*api.RevokeAPIKeyResponse, error)
+	ListAPIKeys(*api.ListAPIKeysRequest) (*api.ListAPIKeysResponse, error)
+}
+
+// adminAction is granted on the wildcard to the subjects that manage the
+// policies.
+const adminAction = "admin"
+
+var _ api.AdminServer = &adminServer{}
+
+// adminServer is a separate type since the generated servers can't be
+// embedded twice in grpcServer.
+type adminServer struct {
+	api.UnimplementedAdminServer
+	*grpcServer
+}
+
+// authorizeDomain checks that the caller is an admin of the domain of a
+// rule, not only of its own tenant. The empty domain covers every tenant,
+// so only the admins of the * domain write its rules.
+func (s *adminServer) authorizeDomain(ctx context.Context, domain string) error {
+	sub := subject(ctx)
+	sub.Tenant = domain
+	if domain == "" {
+		sub.Tenant = objectWildCard
+	}
+	return s.authorizeAs(ctx, sub, objectWildCard, adminAction)
+}
+
+// global reports whether the caller is an admin of every tenant, the admins
+// of a tenant only see the rules and the keys of that tenant.
+func (s *adminServer) global(ctx context.Context) bool {
+	sub := subject(ctx)
+	sub.Tenant = objectWildCard
+	return s.Authorizer.Authorize(sub, objectWildCard, adminAction) == nil
+}
+
+func (s *adminServer) AddPolicy(ctx context.Context, req *api.AddPolicyRequest) (*api.AddPolicyResponse, error) {
+	if err := s.authorizeDomain(ctx, req.Policy.GetDomain()); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.ValidatePolicy(req.Policy); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.AddPolicy); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Policies.AddPolicy(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while adding the policy: ")
+	}
+
+	return res, nil
+}
+
+func (s *adminServer) RemovePolicy(ctx context.Context, req *api.RemovePolicyRequest) (*api.RemovePolicyResponse, error) {
+	if err := s.authorizeDomain(ctx, req.Policy.GetDomain()); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.ValidatePolicy(req.Policy); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.RemovePolicy); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Policies.RemovePolicy(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while removing the policy: ")
+	}
+
+	return res, nil
+}
+
+func (s *adminServer) ListPolicies(ctx context.Context, req *api.ListPoliciesRequest) (*api.ListPoliciesResponse, error) {
+	if err := s.authorize(ctx, objectWildCard, adminAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.ListPolicies); ok {
+			return res, err
+		}
+	}
+	res, err := s.Policies.ListPolicies(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while listing the policies: ")
+	}
+	if !s.global(ctx) {
+		tenant := tenantOf(subject(ctx))
+		res.Policies = slices.DeleteFunc(res.Policies, func(policy *api.Policy) bool {
+			return policy.Domain != tenant
+		})
+	}
+
+	return res, nil
+}
+
+func (s *adminServer) AddRole(ctx context.Context, req *api.AddRoleRequest) (*api.AddRoleResponse, error) {
+	if err := s.authorizeDomain(ctx, req.Role.GetDomain()); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.ValidateRole(req.Role); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.AddRole); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Policies.AddRole(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while adding the role: ")
+	}
+
+	return res, nil
+}
+
+func (s *adminServer) RemoveRole(ctx context.Context, req *api.RemoveRoleRequest) (*api.RemoveRoleResponse, error) {
+	if err := s.authorizeDomain(ctx, req.Role.GetDomain()); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.ValidateRole(req.Role); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.RemoveRole); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Policies.RemoveRole(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while removing the role: ")
+	}
+
+	return res, nil
+}
+
+func (s *adminServer) ListRoles(ctx context.Context, req *api.ListRolesRequest) (*api.ListRolesResponse, error) {
+	if err := s.authorize(ctx, objectWildCard, adminAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.ListRoles); ok {
+			return res, err
+		}
+	}
+	res, err := s.Policies.ListRoles(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while listing the roles: ")
+	}
+	if !s.global(ctx) {
+		tenant := tenantOf(subject(ctx))
+		res.Roles = slices.DeleteFunc(res.Roles, func(role *api.RoleAssignment) bool {
+			return role.Domain != tenant
+		})
+	}
+
+	return res, nil
+}
+
+// CreateAPIKey draws the key on the leader, only its hash goes through raft.
+func (s *adminServer) CreateAPIKey(ctx context.Context, req *api.CreateAPIKeyRequest) (*api.CreateAPIKeyResponse, error) {
+	if err := s.authorize(ctx, objectWildCard, adminAction); err != nil {
+		return nil, err
+	}
+	if req.Subject == "" {
+		return nil, status.Error(codes.InvalidArgument, "the api key needs a Subject")
+	}
+	if err := s.checkAPIKey(ctx, req); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.CreateAPIKey); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+
+	key, token, err := auth.NewAPIKey(req.Subject, req.Roles)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while creating the api key: ")
+	}
+	key.Tenant = tenantOf(subject(ctx))
+	if err := s.Policies.AddAPIKey(&api.AddAPIKeyRequest{Key: key, Ttl: req.Ttl}); err != nil {
+		return nil, internalError(err, "something went wrong while creating the api key: ")
+	}
+
+	return &api.CreateAPIKeyResponse{Id: key.Id, Key: token}, nil
+}
+
+// checkAPIKey keeps the keys from granting more than the caller holds: a
+// key for another subject needs an admin of every tenant, and its roles
+// must be held by the caller in its tenant.
+func (s *adminServer) checkAPIKey(ctx context.Context, req *api.CreateAPIKeyRequest) error {
+	sub := subject(ctx)
+	if req.Subject != sub.Name && !s.global(ctx) {
+		return status.Error(codes.PermissionDenied, "only the admins of every tenant create api keys for another subject")
+	}
+	held := s.Authorizer.Roles(sub)
+	for _, role := range req.Roles {
+		if !slices.Contains(held, role) {
+			return status.Errorf(codes.PermissionDenied, "%s doesn't hold the role %s in its tenant", sub.Name, role)
+		}
+	}
+	return nil
+}
+
+func tenantOf(sub auth.Subject) string {
+	if sub.Tenant == "" {
+		return auth.DefaultTenant
+	}
+	return sub.Tenant
+}
+
+func (s *adminServer) RevokeAPIKey(ctx context.Context, req *api.RevokeAPIKeyRequest) (*api.RevokeAPIKeyResponse, error) {
+	if err := s.authorize(ctx, objectWildCard, adminAction); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.RevokeAPIKey); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	// an admin of a tenant only revokes the keys of that tenant
+	key, err := s.Policies.GetAPIKey(req.Id)
+	if errors.Is(err, db.ErrAPIKeyNotFound) {
+		return &api.RevokeAPIKeyResponse{}, nil
+	}
+	if err != nil {
+		return nil, internalError(err, "something went wrong while revoking the api key: ")
+	}
+	if err := s.authorizeDomain(ctx, key.Tenant); err != nil {
+		return nil, err
+	}
+	res, err := s.Policies.RevokeAPIKey(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while revoking the api key: ")
+	}
+
+	return res, nil
+}
+
+func (s *adminServer) ListAPIKeys(ctx context.Context, req *api.ListAPIKeysRequest) (*api.ListAPIKeysResponse, error) {
+	if err := s.authorize(ctx, objectWildCard, adminAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forwardTo(ctx, s.forwarder, api.NewAdminClient, req, api.AdminClient.ListAPIKeys); ok {
+			return res, err
+		}
+	}
+	res, err := s.Policies.ListAPIKeys(req)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while listing the api keys: ")
+	}
+	if !s.global(ctx) {
+		tenant := tenantOf(subject(ctx))
+		res.Keys = slices.DeleteFunc(res.Keys, func(key *api.APIKey) bool {
+			return key.Tenant != tenant
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type auditKey struct{}
+
+// auditTrail collects the authorization decisions of a request. The ones
+// of the unary requests wait for the response, which gives the raft index
+// of the writes, the ones of the streams are logged right away.
+type auditTrail struct {
+	method  string
+	peer    string
+	stream  bool
+	logged  bool
+	records []audit.Record
+}
+
+func newAuditTrail(ctx context.Context, method string, stream bool) *auditTrail {
+	trail := &auditTrail{method: method, stream: stream}
+	if p, ok := peer.FromContext(ctx); ok {
+		trail.peer = p.Addr.String()
+	}
+	return trail
+}
+
+// auditUnary runs before the authentication, so the requests without valid
+// credentials are audited too.
+func (s *grpcServer) auditUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	trail := newAuditTrail(ctx, info.FullMethod, false)
+	res, err := handler(context.WithValue(ctx, auditKey{}, trail), req)
+
+	for i := range trail.records {
+		r := &trail.records[i]
+		if r.Decision == audit.Allow {
+			if err != nil {
+				r.Error = status.Convert(err).Message()
+			} else if r.Action != getAction {
+				auditWrite(r, req, res)
+			}
+		}
+		s.Audit.Log(*r)
+	}
+	s.auditUnauthenticated(trail, err)
+
+	return res, err
+}
+
+func (s *grpcServer) auditStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	trail := newAuditTrail(stream.Context(), info.FullMethod, true)
+	wrapped := middleware.WrapServerStream(stream)
+	wrapped.WrappedContext = context.WithValue(stream.Context(), auditKey{}, trail)
+
+	err := handler(srv, wrapped)
+	s.auditUnauthenticated(trail, err)
+
+	return err
+}
+
+// auditUnauthenticated logs the requests rejected before any decision was
+// made, they have no subject.
+func (s *grpcServer) auditUnauthenticated(trail *auditTrail, err error) {
+	if trail.logged || len(trail.records) > 0 || status.Code(err) != codes.Unauthenticated {
+		return
+	}
+	s.Audit.Log(audit.Record{
+		Decision: audit.Deny,
+		Peer:     trail.peer,
+		Method:   trail.method,
+		Error:    status.Convert(err).Message(),
+	})
+}
+
+// audit records a decision of authorize. The requests forwarded by another
+// node were audited by that node.
+func (s *grpcServer) audit(ctx context.Context, sub auth.Subject, key, act string, err error) {
+	if ctx.Value(forwardedBy{}) != nil {
+		return
+	}
+	s.record(ctx, sub, key, act, err)
+}
+
+// record adds a decision to the trail of the request.
+func (s *grpcServer) record(ctx context.Context, sub auth.Subject, key, act string, err error) {
+	trail, ok := ctx.Value(auditKey{}).(*auditTrail)
+	if !ok {
+		return
+	}
+
+	r := audit.Record{
+		Subject:  sub.Name,
+		Roles:    sub.Roles,
+		Tenant:   sub.Tenant,
+		Action:   act,
+		Key:      key,
+		Decision: audit.Allow,
+		Peer:     trail.peer,
+		Method:   trail.method,
+	}
+	if err != nil {
+		r.Decision = audit.Deny
+		r.Error = status.Convert(err).Message()
+	}
+
+	if trail.stream {
+		trail.logged = true
+		s.Audit.Log(r)
+		return
+	}
+	trail.records = append(trail.records, r)
+}
+
+// auditWrite adds the raft index and the value of a successful write to its
+// record.
+func auditWrite(r *audit.Record, req, res any) {
+	if batch, ok := req.(*api.MultiSetRequest); ok {
+		results := res.(*api.MultiSetResponse).GetResults()
+		for i, item := range batch.Items {
+			if item.Key != r.Key || i >= len(results) {
+				continue
+			}
+			r.Index, r.Value = results[i].Version, item.Value
+			if results[i].Error != nil {
+				r.Error = results[i].Error.Message
+			}
+		}
+		return
+	}
+	if batch, ok := req.(*api.MultiDeleteRequest); ok {
+		res := res.(*api.MultiDeleteResponse)
+		r.Index = res.GetIndex()
+		results := res.GetResults()
+		for i, item := range batch.Items {
+			if item.Key == r.Key && i < len(results) && results[i].Error != nil {
+				r.Index, r.Error = 0, results[i].Error.Message
+			}
+		}
+		return
+	}
+
+	switch res := res.(type) {
+	case interface{ GetVersion() uint64 }:
+		r.Index = res.GetVersion()
+	case interface{ GetIndex() uint64 }:
+		r.Index = res.GetIndex()
+	}
+	if req, ok := req.(interface {
+		GetKey() string
+		GetValue() []byte
+	}); ok && req.GetKey() == r.Key {
+		r.Value = req.GetValue()
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+
+	"github.com/dunielm02/memdist/api/v1"
+)
+
+func (s *grpcServer) HSet(ctx context.Context, req *api.HSetRequest) (*api.HSetResponse, error) {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.ValidateHSet(req); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.HSet); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.HSet(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while setting the fields: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) HGet(ctx context.Context, req *api.HGetRequest) (*api.HGetResponse, error) {
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forward(ctx, s, req, api.DatabaseClient.HGet); ok {
+			return res, err
+		}
+	}
+	res, err := s.Data.HGet(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while getting the field: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) HDel(ctx context.Context, req *api.HDelRequest) (*api.HDelResponse, error) {
+	if err := s.authorize(ctx, req.Key, deleteAction); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.HDel); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.HDel(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while deleting the fields: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) HGetAll(ctx context.Context, req *api.HGetAllRequest) (*api.HGetAllResponse, error) {
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forward(ctx, s, req, api.DatabaseClient.HGetAll); ok {
+			return res, err
+		}
+	}
+	res, err := s.Data.HGetAll(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while getting the fields: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) LPush(ctx context.Context, req *api.LPushRequest) (*api.LPushResponse, error) {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.ValidateLPush(req); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.LPush); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.LPush(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while pushing the values: ")
+	}
+
+	return res, nil
+}
+
+// LPop returns the values it removes, so the caller needs to be allowed to
+// read and to delete them.
+func (s *grpcServer) LPop(ctx context.Context, req *api.LPopRequest) (*api.LPopResponse, error) {
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, req.Key, deleteAction); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.LPop); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.LPop(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while popping the values: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) LRange(ctx context.Context, req *api.LRangeRequest) (*api.LRangeResponse, error) {
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forward(ctx, s, req, api.DatabaseClient.LRange); ok {
+			return res, err
+		}
+	}
+	res, err := s.Data.LRange(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while reading the list: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) SAdd(ctx context.Context, req *api.SAddRequest) (*api.SAddResponse, error) {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.ValidateMembers(req.Key, req.Members); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.SAdd); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.SAdd(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while adding the members: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) SRem(ctx context.Context, req *api.SRemRequest) (*api.SRemResponse, error) {
+	if err := s.authorize(ctx, req.Key, deleteAction); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.SRem); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.SRem(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while removing the members: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) SMembers(ctx context.Context, req *api.SMembersRequest) (*api.SMembersResponse, error) {
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forward(ctx, s, req, api.DatabaseClient.SMembers); ok {
+			return res, err
+		}
+	}
+	res, err := s.Data.SMembers(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while reading the set: ")
+	}
+
+	return res, nil
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Cluster tells the server whether it runs on the raft leader and where to
+// find it otherwise.
+type Cluster interface {
+	IsLeader() bool
+	LeaderAddr() (string, error)
+	GetServers() ([]*api.Server, error)
+}
+
+const (
+	// forwardedSubjectKey and forwardedRolesKey carry the subject of the
+	// original caller when a follower forwards a request to the leader, its
+	// tenant is sent under TenantKey.
+	forwardedSubjectKey = "memdist-forwarded-subject"
+	forwardedRolesKey   = "memdist-forwarded-roles"
+	forwardAction       = "forward"
+)
+
+type forwardedBy struct{}
+
+// Forwarder sends the requests received by a follower to the raft leader on
+// behalf of their caller. It keeps one connection per leader address.
+type Forwarder struct {
+	cluster Cluster
+	opts    []grpc.DialOption
+	mu      sync.Mutex
+	conns   map[string]*grpc.ClientConn
+}
+
+// NewForwarder returns a forwarder that dials the leader with opts, which
+// carry the credentials of the node. A nil cluster serves every request
+// locally.
+func NewForwarder(cluster Cluster, opts ...grpc.DialOption) *Forwarder {
+	return &Forwarder{
+		cluster: cluster,
+		opts:    opts,
+		conns:   make(map[string]*grpc.ClientConn),
+	}
+}
+
+// Close closes the connections to the leaders.
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs []error
+	for addr, conn := range f.conns {
+		errs = append(errs, conn.Close())
+		delete(f.conns, addr)
+	}
+	return errors.Join(errs...)
+}
+
+func (f *Forwarder) conn(addr string) (*grpc.ClientConn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	conn, ok := f.conns[addr]
+	if !ok {
+		var err error
+		conn, err = grpc.NewClient(addr, f.opts...)
+		if err != nil {
+			return nil, err
+		}
+		f.conns[addr] = conn
+	}
+
+	return conn, nil
+}
+
+// GetServers lists the members of the cluster. It is open to every
+// authenticated caller, whatever keys they may access they need the nodes
+// that serve them.
+func (s *grpcServer) GetServers(ctx context.Context, req *api.GetServersRequest) (*api.GetServersResponse, error) {
+	if s.Cluster == nil {
+		return &api.GetServersResponse{}, nil
+	}
+	servers, err := s.Cluster.GetServers()
+	if err != nil {
+		return nil, internalError(err, "something went wrong while listing the servers: ")
+	}
+	return &api.GetServersResponse{Servers: servers}, nil
+}
+
+// forward sends req to the raft leader when this node is a follower. The
+// returned bool reports whether the request was forwarded, if it is false
+// the caller must handle the request locally.
+func forward[Req, Res any](
+	ctx context.Context,
+	s *grpcServer,
+	req Req,
+	call func(api.DatabaseClient, context.Context, Req, ...grpc.CallOption) (Res, error),
+) (Res, bool, error) {
+	return forwardTo(ctx, s.forwarder, api.NewDatabaseClient, req, call)
+}
+
+// forwardTo is forward for the calls of any service of the leader, newClient
+// builds the client of the service.
+func forwardTo[Client, Req, Res any](
+	ctx context.Context,
+	f *Forwarder,
+	newClient func(grpc.ClientConnInterface) Client,
+	req Req,
+	call func(Client, context.Context, Req, ...grpc.CallOption) (Res, error),
+) (Res, bool, error) {
+	var res Res
+	if f.cluster == nil || f.cluster.IsLeader() {
+		return res, false, nil
+	}
+	if ctx.Value(forwardedBy{}) != nil {
+		// the leader that forwarded the request lost its leadership, don't
+		// bounce the request around the cluster
+		return res, true, status.Error(codes.Unavailable, "this node is not the leader")
+	}
+
+	addr, err := f.cluster.LeaderAddr()
+	if err != nil {
+		return res, true, err
+	}
+	conn, err := f.conn(addr)
+	if err != nil {
+		return res, true, status.Error(codes.Unavailable, err.Error())
+	}
+
+	sub := subject(ctx)
+	kv := []string{forwardedSubjectKey, sub.Name, TenantKey, sub.Tenant}
+	for _, role := range sub.Roles {
+		kv = append(kv, forwardedRolesKey, role)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, kv...)
+	res, err = call(newClient(conn), ctx, req)
+
+	return res, true, err
+}
+
+// authenticateForwarded sets the subject of a forwarded request to the
+// subject of the original caller, as long as the certificate of the node
+// forwarding it allows it to do so.
+func (s *grpcServer) authenticateForwarded(ctx context.Context, creds auth.Credentials, md metadata.MD) (context.Context, error) {
+	node, err := auth.MTLS{}.Authenticate(ctx, creds)
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, "the forwarded requests need the certificate of a node")
+	}
+	if err := s.Authorizer.Authorize(node, objectWildCard, forwardAction); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, forwardedBy{}, node)
+	ctx = context.WithValue(ctx, subjectKey{}, auth.Subject{
+		Name:   md.Get(forwardedSubjectKey)[0],
+		Roles:  md.Get(forwardedRolesKey),
+		Tenant: node.Tenant,
+	})
+
+	return ctx, nil
+}
+
+// Data returns data with the writes of sub sent to the leader when this
+// node is a follower, for the servers of the other protocols. The leader
+// checks sub against the policies again, like the requests forwarded by the
+// gRPC server, and the reads are served by data. A nil Forwarder returns
+// data as is.
+func (f *Forwarder) Data(data KeyValueDb, sub auth.Subject) KeyValueDb {
+	if f == nil {
+		return data
+	}
+	return &forwardingDb{
+		KeyValueDb: data,
+		f:          f,
+		ctx:        context.WithValue(context.Background(), subjectKey{}, sub),
+	}
+}
+
+type forwardingDb struct {
+	KeyValueDb
+	f   *Forwarder
+	ctx context.Context
+}
+
+// forwardWrite sends req to the leader with call, or to local when this
+// node is the leader.
+func forwardWrite[Req, Res any](
+	d *forwardingDb,
+	req Req,
+	call func(api.DatabaseClient, context.Context, Req, ...grpc.CallOption) (Res, error),
+	local func(Req) (Res, error),
+) (Res, error) {
+	if res, ok, err := forwardTo(d.ctx, d.f, api.NewDatabaseClient, req, call); ok {
+		return res, err
+	}
+	return local(req)
+}
+
+func (d *forwardingDb) Set(req *api.SetRequest) (*api.SetResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.Set, d.KeyValueDb.Set)
+}
+
+func (d *forwardingDb) Delete(req *api.DeleteRequest) (*api.DeleteResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.Delete, d.KeyValueDb.Delete)
+}
+
+func (d *forwardingDb) Expire(req *api.ExpireRequest) (*api.ExpireResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.Expire, d.KeyValueDb.Expire)
+}
+
+func (d *forwardingDb) Persist(req *api.PersistRequest) (*api.PersistResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.Persist, d.KeyValueDb.Persist)
+}
+
+func (d *forwardingDb) Txn(req *api.TxnRequest) (*api.TxnResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.Txn, d.KeyValueDb.Txn)
+}
+
+func (d *forwardingDb) MultiSet(req *api.MultiSetRequest) (*api.MultiSetResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.MultiSet, d.KeyValueDb.MultiSet)
+}
+
+func (d *forwardingDb) MultiDelete(req *api.MultiDeleteRequest) (*api.MultiDeleteResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.MultiDelete, d.KeyValueDb.MultiDelete)
+}
+
+func (d *forwardingDb) Incr(req *api.IncrRequest) (*api.IncrResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.Incr, d.KeyValueDb.Incr)
+}
+
+func (d *forwardingDb) Decr(req *api.DecrRequest) (*api.DecrResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.Decr, d.KeyValueDb.Decr)
+}
+
+func (d *forwardingDb) HSet(req *api.HSetRequest) (*api.HSetResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.HSet, d.KeyValueDb.HSet)
+}
+
+func (d *forwardingDb) HDel(req *api.HDelRequest) (*api.HDelResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.HDel, d.KeyValueDb.HDel)
+}
+
+func (d *forwardingDb) LPush(req *api.LPushRequest) (*api.LPushResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.LPush, d.KeyValueDb.LPush)
+}
+
+func (d *forwardingDb) LPop(req *api.LPopRequest) (*api.LPopResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.LPop, d.KeyValueDb.LPop)
+}
+
+func (d *forwardingDb) SAdd(req *api.SAddRequest) (*api.SAddResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.SAdd, d.KeyValueDb.SAdd)
+}
+
+func (d *forwardingDb) SRem(req *api.SRemRequest) (*api.SRemResponse, error) {
+	return forwardWrite(d, req, api.DatabaseClient.SRem, d.KeyValueDb.SRem)
+}
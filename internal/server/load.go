@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/dunielm02/memdist/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// loadFlushInterval bounds the time a record waits for its batch to
+	// fill up.
+	loadFlushInterval = 20 * time.Millisecond
+	// loadBatchBytes bounds the size of the keys and values of a batch, it
+	// keeps the batches forwarded to the leader below the message limit.
+	loadBatchBytes = 1 << 20
+)
+
+// Load groups the records it receives in batches written with MultiSet. A
+// batch is written once it is full or once its first record waited for
+// loadFlushInterval. The stream isn't read while a batch is being written,
+// so the flow control of gRPC slows the client down to the pace of the
+// cluster. The load stops at the first record that fails, the batches
+// written before it are kept.
+func (s *grpcServer) Load(stream api.Database_LoadServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	// the requests are read in the background so the batches are written
+	// on time, the reader waits while a batch is being written
+	reqs := make(chan *api.LoadRequest)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	l := &loader{
+		s:        s,
+		maxItems: s.Limits.WithDefaults().MaxBatchSize,
+		batch:    &api.MultiSetRequest{},
+		res:      &api.LoadResponse{},
+	}
+	var flush <-chan time.Time
+	for {
+		select {
+		case req := <-reqs:
+			for _, item := range req.Items {
+				if err := l.add(ctx, item); err != nil {
+					return err
+				}
+			}
+			if len(l.batch.Items) == 0 {
+				flush = nil
+			} else if flush == nil {
+				flush = time.After(loadFlushInterval)
+			}
+		case <-flush:
+			flush = nil
+			if err := l.flush(ctx); err != nil {
+				return err
+			}
+		case err := <-errc:
+			if err != io.EOF {
+				return err
+			}
+			if err := l.flush(ctx); err != nil {
+				return err
+			}
+			return stream.SendAndClose(l.res)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// loader accumulates the records of a Load in the current batch.
+type loader struct {
+	s        *grpcServer
+	maxItems int
+	batch    *api.MultiSetRequest
+	size     int
+	res      *api.LoadResponse
+}
+
+// add appends the item to the batch and writes the batch once it is full.
+func (l *loader) add(ctx context.Context, item *api.SetRequest) error {
+	l.batch.Items = append(l.batch.Items, item)
+	l.size += len(item.Key) + len(item.Value)
+	if len(l.batch.Items) < l.maxItems && l.size < loadBatchBytes {
+		return nil
+	}
+	return l.flush(ctx)
+}
+
+// flush writes the batch and starts a new one.
+func (l *loader) flush(ctx context.Context) error {
+	if len(l.batch.Items) == 0 {
+		return nil
+	}
+	res, err := l.s.MultiSet(ctx, l.batch)
+	if err != nil {
+		return err
+	}
+	for i, result := range res.Results {
+		if result.Error != nil {
+			return status.Errorf(
+				codes.Code(result.Error.Code),
+				"record %d: %s", l.res.Count+uint64(i), result.Error.Message,
+			)
+		}
+		l.res.Index = max(l.res.Index, result.Version)
+	}
+	l.res.Count += uint64(len(res.Results))
+	l.batch = &api.MultiSetRequest{}
+	l.size = 0
+
+	return nil
+}
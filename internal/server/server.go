@@ -2,20 +2,47 @@ package server
 
 import (
 	"context"
+	"io"
+	"strings"
 
 	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/audit"
+	"github.com/dunielm02/memdist/internal/auth"
+	"github.com/dunielm02/memdist/internal/db"
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 type KeyValueDb interface {
 	Get(*api.GetRequest) (*api.GetResponse, error)
-	Set(*api.SetRequest) error
-	Delete(*api.DeleteRequest) error
+	Set(*api.SetRequest) (*api.SetResponse, error)
+	Delete(*api.DeleteRequest) (*api.DeleteResponse, error)
+	Expire(*api.ExpireRequest) (*api.ExpireResponse, error)
+	Persist(*api.PersistRequest) (*api.PersistResponse, error)
+	TTL(*api.TTLRequest) (*api.TTLResponse, error)
+	Txn(*api.TxnRequest) (*api.TxnResponse, error)
+	Scan(*api.ScanRequest, func(*api.Record) error) ([]byte, error)
+	Watch(*api.WatchRequest) (*db.Watcher, error)
+	MultiGet(*api.MultiGetRequest) (*api.MultiGetResponse, error)
+	MultiSet(*api.MultiSetRequest) (*api.MultiSetResponse, error)
+	MultiDelete(*api.MultiDeleteRequest) (*api.MultiDeleteResponse, error)
+	Incr(*api.IncrRequest) (*api.IncrResponse, error)
+	Decr(*api.DecrRequest) (*api.DecrResponse, error)
+	HSet(*api.HSetRequest) (*api.HSetResponse, error)
+	HGet(*api.HGetRequest) (*api.HGetResponse, error)
+	HDel(*api.HDelRequest) (*api.HDelResponse, error)
+	HGetAll(*api.HGetAllRequest) (*api.HGetAllResponse, error)
+	LPush(*api.LPushRequest) (*api.LPushResponse, error)
+	LPop(*api.LPopRequest) (*api.LPopResponse, error)
+	LRange(*api.LRangeRequest) (*api.LRangeResponse, error)
+	SAdd(*api.SAddRequest) (*api.SAddResponse, error)
+	SRem(*api.SRemRequest) (*api.SRemResponse, error)
+	SMembers(*api.SMembersRequest) (*api.SMembersResponse, error)
 }
 
 const (
@@ -28,10 +55,29 @@ const (
 type Config struct {
 	Authorizer Authorizer
 	Data       KeyValueDb
+	// Limits are checked before the requests reach Data, zero values use
+	// the database defaults.
+	Limits db.Options
+	// Cluster is optional, when it is set the writes received by a follower
+	// are forwarded to the leader using ForwardDialOptions.
+	Cluster            Cluster
+	ForwardDialOptions []grpc.DialOption
+	// Policies is optional, the admin service is only served when it is
+	// set.
+	Policies PolicyStore
+	// Authenticator finds the subject of the requests, nil uses the common
+	// name of the client certificates. The forwarded requests are always
+	// checked against the certificate of the node that forwards them.
+	Authenticator auth.Authenticator
+	// Audit is optional, it logs the decisions of the authorizer along with
+	// the outcome of the requests.
+	Audit *audit.Logger
 }
 
 type Authorizer interface {
-	Authorize(sub string, obj string, act string) error
+	Authorize(sub auth.Subject, obj string, act string) error
+	// Roles returns the roles sub holds in its tenant.
+	Roles(sub auth.Subject) []string
 }
 
 var _ api.DatabaseServer = &grpcServer{}
@@ -39,39 +85,59 @@ var _ api.DatabaseServer = &grpcServer{}
 type grpcServer struct {
 	api.UnimplementedDatabaseServer
 	Config
+	forwarder *Forwarder
 }
 
 func New(c Config, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	srv := newGrpcServer(c)
+
+	if c.Audit != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(srv.auditUnary),
+			grpc.ChainStreamInterceptor(srv.auditStream),
+		)
+	}
 	opts = append(opts,
 		grpc.ChainUnaryInterceptor(
-			grpc_auth.UnaryServerInterceptor(extractAuthData),
+			grpc_auth.UnaryServerInterceptor(srv.authenticate),
 		),
 		grpc.ChainStreamInterceptor(
-			grpc_auth.StreamServerInterceptor(extractAuthData),
+			grpc_auth.StreamServerInterceptor(srv.authenticate),
 		),
 	)
 
 	gsrv := grpc.NewServer(opts...)
-	srv := newGrpcServer(c)
 
 	api.RegisterDatabaseServer(gsrv, srv)
+	if c.Policies != nil {
+		api.RegisterAdminServer(gsrv, &adminServer{grpcServer: srv})
+	}
 
 	return gsrv, nil
 }
 
 func newGrpcServer(c Config) *grpcServer {
 	return &grpcServer{
-		Config: c,
+		Config:    c,
+		forwarder: NewForwarder(c.Cluster, c.ForwardDialOptions...),
 	}
 }
 
 func (s *grpcServer) Get(ctx context.Context, req *api.GetRequest) (*api.GetResponse, error) {
-	if err := s.Authorizer.Authorize(subject(ctx), objectWildCard, getAction); err != nil {
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
 		return nil, err
 	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Get); ok {
+			return res, err
+		}
+	}
 	res, err := s.Data.Get(req)
 
 	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
 		return nil, status.Error(codes.NotFound, err.Error())
 	}
 
@@ -79,55 +145,506 @@ func (s *grpcServer) Get(ctx context.Context, req *api.GetRequest) (*api.GetResp
 }
 
 func (s *grpcServer) Set(ctx context.Context, req *api.SetRequest) (*api.SetResponse, error) {
-	if err := s.Authorizer.Authorize(subject(ctx), objectWildCard, setAction); err != nil {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
 		return nil, err
 	}
-	err := s.Data.Set(req)
+	if err := s.Limits.Validate(req.Key, req.Value); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Set); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.Set(req)
 
 	if err != nil {
 		return &api.SetResponse{},
-			status.Error(codes.Internal, "something went wrong while setting the value: "+err.Error())
+			internalError(err, "something went wrong while setting the value: ")
 	}
 
-	return &api.SetResponse{}, nil
+	return res, nil
 }
 
 func (s *grpcServer) Delete(ctx context.Context, req *api.DeleteRequest) (*api.DeleteResponse, error) {
-	if err := s.Authorizer.Authorize(subject(ctx), objectWildCard, deleteAction); err != nil {
+	if err := s.authorize(ctx, req.Key, deleteAction); err != nil {
 		return nil, err
 	}
-	err := s.Data.Delete(req)
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Delete); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.Delete(req)
 
 	if err != nil {
 		return &api.DeleteResponse{},
-			status.Error(codes.Internal, "something went wrong while deleting the value: "+err.Error())
+			internalError(err, "something went wrong while deleting the value: ")
 	}
 
-	return &api.DeleteResponse{}, nil
+	return res, nil
 }
 
-type username struct{}
+func (s *grpcServer) Expire(ctx context.Context, req *api.ExpireRequest) (*api.ExpireResponse, error) {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Expire); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.Expire(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while expiring the key: ")
+	}
 
-func extractAuthData(ctx context.Context) (context.Context, error) {
+	return res, nil
+}
+
+func (s *grpcServer) Persist(ctx context.Context, req *api.PersistRequest) (*api.PersistResponse, error) {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Persist); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.Persist(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while persisting the key: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) Incr(ctx context.Context, req *api.IncrRequest) (*api.IncrResponse, error) {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.Validate(req.Key, nil); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Incr); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.Incr(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while incrementing the value: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) Decr(ctx context.Context, req *api.DecrRequest) (*api.DecrResponse, error) {
+	if err := s.authorize(ctx, req.Key, setAction); err != nil {
+		return nil, err
+	}
+	if err := s.Limits.Validate(req.Key, nil); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Decr); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.Decr(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while decrementing the value: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) TTL(ctx context.Context, req *api.TTLRequest) (*api.TTLResponse, error) {
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forward(ctx, s, req, api.DatabaseClient.TTL); ok {
+			return res, err
+		}
+	}
+	res, err := s.Data.TTL(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while reading the ttl: ")
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) Txn(ctx context.Context, req *api.TxnRequest) (*api.TxnResponse, error) {
+	for _, c := range req.Compares {
+		if err := s.authorize(ctx, c.Key, getAction); err != nil {
+			return nil, err
+		}
+	}
+	for _, ops := range [][]*api.Op{req.Success, req.Failure} {
+		for _, op := range ops {
+			if err := s.authorizeOp(ctx, op); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.Limits.ValidateTxn(req); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.Txn); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+	res, err := s.Data.Txn(req)
+
+	if err != nil {
+		return nil, internalError(err, "something went wrong while running the transaction: ")
+	}
+
+	return res, nil
+}
+
+// Scan streams the records of the range that the caller is allowed to read,
+// the others are left out. Each record is audited by the node that reads
+// it.
+func (s *grpcServer) Scan(req *api.ScanRequest, stream api.Database_ScanServer) error {
+	ctx := stream.Context()
+	if req.Consistency != api.Consistency_STALE {
+		if leader, ok, err := forward(ctx, s, req, api.DatabaseClient.Scan); ok {
+			if err != nil {
+				return err
+			}
+			return relay(leader, stream)
+		}
+	}
+
+	token, err := s.Data.Scan(req, func(record *api.Record) error {
+		if err := s.authorizeRecord(ctx, record.Key); err != nil {
+			if status.Code(err) == codes.PermissionDenied {
+				return db.SkipRecord
+			}
+			return err
+		}
+		return stream.Send(&api.ScanResponse{Record: record})
+	})
+	if err != nil {
+		return internalError(err, "something went wrong while scanning the keys: ")
+	}
+	if token != nil {
+		return stream.Send(&api.ScanResponse{ContinuationToken: token})
+	}
+
+	return nil
+}
+
+// relay copies the responses of a scan forwarded to the leader.
+func relay(leader api.Database_ScanClient, stream api.Database_ScanServer) error {
+	for {
+		res, err := leader.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// Watch streams the changes of the watched keys that the caller is allowed
+// to read, as they are applied by this node.
+func (s *grpcServer) Watch(req *api.WatchRequest, stream api.Database_WatchServer) error {
+	ctx := stream.Context()
+	if err := s.authorize(ctx, req.Key, getAction); err != nil {
+		return err
+	}
+
+	w, err := s.Data.Watch(req)
+	if err != nil {
+		return internalError(err, "something went wrong while watching the keys: ")
+	}
+	defer w.Close()
+	// the headers tell the client that the watch is in place
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-w.Events():
+			if !ok {
+				return w.Err()
+			}
+			if err := s.filter(ctx, event.Record.Key); err != nil {
+				continue
+			}
+			if err := stream.Send(&api.WatchResponse{Event: event}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcServer) MultiGet(ctx context.Context, req *api.MultiGetRequest) (*api.MultiGetResponse, error) {
+	if err := s.Limits.ValidateBatch(len(req.Keys)); err != nil {
+		return nil, err
+	}
+	if req.Consistency != api.Consistency_STALE {
+		if res, ok, err := forward(ctx, s, req, api.DatabaseClient.MultiGet); ok {
+			return res, err
+		}
+	}
+
+	results := make([]*api.MultiGetResponse_Result, len(req.Keys))
+	allowed := &api.MultiGetRequest{Consistency: req.Consistency}
+	pending := s.authorizeBatch(ctx, req.Keys, getAction, func(i int, err *api.Error) {
+		results[i] = &api.MultiGetResponse_Result{Error: err}
+	})
+	for _, i := range pending {
+		allowed.Keys = append(allowed.Keys, req.Keys[i])
+	}
+
+	res, err := s.Data.MultiGet(allowed)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while getting the values: ")
+	}
+	res.Results = db.Merge(results, pending, res.Results)
+
+	return res, nil
+}
+
+func (s *grpcServer) MultiSet(ctx context.Context, req *api.MultiSetRequest) (*api.MultiSetResponse, error) {
+	if err := s.Limits.ValidateBatch(len(req.Items)); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.MultiSet); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+
+	keys := make([]string, len(req.Items))
+	for i, item := range req.Items {
+		keys[i] = item.Key
+	}
+	results := make([]*api.MultiSetResponse_Result, len(req.Items))
+	allowed := &api.MultiSetRequest{}
+	pending := s.authorizeBatch(ctx, keys, setAction, func(i int, err *api.Error) {
+		results[i] = &api.MultiSetResponse_Result{Error: err}
+	})
+	for _, i := range pending {
+		allowed.Items = append(allowed.Items, req.Items[i])
+	}
+
+	res, err := s.Data.MultiSet(allowed)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while setting the values: ")
+	}
+	res.Results = db.Merge(results, pending, res.Results)
+
+	return res, nil
+}
+
+func (s *grpcServer) MultiDelete(ctx context.Context, req *api.MultiDeleteRequest) (*api.MultiDeleteResponse, error) {
+	if err := s.Limits.ValidateBatch(len(req.Items)); err != nil {
+		return nil, err
+	}
+	if res, ok, err := forward(ctx, s, req, api.DatabaseClient.MultiDelete); ok {
+		if err != nil {
+			return nil, err
+		}
+		res.Forwarded = true
+		return res, nil
+	}
+
+	keys := make([]string, len(req.Items))
+	for i, item := range req.Items {
+		keys[i] = item.Key
+	}
+	results := make([]*api.MultiDeleteResponse_Result, len(req.Items))
+	allowed := &api.MultiDeleteRequest{}
+	pending := s.authorizeBatch(ctx, keys, deleteAction, func(i int, err *api.Error) {
+		results[i] = &api.MultiDeleteResponse_Result{Error: err}
+	})
+	for _, i := range pending {
+		allowed.Items = append(allowed.Items, req.Items[i])
+	}
+
+	res, err := s.Data.MultiDelete(allowed)
+	if err != nil {
+		return nil, internalError(err, "something went wrong while deleting the values: ")
+	}
+	res.Results = db.Merge(results, pending, res.Results)
+
+	return res, nil
+}
+
+// authorizeBatch authorizes act on every key of a batch. The denied keys
+// fail with PermissionDenied without preventing the others from being
+// served: it calls denied with their position and error, and returns the
+// position of the others. The batches are forwarded before being
+// authorized since the leader authorizes them again.
+func (s *grpcServer) authorizeBatch(ctx context.Context, keys []string, act string, denied func(int, *api.Error)) []int {
+	var pending []int
+	for i, key := range keys {
+		if err := s.authorize(ctx, key, act); err != nil {
+			denied(i, db.ItemError(err))
+			continue
+		}
+		pending = append(pending, i)
+	}
+	return pending
+}
+
+func (s *grpcServer) authorizeOp(ctx context.Context, op *api.Op) error {
+	switch r := op.GetRequest().(type) {
+	case *api.Op_Set:
+		return s.authorize(ctx, r.Set.Key, setAction)
+	case *api.Op_Delete:
+		return s.authorize(ctx, r.Delete.Key, deleteAction)
+	case *api.Op_Get:
+		return s.authorize(ctx, r.Get.Key, getAction)
+	}
+	return status.Error(codes.InvalidArgument, "empty op in the transaction")
+}
+
+// authorize checks whether the caller may perform act on key, the key is the
+// object of the policies.
+func (s *grpcServer) authorize(ctx context.Context, key string, act string) error {
+	return s.authorizeAs(ctx, subject(ctx), key, act)
+}
+
+// authorizeAs is authorize for a subject that differs from the caller, such
+// as the caller in another tenant.
+func (s *grpcServer) authorizeAs(ctx context.Context, sub auth.Subject, key string, act string) error {
+	err := s.Authorizer.Authorize(sub, key, act)
+	if s.Audit != nil {
+		s.audit(ctx, sub, key, act, err)
+	}
+	return err
+}
+
+// authorizeRecord checks whether the caller may read a record of a scan.
+// The decisions are audited even when the scan was forwarded, the node that
+// forwarded it only relays the allowed records.
+func (s *grpcServer) authorizeRecord(ctx context.Context, key string) error {
+	sub := subject(ctx)
+	err := s.Authorizer.Authorize(sub, key, getAction)
+	if s.Audit != nil {
+		s.record(ctx, sub, key, getAction, err)
+	}
+	return err
+}
+
+// filter checks whether the caller may read an event of a watch, the events
+// aren't audited one by one.
+func (s *grpcServer) filter(ctx context.Context, key string) error {
+	return s.Authorizer.Authorize(subject(ctx), key, getAction)
+}
+
+// internalError keeps the errors that already carry a status and reports
+// the rest as codes.Internal.
+func internalError(err error, msg string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, msg+err.Error())
+}
+
+const (
+	// TenantKey is the metadata that picks the tenant of a request, the
+	// requests without it use auth.DefaultTenant.
+	TenantKey = "memdist-tenant"
+	// authorizationKey carries the bearer tokens.
+	authorizationKey = "authorization"
+	bearerScheme     = "bearer "
+)
+
+type subjectKey struct{}
+
+// authenticate finds the subject of a request with the Authenticator, the
+// requests forwarded by another node carry the subject of their caller.
+func (s *grpcServer) authenticate(ctx context.Context) (context.Context, error) {
+	creds, err := extractAuthData(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(forwardedSubjectKey)) > 0 {
+		return s.authenticateForwarded(ctx, creds, md)
+	}
+
+	authenticator := s.Authenticator
+	if authenticator == nil {
+		authenticator = auth.MTLS{}
+	}
+	sub, err := authenticator.Authenticate(ctx, creds)
+	if err == auth.ErrNoCredentials {
+		return ctx, status.Error(codes.Unauthenticated, "the request has no credentials")
+	}
+	if err != nil {
+		return ctx, err
+	}
+
+	return context.WithValue(ctx, subjectKey{}, sub), nil
+}
+
+// extractAuthData returns the credentials of a request: the verified chains
+// of its TLS connection, its bearer token and its tenant.
+func extractAuthData(ctx context.Context) (auth.Credentials, error) {
+	var creds auth.Credentials
 	peer, ok := peer.FromContext(ctx)
 	if !ok {
-		return ctx, status.New(
+		return creds, status.New(
 			codes.Unknown,
 			"couldn't find peer info",
 		).Err()
 	}
-
-	if peer.AuthInfo == nil {
-		return context.WithValue(ctx, username{}, ""), nil
+	// the connections without TLS have no AuthInfo
+	if tlsInfo, ok := peer.AuthInfo.(credentials.TLSInfo); ok {
+		creds.Chains = tlsInfo.State.VerifiedChains
 	}
 
-	tlsInfo := peer.AuthInfo.(credentials.TLSInfo)
-	subject := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(TenantKey); len(values) > 0 {
+		creds.Tenant = values[0]
+	}
+	if values := md.Get(authorizationKey); len(values) > 0 {
+		value := values[0]
+		if len(value) > len(bearerScheme) && strings.EqualFold(value[:len(bearerScheme)], bearerScheme) {
+			creds.Token = value[len(bearerScheme):]
+		}
+	}
 
-	ctx = context.WithValue(ctx, username{}, subject)
-	return ctx, nil
+	return creds, nil
 }
 
-func subject(ctx context.Context) string {
-	return ctx.Value(username{}).(string)
+func subject(ctx context.Context) auth.Subject {
+	return ctx.Value(subjectKey{}).(auth.Subject)
 }
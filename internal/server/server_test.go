@@ -2,17 +2,27 @@ package server_test
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/dunielm02/memdist/api/v1"
+	"github.com/dunielm02/memdist/internal/audit"
 	"github.com/dunielm02/memdist/internal/auth"
 	"github.com/dunielm02/memdist/internal/config"
 	"github.com/dunielm02/memdist/internal/db"
 	"github.com/dunielm02/memdist/internal/server"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestServer(t *testing.T) {
@@ -26,7 +36,7 @@ func TestServer(t *testing.T) {
 	for k, v := range testCases {
 		_, err := rootClient.Set(context.Background(), &api.SetRequest{
 			Key:   k,
-			Value: v,
+			Value: []byte(v),
 		})
 		require.NoError(t, err)
 	}
@@ -36,7 +46,7 @@ func TestServer(t *testing.T) {
 			Key: k,
 		})
 		require.NoError(t, err)
-		require.Equal(t, res.Value, v)
+		require.Equal(t, []byte(v), res.Value)
 	}
 
 	rootClient.Delete(context.Background(), &api.DeleteRequest{
@@ -52,9 +62,46 @@ func TestServer(t *testing.T) {
 		Key: "john",
 	})
 	require.Error(t, err)
+
+	_, err = rootClient.Expire(context.Background(), &api.ExpireRequest{
+		Key: "john",
+		Ttl: 60_000,
+	})
+	require.NoError(t, err)
+
+	ttl, err := rootClient.TTL(context.Background(), &api.TTLRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Greater(t, ttl.Ttl, int64(0))
+
+	_, err = rootClient.Persist(context.Background(), &api.PersistRequest{Key: "john"})
+	require.NoError(t, err)
+
+	ttl, err = rootClient.TTL(context.Background(), &api.TTLRequest{Key: "john"})
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), ttl.Ttl)
+
+	_, err = rootClient.Expire(context.Background(), &api.ExpireRequest{
+		Key: "foo",
+		Ttl: 60_000,
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = rootClient.Set(context.Background(), &api.SetRequest{
+		Key:   strings.Repeat("k", db.DefaultMaxKeySize+1),
+		Value: []byte("bar"),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
 func setup(t *testing.T) (api.DatabaseClient, api.DatabaseClient) {
+	t.Helper()
+	root, nobody := setupConns(t)
+	return api.NewDatabaseClient(root), api.NewDatabaseClient(nobody)
+}
+
+// setupConns starts a server that enforces the policies of its database
+// and returns the connections of root and nobody.
+func setupConns(t *testing.T) (*grpc.ClientConn, *grpc.ClientConn) {
 	t.Helper()
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -72,12 +119,14 @@ func setup(t *testing.T) (api.DatabaseClient, api.DatabaseClient) {
 		grpc.Creds(credentials.NewTLS(tlsConfig)),
 	}
 
-	authorizer, err := auth.New()
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
 	require.NoError(t, err)
 
+	data := db.NewDB(db.Options{OnPolicies: authorizer.SetPolicies})
 	srv, err := server.New(server.Config{
-		Data:       db.NewDB(),
+		Data:       data,
 		Authorizer: authorizer,
+		Policies:   data,
 	}, serverOpts...)
 	require.NoError(t, err)
 
@@ -88,7 +137,7 @@ func setup(t *testing.T) (api.DatabaseClient, api.DatabaseClient) {
 		}
 	}()
 
-	var newClient = func(cert, key string) api.DatabaseClient {
+	var newConn = func(cert, key string) *grpc.ClientConn {
 		tlsConfig, err = config.GetTlsConfig(config.TLSConfig{
 			CertFile: cert,
 			KeyFile:  key,
@@ -99,12 +148,668 @@ func setup(t *testing.T) (api.DatabaseClient, api.DatabaseClient) {
 		clientOpts := grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
 		conn, err := grpc.NewClient(ln.Addr().String(), clientOpts)
 		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	return newConn(config.RootCertFile, config.RootKeyFile),
+		newConn(config.NobodyCertFile, config.NobodyKeyFile)
+}
+
+func TestServerScan(t *testing.T) {
+	rootClient, nobodyClient := setup(t)
+
+	for _, k := range []string{"user/1", "user/2", "user/3", "zone"} {
+		_, err := rootClient.Set(context.Background(), &api.SetRequest{
+			Key:   k,
+			Value: []byte(k),
+		})
+		require.NoError(t, err)
+	}
+
+	scan := func(client api.DatabaseClient, req *api.ScanRequest) ([]string, []byte) {
+		stream, err := client.Scan(context.Background(), req)
+		require.NoError(t, err)
+		var (
+			keys  []string
+			token []byte
+		)
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return keys, token
+			}
+			require.NoError(t, err)
+			if res.Record != nil {
+				keys = append(keys, res.Record.Key)
+			}
+			token = res.ContinuationToken
+		}
+	}
+
+	keys, token := scan(rootClient, &api.ScanRequest{Prefix: "user/", Limit: 2})
+	require.Equal(t, []string{"user/1", "user/2"}, keys)
+	require.NotNil(t, token)
+
+	keys, token = scan(rootClient, &api.ScanRequest{
+		Prefix:            "user/",
+		Limit:             2,
+		ContinuationToken: token,
+	})
+	require.Equal(t, []string{"user/3"}, keys)
+	require.Nil(t, token)
+
+	// the keys the caller can't read are left out
+	keys, _ = scan(nobodyClient, &api.ScanRequest{})
+	require.Empty(t, keys)
+}
+
+func TestServerWatch(t *testing.T) {
+	rootClient, _ := setup(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := rootClient.Watch(ctx, &api.WatchRequest{Key: "foo"})
+	require.NoError(t, err)
+
+	// the watcher is registered once the stream carries its headers
+	_, err = stream.Header()
+	require.NoError(t, err)
+
+	set, err := rootClient.Set(context.Background(), &api.SetRequest{
+		Key:   "foo",
+		Value: []byte("bar"),
+	})
+	require.NoError(t, err)
+
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, api.Event_PUT, res.Event.Type)
+	require.Equal(t, []byte("bar"), res.Event.Record.Value)
+	require.Equal(t, set.Version, res.Event.Revision)
+}
+
+func TestServerBatch(t *testing.T) {
+	rootClient, nobodyClient := setup(t)
+
+	set, err := rootClient.MultiSet(context.Background(), &api.MultiSetRequest{
+		Items: []*api.SetRequest{
+			{Key: "foo", Value: []byte("bar")},
+			{Key: "john", Value: []byte("doe")},
+		},
+	})
+	require.NoError(t, err)
+	for _, result := range set.Results {
+		require.Nil(t, result.Error)
+	}
+
+	get, err := rootClient.MultiGet(context.Background(), &api.MultiGetRequest{
+		Keys: []string{"foo", "john"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []byte("bar"), get.Results[0].Value)
+	require.Equal(t, []byte("doe"), get.Results[1].Value)
+
+	// every item is authorized on its own
+	get, err = nobodyClient.MultiGet(context.Background(), &api.MultiGetRequest{
+		Keys: []string{"foo", "john"},
+	})
+	require.NoError(t, err)
+	for _, result := range get.Results {
+		require.Equal(t, uint32(codes.PermissionDenied), result.Error.Code)
+	}
+
+	_, err = rootClient.MultiDelete(context.Background(), &api.MultiDeleteRequest{
+		Items: make([]*api.DeleteRequest, db.DefaultMaxBatchSize+1),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerLoad(t *testing.T) {
+	rootClient, _ := setup(t)
+
+	stream, err := rootClient.Load(context.Background())
+	require.NoError(t, err)
+
+	// the records span several batches
+	count := db.DefaultMaxBatchSize*2 + 10
+	for i := 0; i < count; i += 100 {
+		req := &api.LoadRequest{}
+		for j := i; j < min(i+100, count); j++ {
+			req.Items = append(req.Items, &api.SetRequest{
+				Key:   fmt.Sprintf("key-%d", j),
+				Value: []byte(fmt.Sprint(j)),
+			})
+		}
+		require.NoError(t, stream.Send(req))
+	}
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(count), res.Count)
+
+	get, err := rootClient.Get(context.Background(), &api.GetRequest{Key: "key-42"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("42"), get.Value)
+	require.LessOrEqual(t, get.Version, res.Index)
+
+	// the load stops at the first invalid record
+	stream, err = rootClient.Load(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.LoadRequest{Items: []*api.SetRequest{
+		{Key: "foo", Value: []byte("bar")},
+		{Key: strings.Repeat("k", db.DefaultMaxKeySize+1)},
+	}}))
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerCounter(t *testing.T) {
+	rootClient, nobodyClient := setup(t)
+
+	res, err := rootClient.Incr(context.Background(), &api.IncrRequest{
+		Key:     "hits",
+		Delta:   1,
+		Initial: proto.Int64(1),
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res.Value)
+
+	dec, err := rootClient.Decr(context.Background(), &api.DecrRequest{Key: "hits", Delta: 3})
+	require.NoError(t, err)
+	require.Equal(t, int64(-2), dec.Value)
+
+	_, err = nobodyClient.Incr(context.Background(), &api.IncrRequest{Key: "hits", Delta: 1})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServerCollections(t *testing.T) {
+	rootClient, nobodyClient := setup(t)
+	ctx := context.Background()
+
+	_, err := rootClient.HSet(ctx, &api.HSetRequest{Key: "user", Fields: map[string][]byte{"name": []byte("john")}})
+	require.NoError(t, err)
+	hgetall, err := rootClient.HGetAll(ctx, &api.HGetAllRequest{Key: "user"})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"name": []byte("john")}, hgetall.Fields)
+
+	lpush, err := rootClient.LPush(ctx, &api.LPushRequest{Key: "queue", Values: [][]byte{[]byte("a"), []byte("b")}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lpush.Length)
+
+	_, err = rootClient.SAdd(ctx, &api.SAddRequest{Key: "tags", Members: []string{"go"}})
+	require.NoError(t, err)
+	smembers, err := rootClient.SMembers(ctx, &api.SMembersRequest{Key: "tags"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"go"}, smembers.Members)
+
+	_, err = rootClient.LRange(ctx, &api.LRangeRequest{Key: "tags", Stop: -1})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = nobodyClient.LPop(ctx, &api.LPopRequest{Key: "queue"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServerKeyAuthorization(t *testing.T) {
+	rootClient, nobodyClient := setup(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"public/news", "public/nobody/notes", "private/salary"} {
+		_, err := rootClient.Set(ctx, &api.SetRequest{Key: key, Value: []byte(key)})
+		require.NoError(t, err)
+	}
+
+	// nobody reads public/* and writes public/nobody/*
+	res, err := nobodyClient.Get(ctx, &api.GetRequest{Key: "public/news"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("public/news"), res.Value)
+	_, err = nobodyClient.Get(ctx, &api.GetRequest{Key: "private/salary"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = nobodyClient.Set(ctx, &api.SetRequest{Key: "public/nobody/notes", Value: []byte("new")})
+	require.NoError(t, err)
+	_, err = nobodyClient.Set(ctx, &api.SetRequest{Key: "public/news", Value: []byte("fake")})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = nobodyClient.Delete(ctx, &api.DeleteRequest{Key: "public/nobody/notes"})
+	require.NoError(t, err)
+	_, err = nobodyClient.Delete(ctx, &api.DeleteRequest{Key: "public/news"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the batches are authorized key by key
+	get, err := nobodyClient.MultiGet(ctx, &api.MultiGetRequest{
+		Keys: []string{"public/news", "private/salary"},
+	})
+	require.NoError(t, err)
+	require.Nil(t, get.Results[0].Error)
+	require.Equal(t, uint32(codes.PermissionDenied), get.Results[1].Error.Code)
+
+	set, err := nobodyClient.MultiSet(ctx, &api.MultiSetRequest{
+		Items: []*api.SetRequest{
+			{Key: "public/nobody/a", Value: []byte("a")},
+			{Key: "private/b", Value: []byte("b")},
+		},
+	})
+	require.NoError(t, err)
+	require.Nil(t, set.Results[0].Error)
+	require.Equal(t, uint32(codes.PermissionDenied), set.Results[1].Error.Code)
+
+	// so are the records of a scan
+	stream, err := nobodyClient.Scan(ctx, &api.ScanRequest{})
+	require.NoError(t, err)
+	var keys []string
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		keys = append(keys, res.Record.Key)
+	}
+	require.Equal(t, []string{"public/news", "public/nobody/a"}, keys)
+
+	// a transaction fails if any of its keys is denied
+	_, err = nobodyClient.Txn(ctx, &api.TxnRequest{
+		Success: []*api.Op{
+			{Request: &api.Op_Set{Set: &api.SetRequest{Key: "public/nobody/a", Value: []byte("c")}}},
+			{Request: &api.Op_Get{Get: &api.GetRequest{Key: "private/salary"}}},
+		},
+	})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServerPolicies(t *testing.T) {
+	rootConn, nobodyConn := setupConns(t)
+	root, nobody := api.NewDatabaseClient(rootConn), api.NewDatabaseClient(nobodyConn)
+	rootAdmin, nobodyAdmin := api.NewAdminClient(rootConn), api.NewAdminClient(nobodyConn)
+	ctx := context.Background()
+
+	_, err := root.Set(ctx, &api.SetRequest{Key: "billing/1", Value: []byte("10")})
+	require.NoError(t, err)
+	_, err = nobody.Get(ctx, &api.GetRequest{Key: "billing/1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	policy := &api.Policy{Subject: "nobody", Object: "billing/*", Action: "get"}
+	_, err = nobodyAdmin.AddPolicy(ctx, &api.AddPolicyRequest{Policy: policy})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	add, err := rootAdmin.AddPolicy(ctx, &api.AddPolicyRequest{Policy: policy})
+	require.NoError(t, err)
+	require.True(t, add.Added)
+
+	// the policy is enforced as soon as it is stored, the file policies
+	// still apply
+	res, err := nobody.Get(ctx, &api.GetRequest{Key: "billing/1"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("10"), res.Value)
+	_, err = root.Get(ctx, &api.GetRequest{Key: "billing/1"})
+	require.NoError(t, err)
+
+	list, err := rootAdmin.ListPolicies(ctx, &api.ListPoliciesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Policies, 1)
+	require.True(t, proto.Equal(policy, list.Policies[0]))
+
+	// the policies can't be reached through the keys that store them
+	_, err = root.Set(ctx, &api.SetRequest{Key: db.ReservedPrefix + "policies/x", Value: []byte("x")})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	stream, err := root.Scan(ctx, &api.ScanRequest{})
+	require.NoError(t, err)
+	var keys []string
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		keys = append(keys, res.Record.Key)
+	}
+	require.Equal(t, []string{"billing/1"}, keys)
+
+	remove, err := rootAdmin.RemovePolicy(ctx, &api.RemovePolicyRequest{Policy: policy})
+	require.NoError(t, err)
+	require.True(t, remove.Removed)
+	_, err = nobody.Get(ctx, &api.GetRequest{Key: "billing/1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
 
-		client := api.NewDatabaseClient(conn)
+	_, err = rootAdmin.AddPolicy(ctx, &api.AddPolicyRequest{Policy: &api.Policy{Subject: "nobody"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerRoles(t *testing.T) {
+	rootConn, nobodyConn := setupConns(t)
+	root, nobody := api.NewDatabaseClient(rootConn), api.NewDatabaseClient(nobodyConn)
+	admin := api.NewAdminClient(rootConn)
+	ctx := context.Background()
+
+	_, err := root.Set(ctx, &api.SetRequest{Key: "billing/1", Value: []byte("10")})
+	require.NoError(t, err)
 
-		return client
+	_, err = admin.AddPolicy(ctx, &api.AddPolicyRequest{
+		Policy: &api.Policy{Subject: "readers", Domain: "tenant-a", Object: "billing/*", Action: "get"},
+	})
+	require.NoError(t, err)
+	role := &api.RoleAssignment{Subject: "nobody", Role: "readers", Domain: "tenant-a"}
+	add, err := admin.AddRole(ctx, &api.AddRoleRequest{Role: role})
+	require.NoError(t, err)
+	require.True(t, add.Added)
+
+	list, err := admin.ListRoles(ctx, &api.ListRolesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Roles, 1)
+	require.True(t, proto.Equal(role, list.Roles[0]))
+
+	// the role only holds in the tenant picked by the caller
+	_, err = nobody.Get(ctx, &api.GetRequest{Key: "billing/1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	tenantA := metadata.AppendToOutgoingContext(ctx, server.TenantKey, "tenant-a")
+	res, err := nobody.Get(tenantA, &api.GetRequest{Key: "billing/1"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("10"), res.Value)
+
+	remove, err := admin.RemoveRole(ctx, &api.RemoveRoleRequest{Role: role})
+	require.NoError(t, err)
+	require.True(t, remove.Removed)
+	_, err = nobody.Get(tenantA, &api.GetRequest{Key: "billing/1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = api.NewAdminClient(nobodyConn).AddRole(ctx, &api.AddRoleRequest{Role: role})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// an admin of a tenant only writes the rules of that tenant
+	_, err = admin.AddPolicy(ctx, &api.AddPolicyRequest{
+		Policy: &api.Policy{Subject: "nobody", Domain: "tenant-a", Object: "*", Action: "admin"},
+	})
+	require.NoError(t, err)
+	tenantAdmin := api.NewAdminClient(nobodyConn)
+	_, err = tenantAdmin.AddRole(tenantA, &api.AddRoleRequest{Role: role})
+	require.NoError(t, err)
+	for _, domain := range []string{"tenant-b", "tenant-*", ""} {
+		_, err = tenantAdmin.AddRole(tenantA, &api.AddRoleRequest{
+			Role: &api.RoleAssignment{Subject: "nobody", Role: "readers", Domain: domain},
+		})
+		require.Equal(t, codes.PermissionDenied, status.Code(err), domain)
+		_, err = tenantAdmin.AddPolicy(tenantA, &api.AddPolicyRequest{
+			Policy: &api.Policy{Subject: "nobody", Domain: domain, Object: "*", Action: "get"},
+		})
+		require.Equal(t, codes.PermissionDenied, status.Code(err), domain)
+	}
+
+	// and only lists the rules of that tenant
+	_, err = admin.AddRole(ctx, &api.AddRoleRequest{
+		Role: &api.RoleAssignment{Subject: "nobody", Role: "readers", Domain: "tenant-b"},
+	})
+	require.NoError(t, err)
+	_, err = admin.AddPolicy(ctx, &api.AddPolicyRequest{
+		Policy: &api.Policy{Subject: "readers", Domain: "tenant-b", Object: "billing/*", Action: "get"},
+	})
+	require.NoError(t, err)
+	policies, err := tenantAdmin.ListPolicies(tenantA, &api.ListPoliciesRequest{})
+	require.NoError(t, err)
+	require.Len(t, policies.Policies, 2)
+	for _, policy := range policies.Policies {
+		require.Equal(t, "tenant-a", policy.Domain)
 	}
+	list, err = tenantAdmin.ListRoles(tenantA, &api.ListRolesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Roles, 1)
+	require.True(t, proto.Equal(role, list.Roles[0]))
+	list, err = admin.ListRoles(ctx, &api.ListRolesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Roles, 2)
+}
+
+func TestServerAPIKeys(t *testing.T) {
+	// without TLS the API keys are the only credentials
+	conn, data := setupInsecure(t, func(data *db.DB) server.Config {
+		return server.Config{Authenticator: auth.Chain{auth.MTLS{}, auth.APIKeys{Store: data}}}
+	})
+	client, admin := api.NewDatabaseClient(conn), api.NewAdminClient(conn)
+
+	ctx := context.Background()
+	_, err := client.Get(ctx, &api.GetRequest{Key: "public/news"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.Get(bearer("mdk_0000_secret"), &api.GetRequest{Key: "public/news"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	key, rootToken, err := auth.NewAPIKey("root", nil)
+	require.NoError(t, err)
+	require.NoError(t, data.AddAPIKey(&api.AddAPIKeyRequest{Key: key}))
+	_, err = client.Set(bearer(rootToken), &api.SetRequest{Key: "private/salary", Value: []byte("10")})
+	require.NoError(t, err)
+
+	_, err = admin.CreateAPIKey(ctx, &api.CreateAPIKeyRequest{Subject: "nobody"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	created, err := admin.CreateAPIKey(bearer(rootToken), &api.CreateAPIKeyRequest{Subject: "nobody"})
+	require.NoError(t, err)
+	_, err = admin.CreateAPIKey(bearer(created.Key), &api.CreateAPIKeyRequest{Subject: "nobody"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the key holds the policies of its subject
+	_, err = client.Get(bearer(created.Key), &api.GetRequest{Key: "private/salary"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Set(bearer(created.Key), &api.SetRequest{Key: "public/nobody/a", Value: []byte("a")})
+	require.NoError(t, err)
+
+	list, err := admin.ListAPIKeys(bearer(rootToken), &api.ListAPIKeysRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Keys, 2)
+	for _, k := range list.Keys {
+		require.Empty(t, k.Hash)
+	}
+
+	revoke, err := admin.RevokeAPIKey(bearer(rootToken), &api.RevokeAPIKeyRequest{Id: created.Id})
+	require.NoError(t, err)
+	require.True(t, revoke.Revoked)
+	_, err = client.Get(bearer(created.Key), &api.GetRequest{Key: "public/nobody/a"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// an admin of a tenant only makes keys for itself, with the roles it
+	// holds there, and the keys stay in that tenant
+	tenantA := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(bearer(token), server.TenantKey, "tenant-a")
+	}
+	_, err = admin.AddPolicy(bearer(rootToken), &api.AddPolicyRequest{
+		Policy: &api.Policy{Subject: "alice", Domain: "tenant-a", Object: "*", Action: "admin"},
+	})
+	require.NoError(t, err)
+	_, err = admin.AddRole(bearer(rootToken), &api.AddRoleRequest{
+		Role: &api.RoleAssignment{Subject: "alice", Role: "readers", Domain: "tenant-a"},
+	})
+	require.NoError(t, err)
+	_, err = admin.AddPolicy(bearer(rootToken), &api.AddPolicyRequest{
+		Policy: &api.Policy{Subject: "readers", Domain: "tenant-a", Object: "public/*", Action: "get"},
+	})
+	require.NoError(t, err)
+	alice, err := admin.CreateAPIKey(tenantA(rootToken), &api.CreateAPIKeyRequest{Subject: "alice"})
+	require.NoError(t, err)
+
+	for _, req := range []*api.CreateAPIKeyRequest{
+		{Subject: "root"},
+		{Subject: "alice", Roles: []string{"root"}},
+	} {
+		_, err = admin.CreateAPIKey(tenantA(alice.Key), req)
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+	readers, err := admin.CreateAPIKey(tenantA(alice.Key), &api.CreateAPIKeyRequest{
+		Subject: "alice",
+		Roles:   []string{"readers"},
+	})
+	require.NoError(t, err)
+
+	list, err = admin.ListAPIKeys(bearer(rootToken), &api.ListAPIKeysRequest{})
+	require.NoError(t, err)
+	for _, k := range list.Keys {
+		if k.Id == readers.Id {
+			require.Equal(t, "tenant-a", k.Tenant)
+		}
+	}
+	_, err = client.Get(tenantA(readers.Key), &api.GetRequest{Key: "public/news"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	ctx = metadata.AppendToOutgoingContext(bearer(readers.Key), server.TenantKey, "tenant-b")
+	_, err = client.Get(ctx, &api.GetRequest{Key: "public/news"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// nor does it list or revoke the keys of the other tenants
+	bob, err := admin.CreateAPIKey(
+		metadata.AppendToOutgoingContext(bearer(rootToken), server.TenantKey, "tenant-b"),
+		&api.CreateAPIKeyRequest{Subject: "bob"},
+	)
+	require.NoError(t, err)
+	list, err = admin.ListAPIKeys(tenantA(alice.Key), &api.ListAPIKeysRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Keys, 2)
+	for _, k := range list.Keys {
+		require.Equal(t, "tenant-a", k.Tenant)
+	}
+	for _, id := range []string{bob.Id, key.Id} {
+		_, err = admin.RevokeAPIKey(tenantA(alice.Key), &api.RevokeAPIKeyRequest{Id: id})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+	revoke, err = admin.RevokeAPIKey(tenantA(alice.Key), &api.RevokeAPIKeyRequest{Id: readers.Id})
+	require.NoError(t, err)
+	require.True(t, revoke.Revoked)
+}
+
+func TestServerAudit(t *testing.T) {
+	var mu sync.Mutex
+	var records []audit.Record
+	conn, _ := setupInsecure(t, func(*db.DB) server.Config {
+		return server.Config{
+			// the token is the name of the subject
+			Authenticator: auth.AuthenticatorFunc(func(ctx context.Context, creds auth.Credentials) (auth.Subject, error) {
+				if creds.Token == "" {
+					return auth.Subject{}, auth.ErrNoCredentials
+				}
+				return auth.Subject{Name: creds.Token, Tenant: creds.Tenant}, nil
+			}),
+			Audit: audit.New(audit.Config{Sink: audit.SinkFunc(func(r audit.Record) error {
+				mu.Lock()
+				defer mu.Unlock()
+				records = append(records, r)
+				return nil
+			})}),
+		}
+	})
+	client := api.NewDatabaseClient(conn)
+	last := func(n int) []audit.Record {
+		mu.Lock()
+		defer mu.Unlock()
+		require.GreaterOrEqual(t, len(records), n)
+		return records[len(records)-n:]
+	}
+
+	set, err := client.Set(bearer("root"), &api.SetRequest{Key: "private/salary", Value: []byte("10")})
+	require.NoError(t, err)
+	r := last(1)[0]
+	require.Equal(t, "root", r.Subject)
+	require.Equal(t, "set", r.Action)
+	require.Equal(t, "private/salary", r.Key)
+	require.Equal(t, audit.Allow, r.Decision)
+	require.Equal(t, set.Version, r.Index)
+	require.Equal(t, []byte("10"), r.Value)
+	require.Equal(t, "/api.database/Set", r.Method)
+	require.NotEmpty(t, r.Peer)
+
+	_, err = client.Get(bearer("nobody"), &api.GetRequest{Key: "private/salary"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	r = last(1)[0]
+	require.Equal(t, "nobody", r.Subject)
+	require.Equal(t, audit.Deny, r.Decision)
+	require.NotEmpty(t, r.Error)
+
+	_, err = client.Delete(context.Background(), &api.DeleteRequest{Key: "private/salary"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	r = last(1)[0]
+	require.Empty(t, r.Subject)
+	require.Equal(t, audit.Deny, r.Decision)
+
+	// every key of a batch gets its own record
+	multi, err := client.MultiSet(bearer("nobody"), &api.MultiSetRequest{Items: []*api.SetRequest{
+		{Key: "public/nobody/a", Value: []byte("a")},
+		{Key: "private/salary", Value: []byte("0")},
+	}})
+	require.NoError(t, err)
+	batch := last(2)
+	require.Equal(t, audit.Allow, batch[0].Decision)
+	require.Equal(t, multi.Results[0].Version, batch[0].Index)
+	require.Equal(t, audit.Deny, batch[1].Decision)
+	require.Zero(t, batch[1].Index)
+
+	// every record read by a scan gets its own record, the denied ones too
+	mu.Lock()
+	n := len(records)
+	mu.Unlock()
+	stream, err := client.Scan(bearer("nobody"), &api.ScanRequest{Prefix: "p"})
+	require.NoError(t, err)
+	var keys []string
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		keys = append(keys, res.Record.Key)
+	}
+	require.Equal(t, []string{"public/nobody/a"}, keys)
+	mu.Lock()
+	require.Len(t, records, n+2)
+	require.Equal(t, "private/salary", records[n].Key)
+	require.Equal(t, audit.Deny, records[n].Decision)
+	require.Equal(t, "public/nobody/a", records[n+1].Key)
+	require.Equal(t, audit.Allow, records[n+1].Decision)
+	require.Equal(t, "/api.database/Scan", records[n+1].Method)
+	mu.Unlock()
+
+	// the deletes, the deadlines and the transactions have an index too
+	del, err := client.Delete(bearer("root"), &api.DeleteRequest{Key: "public/nobody/a"})
+	require.NoError(t, err)
+	require.Greater(t, del.Index, multi.Results[0].Version)
+	require.Equal(t, del.Index, last(1)[0].Index)
+	expire, err := client.Expire(bearer("root"), &api.ExpireRequest{Key: "private/salary", Ttl: 60_000})
+	require.NoError(t, err)
+	require.Equal(t, expire.Version, last(1)[0].Index)
+	persist, err := client.Persist(bearer("root"), &api.PersistRequest{Key: "private/salary"})
+	require.NoError(t, err)
+	require.Equal(t, persist.Version, last(1)[0].Index)
+	txn, err := client.Txn(bearer("root"), &api.TxnRequest{Success: []*api.Op{
+		{Request: &api.Op_Set{Set: &api.SetRequest{Key: "public/nobody/a", Value: []byte("b")}}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, txn.Index, last(1)[0].Index)
+	multiDel, err := client.MultiDelete(bearer("root"), &api.MultiDeleteRequest{Items: []*api.DeleteRequest{
+		{Key: "public/nobody/a"},
+		{Key: "public/nobody/b", Precondition: &api.Precondition{IfPresent: true}},
+	}})
+	require.NoError(t, err)
+	batch = last(2)
+	require.Equal(t, multiDel.Index, batch[0].Index)
+	require.Zero(t, batch[1].Index)
+	require.NotEmpty(t, batch[1].Error)
+}
+
+// setupInsecure starts a server without TLS that enforces the policies of
+// its database, newConfig gives the fields of the config other than Data,
+// Authorizer and Policies.
+func setupInsecure(t *testing.T, newConfig func(*db.DB) server.Config) (*grpc.ClientConn, *db.DB) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+	data := db.NewDB(db.Options{OnPolicies: authorizer.SetPolicies})
+	cfg := newConfig(data)
+	cfg.Data, cfg.Authorizer, cfg.Policies = data, authorizer, data
+	srv, err := server.New(cfg)
+	require.NoError(t, err)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, data
+}
 
-	return newClient(config.RootCertFile, config.RootKeyFile),
-		newClient(config.NobodyCertFile, config.NobodyKeyFile)
+func bearer(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
 }